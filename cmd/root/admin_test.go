@@ -0,0 +1,41 @@
+package root
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdminToken(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{name: "ValidToken", token: "secret", authorization: "Bearer secret", want: http.StatusAccepted},
+		{name: "InvalidToken", token: "secret", authorization: "Bearer guess", want: http.StatusUnauthorized},
+		{name: "MissingToken", token: "secret", want: http.StatusUnauthorized},
+		{name: "MissingScheme", token: "secret", authorization: "secret", want: http.StatusUnauthorized},
+		{name: "NoTokenConfigured", token: "", authorization: "Bearer ", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			handler := requireAdminToken(tt.token, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			})
+			r := httptest.NewRequest(http.MethodPost, "/admin/restart", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.want {
+				t.Errorf("requireAdminToken() responded with %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package root
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/domain/usecase/proxy"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/config"
+	"github.com/fwiedmann/prox/internal/ipfilter"
+	"github.com/fwiedmann/prox/internal/modifiers"
+	"github.com/fwiedmann/prox/internal/server"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrorPortsNotApplied = errors.New("could not apply the port changes, the current ports stay active")
+
+// proxyListener serves a static config port
+type proxyListener struct {
+	port     config.Port
+	listener *server.Listener
+	cancel   context.CancelFunc
+}
+
+// listenerManager opens, reconfigures and closes the listeners according to the static configuration
+type listenerManager struct {
+	ctx          context.Context
+	static       config.Static
+	routes       route.Manager
+	tlsConf      *config.TLS
+	accessLogger proxy.AccessLogger
+	infra        *server.Listener
+	proxies      map[string]*proxyListener
+	caches       map[string]proxy.Cache
+	errChan      chan<- error
+	mtx          sync.Mutex
+	draining     sync.WaitGroup
+}
+
+func newListenerManager(ctx context.Context, static config.Static, routes route.Manager, tlsConf *config.TLS, accessLogger proxy.AccessLogger, infraHandler http.Handler, errChan chan<- error) *listenerManager {
+	return &listenerManager{
+		ctx:          ctx,
+		static:       static,
+		routes:       routes,
+		tlsConf:      tlsConf,
+		accessLogger: accessLogger,
+		infra:        server.NewListener("infra", fmt.Sprintf(":%d", static.InfraPort), infraHandler, nil),
+		proxies:      make(map[string]*proxyListener),
+		caches:       make(map[string]proxy.Cache),
+		errChan:      errChan,
+	}
+}
+
+// start opens all configured listeners. Listeners inherited from a parent process will be used instead of opening new ones.
+func (m *listenerManager) start(inherited map[string]net.Listener) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for _, p := range m.static.Ports {
+		pl, err := m.newProxyListener(p)
+		if err != nil {
+			return err
+		}
+		m.proxies[p.Name] = pl
+	}
+
+	for _, l := range m.listenersLocked() {
+		if ln, ok := inherited[l.HandoffKey()]; ok {
+			l.Inherit(ln)
+			delete(inherited, l.HandoffKey())
+			log.Debugf("Inherited listener of endpoint \"%s\" from parent process", l.Name())
+		}
+		if err := l.Listen(); err != nil {
+			return err
+		}
+		m.serve(l)
+	}
+
+	for key, ln := range inherited {
+		log.Warnf("Closing inherited listener \"%s\" which is not configured anymore", key)
+		ln.Close()
+	}
+	return nil
+}
+
+// reload applies the changes of the next static configuration. New ports will be opened, removed ports get drained and closed.
+// Changed ports will be replaced by a new listener, while the old listener drains its connections. A new listener reuses the socket
+// of the current listener with the same address, so ports can be reconfigured and addresses can move between ports without refusing connections.
+// The changes are only applied if all ports could be configured and opened, otherwise the current configuration stays active.
+func (m *listenerManager) reload(next config.Static) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if err := m.static.ValidateReload(next); err != nil {
+		return err
+	}
+
+	byAddr := make(map[uint16]*proxyListener, len(m.proxies))
+	for _, pl := range m.proxies {
+		byAddr[pl.port.Addr] = pl
+	}
+
+	nextPorts := make(map[string]config.Port, len(next.Ports))
+	prepared := make(map[string]*proxyListener)
+	createdCaches := make([]string, 0)
+	failed := make([]string, 0)
+	for _, p := range next.Ports {
+		nextPorts[p.Name] = p
+		if previous, ok := m.proxies[p.Name]; ok && reflect.DeepEqual(previous.port, p) {
+			continue
+		}
+
+		_, hasCache := m.caches[p.Name]
+		pl, err := m.prepareProxyListener(p, byAddr[p.Addr])
+		if _, ok := m.caches[p.Name]; ok && !hasCache {
+			createdCaches = append(createdCaches, p.Name)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("port \"%s\": %s", p.Name, err))
+			continue
+		}
+		prepared[p.Name] = pl
+	}
+
+	if len(failed) != 0 {
+		for _, pl := range prepared {
+			pl.cancel()
+			pl.listener.Close()
+		}
+		for _, name := range createdCaches {
+			closeCache(m.caches[name])
+			delete(m.caches, name)
+		}
+		return fmt.Errorf("%w: %s", ErrorPortsNotApplied, strings.Join(failed, ", "))
+	}
+
+	for name, pl := range m.proxies {
+		if _, ok := nextPorts[name]; !ok {
+			log.Infof("Port \"%s\" was removed, start draining", name)
+			delete(m.proxies, name)
+			m.drainInBackground(pl, next.Shutdown, m.caches[name])
+			delete(m.caches, name)
+		}
+	}
+
+	for name, pl := range prepared {
+		previous, ok := m.proxies[name]
+		m.serve(pl.listener)
+		m.proxies[name] = pl
+		if ok {
+			log.Infof("Port \"%s\" was reconfigured, start draining the previous listener", name)
+			m.drainInBackground(previous, next.Shutdown, nil)
+		} else {
+			log.Infof("Port \"%s\" was added", name)
+		}
+	}
+
+	current := m.static
+	m.static = next
+	if current.Cache.CacheMaxSizeInMegaByte != next.Cache.CacheMaxSizeInMegaByte {
+		for _, c := range m.caches {
+			if r, ok := c.(interface{ Resize(int64) }); ok {
+				r.Resize(next.Cache.CacheMaxSizeInMegaByte)
+			}
+		}
+		log.Infof("Resized caches to %d MB", next.Cache.CacheMaxSizeInMegaByte)
+	}
+	return nil
+}
+
+// prepareProxyListener creates the listener of a port and opens its socket without serving it yet.
+// If a current listener serves the same address, its socket is shared instead of opening a new one.
+func (m *listenerManager) prepareProxyListener(p config.Port, sameAddr *proxyListener) (*proxyListener, error) {
+	pl, err := m.newProxyListener(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if sameAddr != nil {
+		ln, err := sameAddr.listener.DuplicateListener()
+		if err != nil {
+			pl.cancel()
+			return nil, err
+		}
+		pl.listener.Inherit(ln)
+	}
+	if err := pl.listener.Listen(); err != nil {
+		pl.cancel()
+		return nil, err
+	}
+	return pl, nil
+}
+
+// listeners returns all currently served listeners including the infra listener
+func (m *listenerManager) listeners() []*server.Listener {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.listenersLocked()
+}
+
+func (m *listenerManager) listenersLocked() []*server.Listener {
+	listeners := make([]*server.Listener, 0, len(m.proxies)+1)
+	for _, pl := range m.proxies {
+		listeners = append(listeners, pl.listener)
+	}
+	return append(listeners, m.infra)
+}
+
+// cacheInspectors returns the caches of all ports which can be inspected and purged, keyed by the port name
+func (m *listenerManager) cacheInspectors() map[string]cache.Inspector {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	inspectors := make(map[string]cache.Inspector, len(m.caches))
+	for name, c := range m.caches {
+		if inspector, ok := c.(cache.Inspector); ok {
+			inspectors[name] = inspector
+		}
+	}
+	return inspectors
+}
+
+// shutdownConfig returns the shutdown configuration of the current static configuration
+func (m *listenerManager) shutdownConfig() config.Shutdown {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.static.Shutdown
+}
+
+// closeCaches waits for listeners which are still draining after a reload and closes all caches
+func (m *listenerManager) closeCaches() {
+	m.draining.Wait()
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, c := range m.caches {
+		closeCache(c)
+	}
+}
+
+// handOffCache is implemented by caches whose storage can only be owned by one process, e.g. the disk cache
+type handOffCache interface {
+	HandOff() error
+	Resume() error
+}
+
+// handOffCaches releases the storage of all caches for the new process of a hot restart
+func (m *listenerManager) handOffCaches() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for name, c := range m.caches {
+		if h, ok := c.(handOffCache); ok {
+			if err := h.HandOff(); err != nil {
+				log.Errorf("could not hand off the cache of port \"%s\", error: %s", name, err)
+			}
+		}
+	}
+}
+
+// resumeCaches takes back the storage of all caches after a failed hot restart
+func (m *listenerManager) resumeCaches() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for name, c := range m.caches {
+		if h, ok := c.(handOffCache); ok {
+			if err := h.Resume(); err != nil {
+				log.Errorf("could not resume the cache of port \"%s\", continue without it. error: %s", name, err)
+			}
+		}
+	}
+}
+
+// serve accepts the connections of an opened listener in the background
+func (m *listenerManager) serve(l *server.Listener) {
+	go func() {
+		if err := l.Serve(); err != nil {
+			select {
+			case m.errChan <- err:
+			case <-m.ctx.Done():
+			}
+		}
+	}()
+	log.Debugf("Started endpoint \"%s\" on %s", l.Name(), l.Server().Addr)
+}
+
+func (m *listenerManager) drainInBackground(pl *proxyListener, conf config.Shutdown, cache proxy.Cache) {
+	m.draining.Add(1)
+	go func() {
+		defer m.draining.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), conf.GetDrainTimeout())
+		defer cancel()
+
+		logReport(pl.listener.Shutdown(ctx), conf)
+		pl.cancel()
+		if cache != nil {
+			closeCache(cache)
+		}
+	}()
+}
+
+func (m *listenerManager) newProxyListener(p config.Port) (*proxyListener, error) {
+	portCache, ok := m.caches[p.Name]
+	if !ok {
+		var err error
+		if portCache, err = configureCache(m.static.Cache, p.Name); err != nil {
+			return nil, err
+		}
+		m.caches[p.Name] = portCache
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	pl := &proxyListener{port: p, cancel: cancel}
+
+	var portMiddlewares []route.Middleware
+	if p.IPFilter.IsEnabled() {
+		ipFilter, err := ipfilter.NewFilter(p.IPFilter.Rules, p.IPFilter.File)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		go ipFilter.StartFileWatch(ctx)
+		portMiddlewares = append(portMiddlewares, ipFilter.Inject)
+	}
+
+	px, err := proxy.NewUseCase(m.routes, portCache, p.Addr, m.accessLogger, m.static.ErrorPages, coalescingTimeout(m.static.Cache), portMiddlewares...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	handler := m.portHandler(p, portCache, px)
+
+	if !p.TlSEnabled {
+		pl.listener = server.NewListener(p.Name, fmt.Sprintf(":%d", p.Addr), handler, nil)
+		p.Limits.ConfigureServer(pl.listener.Server())
+		return pl, nil
+	}
+
+	portTLS, err := config.NewPortTLS(p.TLSOptions, m.tlsConf.GetCertificate)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go portTLS.StartSessionTicketKeyWatch(ctx)
+
+	pl.listener = server.NewListener(p.Name, fmt.Sprintf(":%d", p.Addr), handler, portTLS.ServerConfig())
+	p.Limits.ConfigureServer(pl.listener.Server())
+	if !p.TLSOptions.IsHTTP2Enabled() {
+		pl.listener.Server().TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	return pl, nil
+}
+
+// portHandler wraps the handler with the middlewares of the port
+func (m *listenerManager) portHandler(p config.Port, portCache proxy.Cache, handler http.Handler) http.Handler {
+	if inspector, ok := portCache.(cache.Inspector); ok && m.static.Cache.Admin.PurgeMethodEnabled {
+		routeFor := func(r *http.Request) (*route.Route, error) {
+			return proxy.RouteForRequest(m.routes, p.Addr, r)
+		}
+		handler = m.static.ErrorPages.Inject(cache.NewPurgeMethod(inspector, routeFor, m.static.Cache.Admin.IsPurgeAllowed).Inject(handler.ServeHTTP))
+	}
+
+	if limits := p.Limits; limits.MinTransferRateBytesPerSecond > 0 {
+		handler = server.NewMinTransferRate(limits.MinTransferRateBytesPerSecond, limits.GetMinTransferRateGracePeriod(), limits.GetReadTimeout()).Inject(handler.ServeHTTP)
+	}
+	if trustedProxies := p.IPFilter.GetTrustedProxies(); len(trustedProxies) != 0 {
+		handler = ipfilter.NewClientIPResolver(trustedProxies).Inject(handler.ServeHTTP)
+	}
+	if hsts := p.TLSOptions.HSTS; p.TlSEnabled && hsts.Enabled {
+		handler = modifiers.NewHSTS(hsts).Inject(handler.ServeHTTP)
+	}
+
+	// the request id is applied first, so that all responses and log entries of the port carry it
+	if requestID := m.static.RequestID; requestID.Enabled {
+		handler = modifiers.NewRequestID(requestID.Header, requestIDGenerator(requestID.Format), requestID.OverrideIncoming).Inject(handler.ServeHTTP)
+	}
+	return handler
+}
+
+func requestIDGenerator(format string) func() string {
+	if format == config.RequestIDFormatULID {
+		return modifiers.NewULID
+	}
+	return modifiers.NewUUID
+}
+
+func logReport(report server.Report, conf config.Shutdown) {
+	if report.Forced() {
+		log.Warnf("Endpoint \"%s\" did not drain within %s, forcibly closed %d in-flight request connections and %d upgraded connections", report.Name, conf.GetDrainTimeout(), report.ForciblyClosedRequests, report.ForciblyClosedUpgrades)
+	}
+}
+
+func closeCache(c proxy.Cache) {
+	if closer, ok := c.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// coalescingTimeout of the proxy use case, zero disables the coalescing of cache misses
+func coalescingTimeout(conf config.Cache) time.Duration {
+	if !conf.Enabled || !conf.Coalescing.Enabled {
+		return 0
+	}
+	return conf.Coalescing.GetWaitTimeout()
+}
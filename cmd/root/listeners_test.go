@@ -0,0 +1,279 @@
+package root
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/domain/usecase/proxy"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/config"
+	"github.com/fwiedmann/prox/internal/cors"
+	"github.com/fwiedmann/prox/internal/modifiers"
+	"github.com/fwiedmann/prox/internal/securityheaders"
+)
+
+func TestListenerManager_handOffCaches(t *testing.T) {
+	conf := config.Cache{Enabled: true, Type: config.CacheTypeDisk, Directory: t.TempDir(), CacheMaxSizeInMegaByte: -1, Eviction: config.CacheEvictionLRU}
+	parent, err := configureCache(conf, "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newListenerManager(context.Background(), config.Static{}, nil, nil, nil, nil, nil)
+	m.caches["http"] = parent
+	defer m.closeCaches()
+
+	r := &route.Route{NameID: "http", Hostname: "example.com"}
+	if err := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute).CreateRoute(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	request := &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/", Header: http.Header{}}
+	save(parent, *r, request, "cached")
+
+	m.handOffCaches()
+	child, err := configureCache(conf, "http")
+	if err != nil {
+		t.Fatalf("configureCache() of the new process returned error: %s", err)
+	}
+	if resp := child.Get(*r, request); resp == nil {
+		t.Error("Get() of the new process did not return the response cached before the hand off")
+	} else {
+		resp.Body.Close()
+	}
+	closeCache(child)
+
+	m.resumeCaches()
+	if resp := parent.Get(*r, request); resp == nil {
+		t.Error("Get() did not return the cached response after the caches were resumed")
+	} else {
+		resp.Body.Close()
+	}
+}
+
+// save stores the body and reads it completely like the proxy does
+func save(c proxy.Cache, r route.Route, request *http.Request, body string) {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Cache-Control": {"max-age=60"}}, ContentLength: int64(len(body)), Body: ioutil.NopCloser(bytes.NewBufferString(body))}
+	c.Save(r, request, resp)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+}
+
+// freePort returns a port which is currently not in use
+func freePort(t *testing.T) uint16 {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// isServed reports if prox answers http requests on the port
+func isServed(port uint16) bool {
+	client := http.Client{Timeout: time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+func TestListenerManager_reload(t *testing.T) {
+	first, second, occupied := freePort(t), freePort(t), freePort(t)
+	blocker, err := net.Listen("tcp", fmt.Sprintf(":%d", occupied))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocker.Close()
+
+	static := func(ports ...config.Port) config.Static {
+		return config.Static{InfraPort: freePort(t), Ports: ports}
+	}
+	withInfraPort := func(s config.Static, infraPort uint16) config.Static {
+		s.InfraPort = infraPort
+		return s
+	}
+	limited := config.Port{Name: "a", Addr: first, Limits: config.PortLimits{MaxHeaderBytes: 4096}}
+
+	tests := []struct {
+		name        string
+		current     []config.Port
+		next        []config.Port
+		unsafe      bool
+		wantErr     error
+		wantPorts   []config.Port
+		wantServed  []uint16
+		wantRefused []uint16
+	}{
+		{
+			name:       "Add",
+			current:    []config.Port{{Name: "a", Addr: first}},
+			next:       []config.Port{{Name: "a", Addr: first}, {Name: "b", Addr: second}},
+			wantPorts:  []config.Port{{Name: "a", Addr: first}, {Name: "b", Addr: second}},
+			wantServed: []uint16{first, second},
+		},
+		{
+			name:        "Remove",
+			current:     []config.Port{{Name: "a", Addr: first}, {Name: "b", Addr: second}},
+			next:        []config.Port{{Name: "a", Addr: first}},
+			wantPorts:   []config.Port{{Name: "a", Addr: first}},
+			wantServed:  []uint16{first},
+			wantRefused: []uint16{second},
+		},
+		{
+			name:       "Reconfigure",
+			current:    []config.Port{{Name: "a", Addr: first}},
+			next:       []config.Port{limited},
+			wantPorts:  []config.Port{limited},
+			wantServed: []uint16{first},
+		},
+		{
+			name:       "SwapAddresses",
+			current:    []config.Port{{Name: "a", Addr: first}, {Name: "b", Addr: second}},
+			next:       []config.Port{{Name: "a", Addr: second}, {Name: "b", Addr: first}},
+			wantPorts:  []config.Port{{Name: "a", Addr: second}, {Name: "b", Addr: first}},
+			wantServed: []uint16{first, second},
+		},
+		{
+			name:        "MoveToAddressOfRemovedPort",
+			current:     []config.Port{{Name: "a", Addr: first}, {Name: "b", Addr: second}},
+			next:        []config.Port{{Name: "a", Addr: second}},
+			wantPorts:   []config.Port{{Name: "a", Addr: second}},
+			wantServed:  []uint16{second},
+			wantRefused: []uint16{first},
+		},
+		{
+			name:        "UnsafeChange",
+			current:     []config.Port{{Name: "a", Addr: first}},
+			next:        []config.Port{{Name: "a", Addr: first}, {Name: "b", Addr: second}},
+			unsafe:      true,
+			wantErr:     config.ErrorUnsafeStaticReload,
+			wantPorts:   []config.Port{{Name: "a", Addr: first}},
+			wantServed:  []uint16{first},
+			wantRefused: []uint16{second},
+		},
+		{
+			name:        "FailedBind",
+			current:     []config.Port{{Name: "a", Addr: first}},
+			next:        []config.Port{{Name: "a", Addr: first}, {Name: "b", Addr: second}, {Name: "c", Addr: occupied}},
+			wantErr:     ErrorPortsNotApplied,
+			wantPorts:   []config.Port{{Name: "a", Addr: first}},
+			wantServed:  []uint16{first},
+			wantRefused: []uint16{second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errChan := make(chan error)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			routes := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+			current := static(tt.current...)
+			m := newListenerManager(ctx, current, routes, nil, nil, http.NotFoundHandler(), errChan)
+			if err := m.start(nil); err != nil {
+				t.Fatal(err)
+			}
+			defer drain(m)
+
+			next := withInfraPort(static(tt.next...), current.InfraPort)
+			if tt.unsafe {
+				next = withInfraPort(next, freePort(t))
+			}
+			if err := m.reload(next); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("reload() error = %v, want %v", err, tt.wantErr)
+			}
+			m.draining.Wait()
+
+			if !reflect.DeepEqual(m.static.Ports, tt.wantPorts) {
+				t.Errorf("reload() applied ports %+v, want %+v", m.static.Ports, tt.wantPorts)
+			}
+			for _, p := range tt.wantPorts {
+				if pl, ok := m.proxies[p.Name]; !ok || !reflect.DeepEqual(pl.port, p) {
+					t.Errorf("reload() did not serve port %+v", p)
+				}
+			}
+			if len(m.proxies) != len(tt.wantPorts) {
+				t.Errorf("reload() serves %d ports, want %d", len(m.proxies), len(tt.wantPorts))
+			}
+			for _, port := range tt.wantServed {
+				if !isServed(port) {
+					t.Errorf("port %d is not served after reload()", port)
+				}
+			}
+			for _, port := range tt.wantRefused {
+				if isServed(port) {
+					t.Errorf("port %d is still served after reload()", port)
+				}
+			}
+			select {
+			case err := <-errChan:
+				t.Errorf("listener failed after reload(), error: %s", err)
+			default:
+			}
+		})
+	}
+}
+
+func TestListenerManager_portHandlerUpgrade(t *testing.T) {
+	corsConfig := cors.Config{Enabled: true, AllowedOrigins: []string{"*"}}
+	if err := corsConfig.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	securityHeaders := securityheaders.Config{Enabled: true, HSTS: modifiers.HSTSOptions{Enabled: true}, ContentTypeNosniff: true}
+	if err := securityHeaders.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	static := config.Static{RequestID: config.RequestID{Enabled: true, Header: "X-Request-Id"}}
+	static.Cache.Admin.PurgeMethodEnabled = true
+	m := newListenerManager(context.Background(), static, nil, nil, nil, nil, nil)
+	p := config.Port{
+		Name:       "https",
+		TlSEnabled: true,
+		TLSOptions: config.TLSOptions{HSTS: modifiers.HSTSOptions{Enabled: true}},
+		Limits:     config.PortLimits{MinTransferRateBytesPerSecond: 1},
+	}
+
+	upgrade := func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("the http.ResponseWriter of the port middlewares is not a http.Hijacker")
+			http.Error(w, "not a http.Hijacker", http.StatusInternalServerError)
+			return
+		}
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			t.Errorf("Hijack() through the port middlewares returned error: %s", err)
+			return
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+		conn.Close()
+	}
+	handler := m.portHandler(p, cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU), securityHeaders.Inject(corsConfig.Inject(upgrade)))
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Origin", "https://example.com")
+	resp, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Upgrade got status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+}
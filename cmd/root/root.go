@@ -2,12 +2,17 @@ package root
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/accesslog"
+	"github.com/fwiedmann/prox/internal/server"
+	"github.com/fwiedmann/prox/internal/tracing"
 
 	"github.com/fwiedmann/prox/internal/infra"
 
@@ -69,59 +74,157 @@ var rootCmd = cobra.Command{
 
 		configErr := make(chan error, 2)
 		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
 		go c.StartConfigure(ctx, configErr)
 
-		tlsConf := config.NewDynamicTLSConfig(tlsConfigFile)
+		tlsConf := config.NewDynamicTLSConfig(tlsConfigFile, staticConfig.Certificates)
 
 		go tlsConf.StartWatch(ctx, configErr)
+		go tlsConf.StartMonitoring(ctx)
+
+		restartChan := make(chan struct{}, 1)
+		infra.ConfigureHistogramBuckets(staticConfig.Metrics.DurationBuckets, staticConfig.Metrics.SizeBuckets)
+		infraMux := infra.NewHTTPHandler()
+		if staticConfig.HotRestart.Enabled {
+			if staticConfig.HotRestart.EndpointEnabled {
+				infraMux.HandleFunc("/admin/restart", requireAdminToken(staticConfig.Admin.Token, restartHandler(restartChan)))
+			}
+			go notifyRestartOnSignal(ctx, restartChan)
+		}
 
-		proxyErrorChan := make(chan error, len(staticConfig.Ports))
+		inherited, err := server.InheritedListeners()
+		if err != nil {
+			return err
+		}
 
-		for _, port := range staticConfig.Ports {
-			go func(p config.Port) {
-				px, err := proxy.NewUseCase(manager, configureCache(staticConfig.Cache.Enabled, staticConfig.Cache.CacheMaxSizeInMegaByte), p.Addr, staticConfig.AccessLogEnabled)
-				if err != nil {
-					proxyErrorChan <- err
-					return
-				}
+		if staticConfig.Tracing.Enabled {
+			tracingProvider, err := tracing.New(ctx, staticConfig.Tracing)
+			if err != nil {
+				return err
+			}
+			defer shutdownTracing(tracingProvider, staticConfig.Tracing.GetExportTimeout())
+		}
 
-				s := http.Server{
-					Addr:    fmt.Sprintf(":%d", p.Addr),
-					Handler: px,
-				}
+		var accessLogger proxy.AccessLogger
+		if staticConfig.AccessLogEnabled {
+			l, err := accesslog.New(staticConfig.AccessLog)
+			if err != nil {
+				return err
+			}
+			defer l.Close()
+			accessLogger = l
+		}
 
-				if p.TlSEnabled {
-					s.TLSConfig = &tls.Config{GetCertificate: tlsConf.GetCertificate}
-					log.Debugf("Starting https endpoint on port %d", p.Addr)
-					proxyErrorChan <- s.ListenAndServeTLS("", "")
-					return
-				}
-				log.Debugf("Starting http endpoint on port %d", p.Addr)
-				proxyErrorChan <- s.ListenAndServe()
-			}(port)
+		// listeners of reloaded ports send to the same channel, a failing listener waits until the error was received or prox stops
+		proxyErrorChan := make(chan error)
+		listeners := newListenerManager(ctx, staticConfig, manager, tlsConf, accessLogger, infraMux, proxyErrorChan)
+		if err := listeners.start(inherited); err != nil {
+			return err
+		}
+		if staticConfig.Cache.Enabled && staticConfig.Cache.Admin.APIEnabled {
+			infraMux.HandleFunc("/admin/cache/entries", requireAdminToken(staticConfig.Admin.Token, cache.NewAdminHandler(listeners.cacheInspectors)))
 		}
 
-		go func() {
-			proxyErrorChan <- infra.StartInfraHTTPEndpoint(int(staticConfig.InfraPort))
-		}()
+		go config.WatchStaticFile(ctx, staticConfigFile, listeners.reload)
+
+		if err := server.NotifyReady(); err != nil {
+			log.Errorf("could not notify parent process about readiness, error: %s", err)
+		}
 
 		osNotifyChan := initOSNotifyChan()
 
-		select {
-		case err := <-configErr:
-			cancel()
-			return err
-		case err := <-proxyErrorChan:
-			cancel()
-			return err
-		case osSignal := <-osNotifyChan:
-			log.Warnf("received os %s signal, start  graceful shutdown of prox...", osSignal.String())
-			cancel()
-			return nil
+		for {
+			select {
+			case err := <-configErr:
+				return err
+			case err := <-proxyErrorChan:
+				return err
+			case osSignal := <-osNotifyChan:
+				log.Warnf("received os %s signal, start  graceful shutdown of prox...", osSignal.String())
+				shutdown(listeners)
+				return nil
+			case <-restartChan:
+				log.Info("Starting hot restart, handing off listeners to a new prox process...")
+				listeners.handOffCaches()
+				child, err := server.StartChild(listeners.listeners(), staticConfig.HotRestart.GetReadyTimeout())
+				if err != nil {
+					log.Errorf("hot restart failed, continue serving. error: %s", err)
+					listeners.resumeCaches()
+					continue
+				}
+				log.Infof("New prox process with pid %d took over the listeners, start draining...", child.Pid)
+				drain(listeners)
+				return nil
+			}
 		}
 	},
 }
 
+// shutdownTracing exports the pending spans before prox exits
+func shutdownTracing(provider *tracing.Provider, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		log.Errorf("could not export pending traces, error: %s", err)
+	}
+}
+
+// restartHandler triggers a hot restart on POST requests
+func restartHandler(restartChan chan<- struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		select {
+		case restartChan <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, http.StatusText(http.StatusAccepted))
+	}
+}
+
+// shutdown reports prox as unhealthy for the pre-stop delay, so that load balancers can stop sending new traffic.
+// Afterwards all listeners get drained.
+func shutdown(listeners *listenerManager) {
+	conf := listeners.shutdownConfig()
+	infra.SetHealthy(false)
+	if conf.GetPreStopDelay() > 0 {
+		log.Infof("Reporting unhealthy for the pre-stop delay of %s", conf.GetPreStopDelay())
+		time.Sleep(conf.GetPreStopDelay())
+	}
+	drain(listeners)
+}
+
+// drain stops accepting new connections on all listeners and waits for the in-flight requests until the drain timeout is reached.
+func drain(listeners *listenerManager) {
+	conf := listeners.shutdownConfig()
+	drainCtx, cancel := context.WithTimeout(context.Background(), conf.GetDrainTimeout())
+	defer cancel()
+
+	current := listeners.listeners()
+	reports := make(chan server.Report, len(current))
+	for _, l := range current {
+		go func(l *server.Listener) {
+			reports <- l.Shutdown(drainCtx)
+		}(l)
+	}
+
+	var forced bool
+	for range current {
+		report := <-reports
+		logReport(report, conf)
+		forced = forced || report.Forced()
+	}
+
+	listeners.closeCaches()
+
+	if !forced {
+		log.Info("Drained all endpoints, shutdown of prox completed")
+	}
+}
+
 func initOSNotifyChan() <-chan os.Signal {
 	notifyChan := make(chan os.Signal, 3)
 	signal.Notify(notifyChan, syscall.SIGTERM, syscall.SIGINT)
@@ -133,9 +236,13 @@ func Execute() error {
 	return rootCmd.Execute()
 }
 
-func configureCache(enabled bool, maxSize int64) proxy.Cache {
-	if enabled {
-		return cache.NewHTTPInMemoryCache(maxSize)
+// configureCache creates the cache of a port, a disk cache stores the responses of each port in its own sub directory
+func configureCache(conf config.Cache, portName string) (proxy.Cache, error) {
+	if !conf.Enabled {
+		return cache.Empty{}, nil
+	}
+	if conf.Type == config.CacheTypeDisk {
+		return cache.NewDiskCache(portName, filepath.Join(conf.Directory, portName), conf.CacheMaxSizeInMegaByte, conf.Eviction)
 	}
-	return cache.Empty{}
+	return cache.NewHTTPInMemoryCache(portName, conf.CacheMaxSizeInMegaByte, conf.Eviction), nil
 }
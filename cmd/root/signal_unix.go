@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package root
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyRestartOnSignal triggers a hot restart for each received SIGUSR2 signal
+func notifyRestartOnSignal(ctx context.Context, restartChan chan<- struct{}) {
+	notifyChan := make(chan os.Signal, 1)
+	signal.Notify(notifyChan, syscall.SIGUSR2)
+	defer signal.Stop(notifyChan)
+	for {
+		select {
+		case <-notifyChan:
+			select {
+			case restartChan <- struct{}{}:
+			default:
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
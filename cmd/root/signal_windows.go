@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package root
+
+import (
+	"context"
+)
+
+// notifyRestartOnSignal is a no-op, windows does not support the SIGUSR2 signal
+func notifyRestartOnSignal(_ context.Context, _ chan<- struct{}) {}
@@ -6,6 +6,12 @@ import (
 	"net/url"
 	"regexp"
 	"time"
+
+	"github.com/fwiedmann/prox/internal/compression"
+	"github.com/fwiedmann/prox/internal/cors"
+	"github.com/fwiedmann/prox/internal/errorpage"
+	"github.com/fwiedmann/prox/internal/ipfilter"
+	"github.com/fwiedmann/prox/internal/securityheaders"
 )
 
 // Middleware will be used to chain Middlewares before calling a root http.Handler.
@@ -19,38 +25,68 @@ type RequestIdentifier string
 
 // Middlewares
 type Middlewares struct {
-	HTTPSRedirect     bool `yaml:"https-redirect-enabled"`
-	HTTPSRedirectPort int  `yaml:"https-redirect-port"`
-	ForwardHostHeader bool `yaml:"forward-host-header"`
+	HTTPSRedirect     bool                   `yaml:"https-redirect-enabled"`
+	HTTPSRedirectPort int                    `yaml:"https-redirect-port"`
+	ForwardHostHeader bool                   `yaml:"forward-host-header"`
+	Compression       compression.Config     `yaml:"compression"`
+	IPFilter          ipfilter.Rules         `yaml:"ip-filter"`
+	CORS              cors.Config            `yaml:"cors"`
+	SecurityHeaders   securityheaders.Config `yaml:"security-headers"`
+}
+
+// CacheKey configures which parts of a request compose the key of its stored responses
+type CacheKey struct {
+	QueryInclude []string `yaml:"query-include,omitempty"`
+	QueryExclude []string `yaml:"query-exclude,omitempty"`
+	QuerySort    bool     `yaml:"query-sort"`
+	Headers      []string `yaml:"headers,omitempty"`
+	Cookies      []string `yaml:"cookies,omitempty"`
+	IgnoreCase   bool     `yaml:"ignore-case"`
+	Methods      []string `yaml:"methods,omitempty"`
+}
+
+// HasQueryRules checks if the query of a request has to be rewritten for the key
+func (k CacheKey) HasQueryRules() bool {
+	return len(k.QueryInclude) != 0 || len(k.QueryExclude) != 0 || k.QuerySort
 }
 
 // Route entity contains all information of an proxy Router which can be used to configure proxy requests.
 type Route struct {
-	NameID                      NameID                                                       `yaml:"name"`
-	CacheEnabled                bool                                                         `yaml:"cache-enabled"`
-	CacheTimeOutDuration        string                                                       `yaml:"cache-timeout"`
-	CacheMaxBodySizeInMegaBytes int64                                                        `yaml:"cache-max-body-size-in-mb"`
-	CacheAllowedContentTypes    []string                                                     `yaml:"cache-allowed-content-types"`
-	UpstreamURL                 string                                                       `yaml:"upstream-url"`
-	UpstreamTimeoutDuration     string                                                       `yaml:"upstream-timeout"`
-	UpstreamTLSValidation       bool                                                         `yaml:"upstream-skip-tls"`
-	Priority                    uint                                                         `yaml:"priority"`
-	Port                        uint16                                                       `yaml:"port"`
-	Hostname                    RequestIdentifier                                            `yaml:"hostname"`
-	HostnameRegexp              RequestIdentifier                                            `yaml:"hostname-regx"`
-	Path                        RequestIdentifier                                            `yaml:"path"`
-	PathRegexp                  RequestIdentifier                                            `yaml:"path-regx"`
-	Middlewares                 Middlewares                                                  `yaml:"middlewares"`
-	clientRequestModifiers      []Middleware                                                 `yaml:"-"`
-	upstreamModifiers           []func(r *http.Request) error                                `yaml:"-"`
-	downstreamModifiers         []func(w http.ResponseWriter, response *http.Response) error `yaml:"-"`
-	hostMatch                   *regexp.Regexp                                               `yaml:"-"`
-	pathMatch                   *regexp.Regexp                                               `yaml:"-"`
-	cacheTimeOutDuration        time.Duration                                                `yaml:"-"`
-	upstreamTimeoutDuration     time.Duration                                                `yaml:"-"`
-	cacheMaxBodySizeInBytes     int64                                                        `yaml:"-"`
-	upstreamURL                 *url.URL                                                     `yaml:"-"`
-	httpClient                  *http.Client                                                 `yaml:"-"`
+	NameID                        NameID                                                       `yaml:"name"`
+	CacheEnabled                  bool                                                         `yaml:"cache-enabled"`
+	CacheTimeOutDuration          string                                                       `yaml:"cache-timeout"`
+	CacheMaxBodySizeInMegaBytes   int64                                                        `yaml:"cache-max-body-size-in-mb"`
+	CacheAllowedContentTypes      []string                                                     `yaml:"cache-allowed-content-types"`
+	CacheStaleWhileRevalidate     string                                                       `yaml:"cache-stale-while-revalidate"`
+	CacheStaleIfError             string                                                       `yaml:"cache-stale-if-error"`
+	CacheKey                      CacheKey                                                     `yaml:"cache-key"`
+	PreserveUpstreamCacheHeaders  bool                                                         `yaml:"preserve-upstream-cache-headers"`
+	MaxRequestBodySizeInMegaBytes int64                                                        `yaml:"max-request-body-size-in-mb"`
+	UpstreamURL                   string                                                       `yaml:"upstream-url"`
+	UpstreamTimeoutDuration       string                                                       `yaml:"upstream-timeout"`
+	UpstreamTLSValidation         bool                                                         `yaml:"upstream-skip-tls"`
+	Transport                     Transport                                                    `yaml:"transport"`
+	Priority                      uint                                                         `yaml:"priority"`
+	Port                          uint16                                                       `yaml:"port"`
+	Hostname                      RequestIdentifier                                            `yaml:"hostname"`
+	HostnameRegexp                RequestIdentifier                                            `yaml:"hostname-regx"`
+	Path                          RequestIdentifier                                            `yaml:"path"`
+	PathRegexp                    RequestIdentifier                                            `yaml:"path-regx"`
+	Middlewares                   Middlewares                                                  `yaml:"middlewares"`
+	ErrorPages                    errorpage.Config                                             `yaml:"error-pages"`
+	clientRequestModifiers        []Middleware                                                 `yaml:"-"`
+	upstreamModifiers             []func(r *http.Request) error                                `yaml:"-"`
+	downstreamModifiers           []func(w http.ResponseWriter, response *http.Response) error `yaml:"-"`
+	hostMatch                     *regexp.Regexp                                               `yaml:"-"`
+	pathMatch                     *regexp.Regexp                                               `yaml:"-"`
+	cacheTimeOutDuration          time.Duration                                                `yaml:"-"`
+	upstreamTimeoutDuration       time.Duration                                                `yaml:"-"`
+	cacheMaxBodySizeInBytes       int64                                                        `yaml:"-"`
+	maxRequestBodySizeInBytes     int64                                                        `yaml:"-"`
+	cacheStaleWhileRevalidate     *time.Duration                                               `yaml:"-"`
+	cacheStaleIfError             *time.Duration                                               `yaml:"-"`
+	upstreamURL                   *url.URL                                                     `yaml:"-"`
+	httpClient                    *http.Client                                                 `yaml:"-"`
 }
 
 func (r *Route) GetHTTPClient() *http.Client {
@@ -87,11 +123,42 @@ func (r *Route) GetCacheMaxBodySizeInBytes() int64 {
 	return r.cacheMaxBodySizeInBytes
 }
 
+// GetMaxRequestBodySizeInBytes return a validated bytes size, -1 means infinite
+func (r *Route) GetMaxRequestBodySizeInBytes() int64 {
+	return r.maxRequestBodySizeInBytes
+}
+
 // GetCacheTimeOut returns a parsed duration
 func (r *Route) GetCacheTimeOut() time.Duration {
 	return r.cacheTimeOutDuration
 }
 
+// GetCacheStaleWhileRevalidate returns the parsed duration a stale response can be served while it is revalidated, false if it is not configured
+func (r *Route) GetCacheStaleWhileRevalidate() (time.Duration, bool) {
+	if r.cacheStaleWhileRevalidate == nil {
+		return 0, false
+	}
+	return *r.cacheStaleWhileRevalidate, true
+}
+
+// GetCacheStaleIfError returns the parsed duration a stale response can be served if the upstream fails, false if it is not configured
+func (r *Route) GetCacheStaleIfError() (time.Duration, bool) {
+	if r.cacheStaleIfError == nil {
+		return 0, false
+	}
+	return *r.cacheStaleIfError, true
+}
+
+// IsCacheableMethod checks if responses to requests with the method can be served from the cache
+func (r *Route) IsCacheableMethod(method string) bool {
+	for _, m := range r.CacheKey.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
 // GetUpstreamTimeout returns a parsed duration
 func (r *Route) GetUpstreamTimeout() time.Duration {
 	return r.upstreamTimeoutDuration
@@ -5,11 +5,15 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/fwiedmann/prox/internal/ipfilter"
 	"github.com/fwiedmann/prox/internal/modifiers"
 )
 
@@ -23,7 +27,9 @@ var (
 	ErrorInvalidHostName                 = fmt.Errorf("hostname is invalid. Used expression: %s", hostNameRegexp.String())
 	ErrorInvalidCacheTimeOutDuration     = errors.New("invalid cache time out duration format")
 	ErrorInvalidUpstreamTimeOutDuration  = errors.New("invalid upstream time out duration format")
+	ErrorInvalidCacheStaleDuration       = errors.New("invalid cache stale duration format")
 	ErrorInvalidUpstreamHost             = errors.New("invalid upstream host")
+	ErrorInvalidCacheKey                 = errors.New("invalid cache key")
 
 	hostNameRegexp = regexp.MustCompile(`^([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])(\.([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]{0,61}[a-zA-Z0-9]))*$`)
 	wildcardRegexp = regexp.MustCompile(`[\s\S]*`)
@@ -36,6 +42,14 @@ const megaBytesToBytesMultiplier = 1e+6
 type manager struct {
 	repo             repository
 	createHTTPClient func(r *Route) *http.Client
+	clients          map[NameID]routeClient
+	clientsMtx       sync.Mutex
+}
+
+// routeClient is the http client of a Route and the settings it was created with
+type routeClient struct {
+	key    transportKey
+	client *http.Client
 }
 
 // NewManager return a manager to interact with the entities stored in the repository.
@@ -44,6 +58,7 @@ func NewManager(r repository, createHTTPClient func(r *Route) *http.Client) Mana
 	return &manager{
 		repo:             r,
 		createHTTPClient: createHTTPClient,
+		clients:          make(map[NameID]routeClient),
 	}
 }
 
@@ -65,7 +80,11 @@ func (m *manager) UpdateRoute(ctx context.Context, r *Route) error {
 		return ctx.Err()
 	}
 
-	return m.repo.UpdateRoute(ctx, r)
+	if err := m.repo.UpdateRoute(ctx, r); err != nil {
+		return err
+	}
+	m.storeHTTPClient(r)
+	return nil
 }
 
 // ListRoutes which are stored in the managers repository. If the context has an error UpdateRoute will not call the repository and will return.
@@ -94,7 +113,12 @@ func (m *manager) CreateRoute(ctx context.Context, r *Route) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
-	return m.repo.CreateRoute(ctx, r)
+
+	if err := m.repo.CreateRoute(ctx, r); err != nil {
+		return err
+	}
+	m.storeHTTPClient(r)
+	return nil
 }
 
 func (m *manager) parseAndValidateRoute(r *Route) error {
@@ -111,6 +135,15 @@ func (m *manager) parseAndValidateRoute(r *Route) error {
 	}
 
 	parseCacheMaxBodySize(r)
+	parseMaxRequestBodySize(r)
+
+	if err := parseCacheKey(&r.CacheKey); err != nil {
+		return err
+	}
+
+	if err := parseTransport(&r.Transport); err != nil {
+		return err
+	}
 
 	if err := validateRouteRequestIdentifiers(r); err != nil {
 		return err
@@ -124,10 +157,48 @@ func (m *manager) parseAndValidateRoute(r *Route) error {
 		return err
 	}
 
-	r.httpClient = m.createHTTPClient(r)
+	if err := r.ErrorPages.Parse(); err != nil {
+		return err
+	}
+
+	r.httpClient = m.httpClientFor(r)
 	return nil
 }
 
+// httpClientFor returns the client of the route. The client of the stored configuration of the route is reused if its
+// transport settings are unchanged, otherwise a new client is created. See storeHTTPClient.
+func (m *manager) httpClientFor(r *Route) *http.Client {
+	m.clientsMtx.Lock()
+	defer m.clientsMtx.Unlock()
+
+	if previous, ok := m.clients[r.NameID]; ok && previous.key == r.transportKey() {
+		return previous.client
+	}
+	return m.createHTTPClient(r)
+}
+
+// storeHTTPClient keeps the client of the stored route for its next configuration.
+// The idle connections of the replaced client are closed, it is only called after the route was stored successfully.
+func (m *manager) storeHTTPClient(r *Route) {
+	m.clientsMtx.Lock()
+	defer m.clientsMtx.Unlock()
+
+	if previous, ok := m.clients[r.NameID]; ok && previous.client != r.httpClient {
+		previous.client.CloseIdleConnections()
+	}
+	m.clients[r.NameID] = routeClient{key: r.transportKey(), client: r.httpClient}
+}
+
+// closeHTTPClient closes the idle connections of the client of a removed route
+func (m *manager) closeHTTPClient(id NameID) {
+	m.clientsMtx.Lock()
+	defer m.clientsMtx.Unlock()
+	if previous, ok := m.clients[id]; ok {
+		previous.client.CloseIdleConnections()
+		delete(m.clients, id)
+	}
+}
+
 func parseDurations(r *Route) error {
 	if r.CacheTimeOutDuration == "" {
 		r.CacheTimeOutDuration = defaultCacheTimeoutDuration
@@ -148,8 +219,27 @@ func parseDurations(r *Route) error {
 		return ErrorInvalidUpstreamTimeOutDuration
 	}
 	r.upstreamTimeoutDuration = upstreamTimeOut
+
+	if r.cacheStaleWhileRevalidate, err = parseStaleDuration(r.CacheStaleWhileRevalidate); err != nil {
+		return err
+	}
+	if r.cacheStaleIfError, err = parseStaleDuration(r.CacheStaleIfError); err != nil {
+		return err
+	}
 	return nil
 }
+
+// parseStaleDuration returns nil if the duration is not configured, the directives of the responses will be used instead
+func parseStaleDuration(duration string) (*time.Duration, error) {
+	if duration == "" {
+		return nil, nil
+	}
+	parsed, err := time.ParseDuration(duration)
+	if err != nil || parsed < 0 {
+		return nil, fmt.Errorf("%w: \"%s\"", ErrorInvalidCacheStaleDuration, duration)
+	}
+	return &parsed, nil
+}
 func parseUpstreamURL(r *Route) error {
 	parsedUrl, err := url.Parse(r.UpstreamURL)
 	if err != nil {
@@ -162,11 +252,53 @@ func parseUpstreamURL(r *Route) error {
 func parseCacheMaxBodySize(r *Route) {
 	if r.CacheMaxBodySizeInMegaBytes <= 0 {
 		r.CacheMaxBodySizeInMegaBytes = -1
+		r.cacheMaxBodySizeInBytes = -1
+		return
 	}
 
 	r.cacheMaxBodySizeInBytes = r.CacheMaxBodySizeInMegaBytes * megaBytesToBytesMultiplier
 }
 
+// parseCacheKey normalizes the configured methods and headers. GET is cached by default, HEAD requests can be served from the responses of GET requests.
+func parseCacheKey(k *CacheKey) error {
+	if len(k.QueryInclude) != 0 && len(k.QueryExclude) != 0 {
+		return fmt.Errorf("%w: only one of query-include and query-exclude can be configured", ErrorInvalidCacheKey)
+	}
+
+	if len(k.Methods) == 0 {
+		k.Methods = []string{http.MethodGet}
+	}
+	var hasGet bool
+	for i, method := range k.Methods {
+		k.Methods[i] = strings.ToUpper(method)
+		switch k.Methods[i] {
+		case http.MethodGet:
+			hasGet = true
+		case http.MethodHead:
+		default:
+			return fmt.Errorf("%w: unsupported method \"%s\", only GET and HEAD are supported", ErrorInvalidCacheKey, method)
+		}
+	}
+	if !hasGet {
+		return fmt.Errorf("%w: the methods have to contain GET", ErrorInvalidCacheKey)
+	}
+
+	for i, header := range k.Headers {
+		k.Headers[i] = http.CanonicalHeaderKey(header)
+	}
+	return nil
+}
+
+func parseMaxRequestBodySize(r *Route) {
+	if r.MaxRequestBodySizeInMegaBytes <= 0 {
+		r.MaxRequestBodySizeInMegaBytes = -1
+		r.maxRequestBodySizeInBytes = -1
+		return
+	}
+
+	r.maxRequestBodySizeInBytes = r.MaxRequestBodySizeInMegaBytes * megaBytesToBytesMultiplier
+}
+
 func validateRouteRequestIdentifiers(r *Route) error {
 	if r.Hostname == "" && r.HostnameRegexp == "" && r.Path == "" && r.PathRegexp == "" {
 		return ErrorEmptyRequestIdentifiers
@@ -203,6 +335,30 @@ func configureRouteRequestMatches(r *Route) error {
 }
 
 func parseMiddlewares(r *Route) error {
+	if err := r.Middlewares.SecurityHeaders.Parse(); err != nil {
+		return err
+	}
+	if r.Middlewares.SecurityHeaders.Enabled {
+		r.clientRequestModifiers = append(r.clientRequestModifiers, r.Middlewares.SecurityHeaders.Inject)
+	}
+
+	if err := r.Middlewares.IPFilter.Parse(); err != nil {
+		return err
+	}
+	if !r.Middlewares.IPFilter.IsEmpty() {
+		ipFilter, err := ipfilter.NewFilter(r.Middlewares.IPFilter, "")
+		if err != nil {
+			return err
+		}
+		r.clientRequestModifiers = append(r.clientRequestModifiers, ipFilter.Inject)
+	}
+
+	if err := r.Middlewares.CORS.Parse(); err != nil {
+		return err
+	}
+	if r.Middlewares.CORS.Enabled {
+		r.clientRequestModifiers = append(r.clientRequestModifiers, r.Middlewares.CORS.Inject)
+	}
 
 	if r.Middlewares.HTTPSRedirect {
 		port := 443
@@ -216,8 +372,10 @@ func parseMiddlewares(r *Route) error {
 		r.upstreamModifiers = append(r.upstreamModifiers, modifiers.ForwardHost)
 	}
 
-	r.downstreamModifiers = append(r.downstreamModifiers, modifiers.SetProxyHTTPHeader)
-	return nil
+	if !r.Middlewares.SecurityHeaders.IsProxyHeaderDisabled() {
+		r.downstreamModifiers = append(r.downstreamModifiers, modifiers.SetProxyHTTPHeader)
+	}
+	return r.Middlewares.Compression.Parse()
 }
 
 func getRouteHostMatch(host, hostExpr string) (*regexp.Regexp, error) {
@@ -280,16 +438,33 @@ func (m *manager) DeleteRoute(ctx context.Context, id NameID) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
-	return m.repo.DeleteRoute(ctx, id)
+
+	if err := m.repo.DeleteRoute(ctx, id); err != nil {
+		return err
+	}
+	m.closeHTTPClient(id)
+	return nil
 }
 
 // CreateHTTPClientForRoute configure a *http.Client based on a routes configure
 func CreateHTTPClientForRoute(r *Route) *http.Client {
+	t := r.Transport
 	return &http.Client{
 		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   t.GetDialTimeout(),
+				KeepAlive: t.GetKeepAlive(),
+			}).DialContext,
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: r.UpstreamTLSValidation,
 			},
+			TLSHandshakeTimeout:   t.GetTLSHandshakeTimeout(),
+			ResponseHeaderTimeout: t.GetResponseHeaderTimeout(),
+			IdleConnTimeout:       t.GetIdleConnTimeout(),
+			MaxIdleConns:          t.MaxIdleConns,
+			MaxIdleConnsPerHost:   t.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       t.MaxConnsPerHost,
+			DisableKeepAlives:     t.DisableKeepAlives,
 		},
 		Timeout: r.GetUpstreamTimeout(),
 	}
@@ -3,7 +3,13 @@ package route
 import (
 	"context"
 	"errors"
+	"net/http"
 	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/cors"
+	"github.com/fwiedmann/prox/internal/ipfilter"
+	"github.com/fwiedmann/prox/internal/securityheaders"
 )
 
 func Test_manager_CreateRoute(t *testing.T) {
@@ -51,6 +57,104 @@ func Test_manager_CreateRoute(t *testing.T) {
 			wantErr: true,
 			errType: ErrorInvalidUpstreamTimeOutDuration,
 		},
+		{
+			name:   "InvalidCacheStaleIfError",
+			fields: fields{},
+			args: args{
+				ctx: context.Background(),
+				r: &Route{
+					NameID:            "test-route",
+					Hostname:          "docker.com",
+					CacheStaleIfError: "-1m",
+				},
+			},
+			wantErr: true,
+			errType: ErrorInvalidCacheStaleDuration,
+		},
+		{
+			name:   "InvalidCacheKeyMethod",
+			fields: fields{},
+			args: args{
+				ctx: context.Background(),
+				r: &Route{
+					NameID:   "test-route",
+					Hostname: "docker.com",
+					CacheKey: CacheKey{Methods: []string{"GET", "POST"}},
+				},
+			},
+			wantErr: true,
+			errType: ErrorInvalidCacheKey,
+		},
+		{
+			name:   "InvalidTransport",
+			fields: fields{},
+			args: args{
+				ctx: context.Background(),
+				r: &Route{
+					NameID:    "test-route",
+					Hostname:  "docker.com",
+					Transport: Transport{DialTimeout: "5 seconds"},
+				},
+			},
+			wantErr: true,
+			errType: ErrorInvalidTransport,
+		},
+		{
+			name:   "InvalidIPFilter",
+			fields: fields{},
+			args: args{
+				ctx: context.Background(),
+				r: &Route{
+					NameID:      "test-route",
+					Hostname:    "docker.com",
+					Middlewares: Middlewares{IPFilter: ipfilter.Rules{Allow: []string{"10.0.0.0/33"}}},
+				},
+			},
+			wantErr: true,
+			errType: ipfilter.ErrorInvalidRules,
+		},
+		{
+			name:   "InvalidCORS",
+			fields: fields{},
+			args: args{
+				ctx: context.Background(),
+				r: &Route{
+					NameID:      "test-route",
+					Hostname:    "docker.com",
+					Middlewares: Middlewares{CORS: cors.Config{Enabled: true, AllowedOrigins: []string{"*"}, AllowCredentials: true}},
+				},
+			},
+			wantErr: true,
+			errType: cors.ErrorInvalidConfig,
+		},
+		{
+			name:   "InvalidSecurityHeaders",
+			fields: fields{},
+			args: args{
+				ctx: context.Background(),
+				r: &Route{
+					NameID:      "test-route",
+					Hostname:    "docker.com",
+					Middlewares: Middlewares{SecurityHeaders: securityheaders.Config{Enabled: true, FrameOptions: "ALLOWALL"}},
+				},
+			},
+			wantErr: true,
+			errType: securityheaders.ErrorInvalidConfig,
+		},
+		{
+			name:   "InvalidCacheKeyQueryRules",
+			fields: fields{},
+			args: args{
+				ctx: context.Background(),
+				r: &Route{
+					NameID:   "test-route",
+					Hostname: "docker.com",
+					CacheKey: CacheKey{QueryInclude: []string{"page"}, QueryExclude: []string{"utm_source"}},
+				},
+			},
+			wantErr: true,
+			errType: ErrorInvalidCacheKey,
+		},
 		{
 			name:   "ErrorEmptyRoute",
 			fields: fields{},
@@ -255,6 +359,7 @@ func Test_manager_CreateRoute(t *testing.T) {
 			m := &manager{
 				repo:             tt.fields.repo,
 				createHTTPClient: CreateHTTPClientForRoute,
+				clients:          make(map[NameID]routeClient),
 			}
 			c := tt.args.ctx
 			if tt.cancelCtx {
@@ -345,6 +450,7 @@ func Test_manager_UpdateRoute(t *testing.T) {
 			m := &manager{
 				repo:             tt.fields.repo,
 				createHTTPClient: CreateHTTPClientForRoute,
+				clients:          make(map[NameID]routeClient),
 			}
 
 			c := tt.args.ctx
@@ -491,3 +597,53 @@ func Test_manager_DeleteRoute(t *testing.T) {
 		})
 	}
 }
+
+func Test_manager_HTTPClientReuse(t *testing.T) {
+	t.Parallel()
+	m := NewManager(NewInMemRepo(), CreateHTTPClientForRoute).(*manager)
+	ctx := context.Background()
+
+	r := &Route{NameID: "test-route", Hostname: "docker.com"}
+	if err := m.CreateRoute(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	created := r.GetHTTPClient()
+	if transport := created.Transport.(*http.Transport); transport.MaxIdleConnsPerHost != defaultTransportMaxIdleConnsPerHost || transport.IdleConnTimeout != 90*time.Second {
+		t.Errorf("transport got %d idle connections per host and idle timeout %s, want the defaults", transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	unchanged := &Route{NameID: "test-route", Hostname: "example.com"}
+	if err := m.UpdateRoute(ctx, unchanged); err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.GetHTTPClient() != created {
+		t.Error("the client was replaced although the transport settings are unchanged")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := m.UpdateRoute(canceled, &Route{NameID: "test-route", Hostname: "example.com", Transport: Transport{MaxConnsPerHost: 5}}); err == nil {
+		t.Fatal("UpdateRoute() with a canceled context returned no error")
+	}
+	if m.clients["test-route"].client != created {
+		t.Error("the client was replaced although the update failed")
+	}
+
+	changed := &Route{NameID: "test-route", Hostname: "example.com", Transport: Transport{MaxConnsPerHost: 10}}
+	if err := m.UpdateRoute(ctx, changed); err != nil {
+		t.Fatal(err)
+	}
+	if changed.GetHTTPClient() == created {
+		t.Error("the client was reused although the transport settings changed")
+	}
+	if got := changed.GetHTTPClient().Transport.(*http.Transport).MaxConnsPerHost; got != 10 {
+		t.Errorf("max connections per host got %d, want 10", got)
+	}
+
+	if err := m.DeleteRoute(ctx, "test-route"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.clients["test-route"]; ok {
+		t.Error("the client of the deleted route was not removed")
+	}
+}
@@ -0,0 +1,109 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrorInvalidTransport = errors.New("invalid transport configuration")
+
+const (
+	defaultTransportMaxIdleConns        = 100
+	defaultTransportMaxIdleConnsPerHost = 32
+	defaultTransportIdleConnTimeout     = "90s"
+	defaultTransportKeepAlive           = "30s"
+	defaultTransportDialTimeout         = "30s"
+	defaultTransportTLSHandshakeTimeout = "10s"
+	defaultTransportResponseTimeout     = "0s"
+)
+
+// Transport configures the connection pool to the upstream of a Route
+type Transport struct {
+	MaxIdleConns          int           `yaml:"max-idle-connections"`
+	MaxIdleConnsPerHost   int           `yaml:"max-idle-connections-per-host"`
+	MaxConnsPerHost       int           `yaml:"max-connections-per-host"`
+	IdleConnTimeout       string        `yaml:"idle-connection-timeout"`
+	KeepAlive             string        `yaml:"keep-alive"`
+	DialTimeout           string        `yaml:"dial-timeout"`
+	TLSHandshakeTimeout   string        `yaml:"tls-handshake-timeout"`
+	ResponseHeaderTimeout string        `yaml:"response-header-timeout"`
+	DisableKeepAlives     bool          `yaml:"disable-keep-alives"`
+	idleConnTimeout       time.Duration `yaml:"-"`
+	keepAlive             time.Duration `yaml:"-"`
+	dialTimeout           time.Duration `yaml:"-"`
+	tlsHandshakeTimeout   time.Duration `yaml:"-"`
+	responseHeaderTimeout time.Duration `yaml:"-"`
+}
+
+// GetIdleConnTimeout returns a parsed duration
+func (t Transport) GetIdleConnTimeout() time.Duration {
+	return t.idleConnTimeout
+}
+
+// GetKeepAlive returns a parsed duration
+func (t Transport) GetKeepAlive() time.Duration {
+	return t.keepAlive
+}
+
+// GetDialTimeout returns a parsed duration
+func (t Transport) GetDialTimeout() time.Duration {
+	return t.dialTimeout
+}
+
+// GetTLSHandshakeTimeout returns a parsed duration
+func (t Transport) GetTLSHandshakeTimeout() time.Duration {
+	return t.tlsHandshakeTimeout
+}
+
+// GetResponseHeaderTimeout returns a parsed duration, zero means no timeout
+func (t Transport) GetResponseHeaderTimeout() time.Duration {
+	return t.responseHeaderTimeout
+}
+
+func parseTransport(t *Transport) error {
+	if t.MaxIdleConns == 0 {
+		t.MaxIdleConns = defaultTransportMaxIdleConns
+	}
+	if t.MaxIdleConnsPerHost == 0 {
+		t.MaxIdleConnsPerHost = defaultTransportMaxIdleConnsPerHost
+	}
+	if t.MaxIdleConns < 0 || t.MaxIdleConnsPerHost < 0 || t.MaxConnsPerHost < 0 {
+		return fmt.Errorf("%w: connection limits can not be negative", ErrorInvalidTransport)
+	}
+
+	for _, d := range []struct {
+		name         string
+		value        *string
+		defaultValue string
+		parsed       *time.Duration
+	}{
+		{name: "idle-connection-timeout", value: &t.IdleConnTimeout, defaultValue: defaultTransportIdleConnTimeout, parsed: &t.idleConnTimeout},
+		{name: "keep-alive", value: &t.KeepAlive, defaultValue: defaultTransportKeepAlive, parsed: &t.keepAlive},
+		{name: "dial-timeout", value: &t.DialTimeout, defaultValue: defaultTransportDialTimeout, parsed: &t.dialTimeout},
+		{name: "tls-handshake-timeout", value: &t.TLSHandshakeTimeout, defaultValue: defaultTransportTLSHandshakeTimeout, parsed: &t.tlsHandshakeTimeout},
+		{name: "response-header-timeout", value: &t.ResponseHeaderTimeout, defaultValue: defaultTransportResponseTimeout, parsed: &t.responseHeaderTimeout},
+	} {
+		if *d.value == "" {
+			*d.value = d.defaultValue
+		}
+		parsed, err := time.ParseDuration(*d.value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("%w: invalid %s \"%s\"", ErrorInvalidTransport, d.name, *d.value)
+		}
+		*d.parsed = parsed
+	}
+	return nil
+}
+
+// transportKey contains all settings of a Route which are used to create its http client.
+// Routes with an unchanged key keep their client and its idle connections on updates.
+type transportKey struct {
+	transport       Transport
+	skipTLS         bool
+	upstreamTimeout time.Duration
+}
+
+func (r *Route) transportKey() transportKey {
+	return transportKey{transport: r.Transport, skipTLS: r.UpstreamTLSValidation, upstreamTimeout: r.upstreamTimeoutDuration}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/fwiedmann/prox/internal/infra"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/fwiedmann/prox/domain/entity/route"
@@ -49,6 +50,7 @@ func (f *file) StartConfigure(ctx context.Context, errChan chan<- error) {
 
 	routes := make([]*route.Route, 0)
 	if err := yaml.Unmarshal(content, &routes); err != nil {
+		infra.ConfigReloads.With(map[string]string{"config": "routes", "result": "failure"}).Inc()
 		errChan <- err
 		return
 	}
@@ -73,6 +75,9 @@ func (f *file) StartConfigure(ctx context.Context, errChan chan<- error) {
 			}
 		}
 		log.Info("Successfully configured proxy")
+		infra.ConfigReloads.With(map[string]string{"config": "routes", "result": "success"}).Inc()
+	} else {
+		infra.ConfigReloads.With(map[string]string{"config": "routes", "result": "failure"}).Inc()
 	}
 
 	initStat, err := os.Stat(f.pathToFile)
@@ -111,7 +116,9 @@ func (f *file) deleteStaleRoutes(ctx context.Context, routes []*route.Route) err
 			}
 		}
 		if !found {
-			return f.routeManager.DeleteRoute(ctx, r1.NameID)
+			if err := f.routeManager.DeleteRoute(ctx, r1.NameID); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fwiedmann/prox/internal/accesslog"
+	"github.com/fwiedmann/prox/internal/modifiers"
+)
+
+// AccessLogger defines an API for logging completed proxy requests
+type AccessLogger interface {
+	Log(entry accesslog.Entry)
+}
+
+type requestDetailsContextKey struct{}
+
+// requestDetails collects information of the request from the handlers for the access log entry
+type requestDetails struct {
+	upstreamErrorReason UpstreamErrorReason
+}
+
+func withRequestDetails(r *http.Request) (*http.Request, *requestDetails) {
+	details := &requestDetails{}
+	return r.WithContext(context.WithValue(r.Context(), requestDetailsContextKey{}, details)), details
+}
+
+func setUpstreamErrorReason(ctx context.Context, reason UpstreamErrorReason) {
+	if details, ok := ctx.Value(requestDetailsContextKey{}).(*requestDetails); ok {
+		details.upstreamErrorReason = reason
+	}
+}
+
+// responseRecorder records the status code and the written bytes of a response
+type responseRecorder struct {
+	*modifiers.HeaderWriter
+	statusCode   int
+	bytesWritten int64
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	rr := &responseRecorder{}
+	rr.HeaderWriter = modifiers.NewHeaderWriter(w, func(statusCode int) {
+		rr.statusCode = statusCode
+	})
+	return rr
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	n, err := rr.HeaderWriter.Write(b)
+	rr.bytesWritten += int64(n)
+	return n, err
+}
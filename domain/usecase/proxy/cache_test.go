@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/compression"
+	"github.com/fwiedmann/prox/internal/config"
+	"github.com/fwiedmann/prox/internal/errorpage"
+)
+
+func Test_httpProxyUseCase_ServeHTTP_Revalidation(t *testing.T) {
+	t.Parallel()
+	var upstreamRequests, conditionalRequests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamRequests, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=0")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&conditionalRequests, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+	if err := m.CreateRoute(context.Background(), &route.Route{NameID: "cached", UpstreamURL: upstream.URL, Hostname: "example.com", Port: 8080, CacheEnabled: true, PreserveUpstreamCacheHeaders: true}); err != nil {
+		t.Fatal(err)
+	}
+	c := cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+	defer c.Close()
+	u, err := NewUseCase(m, c, 8080, nil, errorpage.Config{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                    string
+		ifNoneMatch             string
+		wantStatusCode          int
+		wantBody                string
+		wantUpstreamRequests    int32
+		wantConditionalRequests int32
+	}{
+		{
+			name:                 "Miss",
+			wantStatusCode:       http.StatusOK,
+			wantBody:             "hello",
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                    "Revalidated",
+			wantStatusCode:          http.StatusOK,
+			wantBody:                "hello",
+			wantUpstreamRequests:    2,
+			wantConditionalRequests: 1,
+		},
+		{
+			name:                    "ClientNotModified",
+			ifNoneMatch:             `"v1"`,
+			wantStatusCode:          http.StatusNotModified,
+			wantUpstreamRequests:    3,
+			wantConditionalRequests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			u.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatusCode || w.Body.String() != tt.wantBody {
+				t.Errorf("response got %d %q, want %d %q", w.Code, w.Body.String(), tt.wantStatusCode, tt.wantBody)
+			}
+			if got := w.Header().Get("Cache-Control"); got != "max-age=0" {
+				t.Errorf("Cache-Control got %q, want the preserved upstream header", got)
+			}
+			if got := atomic.LoadInt32(&upstreamRequests); got != tt.wantUpstreamRequests {
+				t.Errorf("upstream requests got %d, want %d", got, tt.wantUpstreamRequests)
+			}
+			if got := atomic.LoadInt32(&conditionalRequests); got != tt.wantConditionalRequests {
+				t.Errorf("conditional upstream requests got %d, want %d", got, tt.wantConditionalRequests)
+			}
+		})
+	}
+}
+
+func Test_httpProxyUseCase_ServeHTTP_CacheKey(t *testing.T) {
+	t.Parallel()
+	var upstreamRequests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamRequests, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+	cacheKey := route.CacheKey{QueryExclude: []string{"utm_source"}, QuerySort: true, Methods: []string{"get", "head"}}
+	if err := m.CreateRoute(context.Background(), &route.Route{NameID: "cached", UpstreamURL: upstream.URL, Hostname: "example.com", Port: 8080, CacheEnabled: true, CacheKey: cacheKey}); err != nil {
+		t.Fatal(err)
+	}
+	c := cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+	defer c.Close()
+	u, err := NewUseCase(m, c, 8080, nil, errorpage.Config{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		method               string
+		target               string
+		wantUpstreamRequests int32
+	}{
+		{
+			name:                 "Miss",
+			method:               http.MethodGet,
+			target:               "/items?b=2&a=1&utm_source=newsletter",
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                 "SortedWithoutExcludedParam",
+			method:               http.MethodGet,
+			target:               "/items?a=1&b=2",
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                 "HeadFromGet",
+			method:               http.MethodHead,
+			target:               "/items?a=1&b=2",
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                 "OtherParamValue",
+			method:               http.MethodGet,
+			target:               "/items?a=1&b=3",
+			wantUpstreamRequests: 2,
+		},
+		{
+			name:                 "NotCachedMethod",
+			method:               http.MethodPost,
+			target:               "/items?a=1&b=2",
+			wantUpstreamRequests: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Host = "example.com"
+			w := httptest.NewRecorder()
+			u.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("status got %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := atomic.LoadInt32(&upstreamRequests); got != tt.wantUpstreamRequests {
+				t.Errorf("upstream requests got %d, want %d", got, tt.wantUpstreamRequests)
+			}
+		})
+	}
+}
+
+func Test_httpProxyUseCase_ServeHTTP_CompressedVariants(t *testing.T) {
+	t.Parallel()
+	var upstreamRequests int32
+	var upstreamAcceptEncoding atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamRequests, 1)
+		upstreamAcceptEncoding.Store(r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(strings.Repeat("hello ", 500)))
+	}))
+	defer upstream.Close()
+
+	m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+	middlewares := route.Middlewares{Compression: compression.Config{Enabled: true}}
+	if err := m.CreateRoute(context.Background(), &route.Route{NameID: "compressed", UpstreamURL: upstream.URL, Hostname: "example.com", Port: 8080, CacheEnabled: true, Middlewares: middlewares}); err != nil {
+		t.Fatal(err)
+	}
+	c := cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+	defer c.Close()
+	u, err := NewUseCase(m, c, 8080, nil, errorpage.Config{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                 string
+		acceptEncoding       string
+		wantEncoding         string
+		wantUpstreamRequests int32
+	}{
+		{
+			name:                 "BrotliMiss",
+			acceptEncoding:       "gzip, br",
+			wantEncoding:         "br",
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                 "BrotliHit",
+			acceptEncoding:       "gzip, br",
+			wantEncoding:         "br",
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                 "GzipMiss",
+			acceptEncoding:       "deflate, gzip",
+			wantEncoding:         "gzip",
+			wantUpstreamRequests: 2,
+		},
+		{
+			name:                 "GzipHit",
+			acceptEncoding:       "deflate, gzip",
+			wantEncoding:         "gzip",
+			wantUpstreamRequests: 2,
+		},
+		{
+			name:                 "OtherAcceptEncodingMiss",
+			acceptEncoding:       "gzip",
+			wantEncoding:         "gzip",
+			wantUpstreamRequests: 3,
+		},
+		{
+			name:                 "IdentityMiss",
+			wantUpstreamRequests: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			u.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding got %q, want %q", got, tt.wantEncoding)
+			}
+			if got := atomic.LoadInt32(&upstreamRequests); got != tt.wantUpstreamRequests {
+				t.Errorf("upstream requests got %d, want %d", got, tt.wantUpstreamRequests)
+			}
+			if got := r.Header.Get("Accept-Encoding"); got != tt.acceptEncoding {
+				t.Errorf("client Accept-Encoding was changed to %q, want %q", got, tt.acceptEncoding)
+			}
+			// without Accept-Encoding the transport of the route requests gzip and decompresses the response itself
+			if got := upstreamAcceptEncoding.Load(); tt.acceptEncoding != "" && got != tt.acceptEncoding {
+				t.Errorf("upstream Accept-Encoding got %q, want %q", got, tt.acceptEncoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/infra"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of a coalesced cache miss
+const (
+	coalescedHit     = "hit"
+	coalescedMiss    = "miss"
+	coalescedTimeout = "timeout"
+)
+
+// flightGroup collapses concurrent cache misses of the same resource. Only the first request fetches the response from the
+// upstream, all other requests wait until it finished and look up the cache again.
+type flightGroup struct {
+	mtx     sync.Mutex
+	flights map[string]chan struct{}
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]chan struct{})}
+}
+
+// join the flight of the route and request. The first request leads the flight and has to call done once it finished,
+// all other requests receive a channel which is closed after the leader finished.
+func (g *flightGroup) join(route route.Route, request *http.Request) (done func(), wait <-chan struct{}) {
+	key := cache.BuildID(route, request)
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if flight, ok := g.flights[key]; ok {
+		return nil, flight
+	}
+
+	flight := make(chan struct{})
+	g.flights[key] = flight
+	return func() {
+		g.mtx.Lock()
+		delete(g.flights, key)
+		g.mtx.Unlock()
+		close(flight)
+	}, nil
+}
+
+// coalesce waits for a concurrent request of the same resource and returns the response it stored in the cache.
+// If the request leads the flight, the returned done func has to be called once the response was written.
+// Returns neither a response nor a done func if the wait timed out, the request was canceled or the leader did not store a response.
+func (rh rootHandler) coalesce(r *http.Request, labels prometheus.Labels) (resp *http.Response, done func()) {
+	done, wait := rh.flights.join(rh.route, r)
+	if done != nil {
+		return nil, done
+	}
+
+	timer := time.NewTimer(rh.coalescingTimeout)
+	defer timer.Stop()
+	select {
+	case <-wait:
+	case <-timer.C:
+		infra.CacheCoalescedRequests.With(withLabel(labels, "result", coalescedTimeout)).Inc()
+		return nil, nil
+	case <-r.Context().Done():
+		return nil, nil
+	}
+
+	if resp = rh.cache.Get(rh.route, r); resp == nil {
+		infra.CacheCoalescedRequests.With(withLabel(labels, "result", coalescedMiss)).Inc()
+		return nil, nil
+	}
+	infra.CacheCoalescedRequests.With(withLabel(labels, "result", coalescedHit)).Inc()
+	return resp, nil
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/config"
+	"github.com/fwiedmann/prox/internal/errorpage"
+)
+
+func Test_httpProxyUseCase_ServeHTTP_Coalescing(t *testing.T) {
+	t.Parallel()
+	const concurrentRequests = 5
+	tests := []struct {
+		name                 string
+		coalescingTimeout    time.Duration
+		wantUpstreamRequests int32
+	}{
+		{
+			name:                 "Coalesced",
+			coalescingTimeout:    5 * time.Second,
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:                 "WaitTimeout",
+			coalescingTimeout:    10 * time.Millisecond,
+			wantUpstreamRequests: concurrentRequests,
+		},
+		{
+			name:                 "Disabled",
+			wantUpstreamRequests: concurrentRequests,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var upstreamRequests int32
+			release := make(chan struct{})
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&upstreamRequests, 1)
+				<-release
+				w.Header().Set("Cache-Control", "max-age=60")
+				_, _ = w.Write([]byte("hello"))
+			}))
+			defer upstream.Close()
+
+			m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+			if err := m.CreateRoute(context.Background(), &route.Route{NameID: "coalesced", UpstreamURL: upstream.URL, Hostname: "example.com", Port: 8080, CacheEnabled: true}); err != nil {
+				t.Fatal(err)
+			}
+			c := cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+			defer c.Close()
+			u, err := NewUseCase(m, c, 8080, nil, errorpage.Config{}, tt.coalescingTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			responses := make([]*httptest.ResponseRecorder, concurrentRequests)
+			for i := range responses {
+				responses[i] = httptest.NewRecorder()
+				wg.Add(1)
+				go func(w *httptest.ResponseRecorder) {
+					defer wg.Done()
+					u.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+				}(responses[i])
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for atomic.LoadInt32(&upstreamRequests) < tt.wantUpstreamRequests && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if got := atomic.LoadInt32(&upstreamRequests); got != tt.wantUpstreamRequests {
+				t.Errorf("upstream requests got %d, want %d", got, tt.wantUpstreamRequests)
+			}
+			for _, w := range responses {
+				if w.Code != http.StatusOK || w.Body.String() != "hello" {
+					t.Errorf("response got %d %q, want %d %q", w.Code, w.Body.String(), http.StatusOK, "hello")
+				}
+			}
+		})
+	}
+}
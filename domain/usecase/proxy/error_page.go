@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/errorpage"
+	"github.com/fwiedmann/prox/internal/modifiers"
+)
+
+// writeError replies with the first matching error page of the configs, the message must not contain internal details
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string, routeName route.NameID, configs ...errorpage.Config) {
+	errorpage.Write(w, r, errorpage.Data{
+		Status:    status,
+		Message:   message,
+		RequestID: modifiers.RequestIDFromContext(r.Context()),
+		Route:     string(routeName),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+	}, configs...)
+}
+
+// writeError replies with the error pages of the route or the global ones
+func (rh rootHandler) writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeError(w, r, status, message, rh.route.NameID, rh.route.ErrorPages, rh.errorPages)
+}
+
+func (rh rootHandler) interceptUpstreamErrors() bool {
+	return rh.route.ErrorPages.InterceptUpstreamErrors || rh.errorPages.InterceptUpstreamErrors
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/config"
+	"github.com/fwiedmann/prox/internal/errorpage"
+	"github.com/fwiedmann/prox/internal/ipfilter"
+)
+
+func Test_httpProxyUseCase_ServeHTTP_Errors(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/failing":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte("stack trace of 10.0.0.1"))
+		}
+	}))
+	defer upstream.Close()
+
+	refused := httptest.NewServer(http.NotFoundHandler())
+	refusedURL := refused.URL
+	refused.Close()
+
+	routes := []*route.Route{
+		{NameID: "slow", UpstreamURL: upstream.URL, UpstreamTimeoutDuration: "50ms", Hostname: "example.com", Path: "/slow", Port: 8080},
+		{NameID: "failing", UpstreamURL: upstream.URL, Hostname: "example.com", Path: "/failing", Port: 8080,
+			ErrorPages: errorpage.Config{InterceptUpstreamErrors: true}},
+		{NameID: "refused", UpstreamURL: refusedURL, Hostname: "example.com", Path: "/refused", Port: 8080},
+		{NameID: "denied", UpstreamURL: upstream.URL, Hostname: "example.com", Path: "/denied", Port: 8080,
+			Middlewares: route.Middlewares{IPFilter: ipfilter.Rules{Deny: []string{"192.0.2.0/24"}}},
+			ErrorPages:  errorpage.Config{Pages: []errorpage.Page{{Status: "403", JSON: `{"denied": {{json .Route}}}`}}}},
+	}
+
+	m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+	for _, r := range routes {
+		if err := m.CreateRoute(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	globalPages := errorpage.Config{Pages: []errorpage.Page{{Status: "5xx", JSON: `{"status": {{.Status}}, "route": {{json .Route}}}`}}}
+	if err := globalPages.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	u, err := NewUseCase(m, cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU), 8080, nil, globalPages, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		host           string
+		path           string
+		wantStatusCode int
+		wantBody       string
+	}{
+		{
+			name:           "NoMatchingHost",
+			host:           "unknown.com",
+			path:           "/slow",
+			wantStatusCode: http.StatusMisdirectedRequest,
+		},
+		{
+			name:           "NoMatchingPath",
+			host:           "example.com",
+			path:           "/unknown",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "UpstreamTimeout",
+			host:           "example.com",
+			path:           "/slow",
+			wantStatusCode: http.StatusGatewayTimeout,
+			wantBody:       `{"status": 504, "route": "slow"}`,
+		},
+		{
+			name:           "UpstreamRefused",
+			host:           "example.com",
+			path:           "/refused",
+			wantStatusCode: http.StatusBadGateway,
+			wantBody:       `{"status": 502, "route": "refused"}`,
+		},
+		{
+			name:           "InterceptUpstreamError",
+			host:           "example.com",
+			path:           "/failing",
+			wantStatusCode: http.StatusInternalServerError,
+			wantBody:       `{"status": 500, "route": "failing"}`,
+		},
+		{
+			name:           "IPFilterDenied",
+			host:           "example.com",
+			path:           "/denied",
+			wantStatusCode: http.StatusForbidden,
+			wantBody:       `{"denied": "denied"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Host = tt.host
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			u.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("response code got %d, want %d", w.Code, tt.wantStatusCode)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(w.Body.String()) != tt.wantBody {
+				t.Errorf("response body is %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if strings.Contains(w.Body.String(), "127.0.0.1") || strings.Contains(w.Body.String(), "10.0.0.1") {
+				t.Errorf("response body %q leaks internal addresses", w.Body.String())
+			}
+		})
+	}
+}
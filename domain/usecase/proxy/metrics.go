@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/infra"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestMetrics observes the duration, the body sizes and the in-flight state of a single proxy request
+type requestMetrics struct {
+	labels      prometheus.Labels
+	start       time.Time
+	requestBody *countingReadCloser
+}
+
+func startRequestMetrics(routeName string, port uint16, r *http.Request, start time.Time) *requestMetrics {
+	m := &requestMetrics{
+		labels: infra.RequestLabels(routeName, port, r.Method),
+		start:  start,
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		m.requestBody = &countingReadCloser{ReadCloser: r.Body}
+		r.Body = m.requestBody
+	}
+	infra.RequestsInFlight.With(m.labels).Inc()
+	return m
+}
+
+func (m *requestMetrics) finish(recorder *responseRecorder) {
+	infra.RequestsInFlight.With(m.labels).Dec()
+	infra.RequestDuration.With(m.labels).Observe(time.Since(m.start).Seconds())
+	infra.ResponseSize.With(m.labels).Observe(float64(recorder.bytesWritten))
+
+	var requestSize int64
+	if m.requestBody != nil {
+		requestSize = atomic.LoadInt64(&m.requestBody.bytesRead)
+	}
+	infra.RequestSize.With(m.labels).Observe(float64(requestSize))
+}
+
+// countingReadCloser counts the bytes read from the wrapped io.ReadCloser, the upstream request may still read it when the metrics are finished
+type countingReadCloser struct {
+	io.ReadCloser
+	bytesRead int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(&c.bytesRead, int64(n))
+	return n, err
+}
+
+func withLabel(labels prometheus.Labels, name, value string) prometheus.Labels {
+	extended := make(prometheus.Labels, len(labels)+1)
+	for k, v := range labels {
+		extended[k] = v
+	}
+	extended[name] = value
+	return extended
+}
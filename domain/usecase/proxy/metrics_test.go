@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/infra"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_requestMetrics(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader("hello prox"))
+	recorder := newResponseRecorder(httptest.NewRecorder())
+	labels := infra.RequestLabels("metrics-route", 8080, http.MethodPost)
+
+	m := startRequestMetrics("metrics-route", 8080, r, time.Now())
+	if got := testutil.ToFloat64(infra.RequestsInFlight.With(labels)); got != 1 {
+		t.Errorf("in flight requests = %v, want 1", got)
+	}
+
+	if _, err := ioutil.ReadAll(r.Body); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.Write([]byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+	m.finish(recorder)
+
+	if got := testutil.ToFloat64(infra.RequestsInFlight.With(labels)); got != 0 {
+		t.Errorf("in flight requests = %v, want 0", got)
+	}
+	if m.requestBody.bytesRead != 10 {
+		t.Errorf("request size = %v, want 10", m.requestBody.bytesRead)
+	}
+}
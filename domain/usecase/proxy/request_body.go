@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrorRequestBodyTooLarge is returned by request bodies which exceed the max request body size of the route
+var ErrorRequestBodyTooLarge = errors.New("request body exceeds the max request body size of the route")
+
+// limitedBody fails with ErrorRequestBodyTooLarge as soon as more than the limit was read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func newLimitedBody(body io.ReadCloser, limit int64) *limitedBody {
+	return &limitedBody{ReadCloser: body, remaining: limit}
+}
+
+// Read at most one byte more than the remaining limit to detect bodies which exceed it
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = 0
+		return n, ErrorRequestBodyTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/errorpage"
+)
+
+func Test_httpProxyUseCase_ServeHTTP_MaxRequestBodySize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name                 string
+		bodySize             int
+		unknownLength        bool
+		wantStatusCode       int
+		wantUpstreamRequests int32
+	}{
+		{
+			name:                 "WithinLimit",
+			bodySize:             1e6,
+			wantStatusCode:       http.StatusOK,
+			wantUpstreamRequests: 1,
+		},
+		{
+			name:           "ContentLengthExceedsLimit",
+			bodySize:       1e6 + 1,
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "UnknownLengthExceedsLimit",
+			bodySize:       2e6,
+			unknownLength:  true,
+			wantStatusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var upstreamRequests int32
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := ioutil.ReadAll(r.Body); err != nil {
+					return
+				}
+				atomic.AddInt32(&upstreamRequests, 1)
+			}))
+			defer upstream.Close()
+
+			m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+			if err := m.CreateRoute(context.Background(), &route.Route{NameID: "upload", UpstreamURL: upstream.URL, Hostname: "example.com", Port: 8080, MaxRequestBodySizeInMegaBytes: 1}); err != nil {
+				t.Fatal(err)
+			}
+			u, err := NewUseCase(m, nil, 8080, nil, errorpage.Config{}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "http://example.com/upload", strings.NewReader(strings.Repeat("a", tt.bodySize)))
+			if tt.unknownLength {
+				r.ContentLength = -1
+				r.Body = ioutil.NopCloser(r.Body)
+			}
+			w := httptest.NewRecorder()
+			u.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("status got %d, want %d", w.Code, tt.wantStatusCode)
+			}
+			if got := atomic.LoadInt32(&upstreamRequests); got != tt.wantUpstreamRequests {
+				t.Errorf("upstream requests got %d, want %d", got, tt.wantUpstreamRequests)
+			}
+		})
+	}
+}
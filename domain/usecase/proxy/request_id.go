@@ -0,0 +1,16 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/fwiedmann/prox/internal/modifiers"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestLogger returns a logger which adds the request id of the request to each log entry
+func requestLogger(r *http.Request) *log.Entry {
+	if id := modifiers.RequestIDFromContext(r.Context()); id != "" {
+		return log.WithField("request-id", id)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
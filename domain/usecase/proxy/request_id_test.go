@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/accesslog"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/config"
+	"github.com/fwiedmann/prox/internal/modifiers"
+)
+
+type accessLoggerFunc func(entry accesslog.Entry)
+
+func (f accessLoggerFunc) Log(entry accesslog.Entry) {
+	f(entry)
+}
+
+func Test_httpProxyUseCase_ServeHTTP_RequestID(t *testing.T) {
+	t.Parallel()
+	var logged accesslog.Entry
+	u := &httpProxyUseCase{
+		routerManager: route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute),
+		cache:         cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU),
+		port:          8080,
+		accessLogger: accessLoggerFunc(func(entry accesslog.Entry) {
+			logged = entry
+		}),
+	}
+	handler := modifiers.NewRequestID("X-Request-ID", func() string { return "generated-id" }, false).Inject(u.ServeHTTP)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	if w.Code != http.StatusMisdirectedRequest {
+		t.Errorf("response code got %d, want %d", w.Code, http.StatusMisdirectedRequest)
+	}
+	if !strings.Contains(w.Body.String(), "request-id: generated-id") {
+		t.Errorf("response body %q does not contain the request id", w.Body.String())
+	}
+	if got := w.Header().Get("X-Request-ID"); got != "generated-id" {
+		t.Errorf("response header X-Request-ID is %q, want %q", got, "generated-id")
+	}
+	if logged.RequestID != "generated-id" {
+		t.Errorf("access log entry request id is %q, want %q", logged.RequestID, "generated-id")
+	}
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+	"github.com/fwiedmann/prox/internal/infra"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons to serve a stale response
+const (
+	staleReasonRevalidating = "revalidating"
+	staleReasonError        = "error"
+)
+
+// backgroundRevalidationTimeout limits the upstream request of a background revalidation, including reading its body
+const backgroundRevalidationTimeout = time.Minute
+
+// Warnings of stale responses, see RFC 7234 section 5.5
+var staleWarnings = map[string]string{
+	staleReasonRevalidating: `110 - "Response is Stale"`,
+	staleReasonError:        `111 - "Revalidation Failed"`,
+}
+
+// serveStale returns the stale response with a Warning header for the reason and counts it
+func serveStale(stale *cache.StaleResponse, labels prometheus.Labels, reason string) *http.Response {
+	infra.CacheStaleResponses.With(withLabel(labels, "reason", reason)).Inc()
+	stale.Header.Add("Warning", staleWarnings[reason])
+	return stale.Response
+}
+
+// revalidateInBackground refreshes the stored response with an upstream request which is independent of the client request.
+// Only one background revalidation per resource runs at a time.
+func (rh rootHandler) revalidateInBackground(r *http.Request, staleHeader http.Header) {
+	done, _ := rh.revalidations.join(rh.route, r)
+	if done == nil {
+		return
+	}
+
+	logger := requestLogger(r)
+	cacheRequest := r.Clone(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), backgroundRevalidationTimeout)
+	requestCopy, err := rh.newUpstreamRequest(ctx, r)
+	if err != nil {
+		cancel()
+		done()
+		logger.Errorf("could not apply upstream request modifiers for route \"%s\" error: %s", rh.route.NameID, err)
+		return
+	}
+	// stored responses belong to GET requests, stale responses served to HEAD requests are revalidated with GET
+	cacheRequest.Method = http.MethodGet
+	requestCopy.Method = http.MethodGet
+	validated := cachecontrol.SetValidators(requestCopy, staleHeader)
+
+	go func() {
+		defer done()
+		defer cancel()
+		resp, err := rh.route.GetHTTPClient().Do(requestCopy)
+		if err != nil {
+			logger.Warnf("background revalidation for route \"%s\" failed, error: %s", rh.route.NameID, err)
+			return
+		}
+		removeHopByHopHeaders(resp.Header)
+		rh.route.Middlewares.Compression.Compress(cacheRequest, resp)
+		defer resp.Body.Close()
+
+		if validated && resp.StatusCode == http.StatusNotModified {
+			if refreshed := rh.cache.Refresh(rh.route, cacheRequest, resp); refreshed != nil {
+				refreshed.Body.Close()
+			}
+			return
+		}
+		rh.cache.Save(rh.route, cacheRequest, resp)
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+	}()
+}
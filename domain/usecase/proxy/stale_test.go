@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/config"
+	"github.com/fwiedmann/prox/internal/errorpage"
+)
+
+func Test_httpProxyUseCase_ServeHTTP_Stale(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name              string
+		cacheControl      string
+		staleIfError      string
+		failingStatusCode int
+		closeUpstream     bool
+		wantStatusCode    int
+		wantBody          string
+		wantWarning       string
+		wantRefreshed     bool
+	}{
+		{
+			name:           "WhileRevalidate",
+			cacheControl:   "max-age=0, stale-while-revalidate=60",
+			wantStatusCode: http.StatusOK,
+			wantBody:       "v1",
+			wantWarning:    `110 - "Response is Stale"`,
+			wantRefreshed:  true,
+		},
+		{
+			name:              "IfErrorStatus",
+			cacheControl:      "max-age=0, stale-if-error=60",
+			failingStatusCode: http.StatusServiceUnavailable,
+			wantStatusCode:    http.StatusOK,
+			wantBody:          "v1",
+			wantWarning:       `111 - "Revalidation Failed"`,
+		},
+		{
+			name:           "IfErrorUnreachableRouteOverride",
+			cacheControl:   "max-age=0",
+			staleIfError:   "1m",
+			closeUpstream:  true,
+			wantStatusCode: http.StatusOK,
+			wantBody:       "v1",
+			wantWarning:    `111 - "Revalidation Failed"`,
+		},
+		{
+			name:              "ErrorWithoutStaleIfError",
+			cacheControl:      "max-age=0",
+			failingStatusCode: http.StatusServiceUnavailable,
+			wantStatusCode:    http.StatusServiceUnavailable,
+			wantBody:          "unavailable",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var upstreamRequests int32
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				version := atomic.AddInt32(&upstreamRequests, 1)
+				if version > 1 && tt.failingStatusCode != 0 {
+					w.WriteHeader(tt.failingStatusCode)
+					_, _ = w.Write([]byte("unavailable"))
+					return
+				}
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				_, _ = fmt.Fprintf(w, "v%d", version)
+			}))
+			defer upstream.Close()
+
+			m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+			if err := m.CreateRoute(context.Background(), &route.Route{NameID: "stale", UpstreamURL: upstream.URL, Hostname: "example.com", Port: 8080, CacheEnabled: true, CacheStaleIfError: tt.staleIfError}); err != nil {
+				t.Fatal(err)
+			}
+			c := cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+			defer c.Close()
+			u, err := NewUseCase(m, c, 8080, nil, errorpage.Config{}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			serve := func() *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				u.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+				return w
+			}
+
+			if w := serve(); w.Body.String() != "v1" {
+				t.Fatalf("first response got %q, want %q", w.Body.String(), "v1")
+			}
+			if tt.closeUpstream {
+				upstream.Close()
+			}
+
+			w := serve()
+			if w.Code != tt.wantStatusCode || w.Body.String() != tt.wantBody {
+				t.Errorf("stale response got %d %q, want %d %q", w.Code, w.Body.String(), tt.wantStatusCode, tt.wantBody)
+			}
+			if got := w.Header().Get("Warning"); got != tt.wantWarning {
+				t.Errorf("Warning got %q, want %q", got, tt.wantWarning)
+			}
+
+			if !tt.wantRefreshed {
+				return
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for time.Now().Before(deadline) {
+				if w := serve(); w.Body.String() == "v2" {
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			t.Error("the background revalidation did not refresh the stale response")
+		})
+	}
+}
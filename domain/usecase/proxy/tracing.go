@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/fwiedmann/prox"
+
+// Span attributes added by prox
+const (
+	routeAttributeKey    = attribute.Key("prox.route")
+	portAttributeKey     = attribute.Key("prox.port")
+	cacheHitAttributeKey = attribute.Key("prox.cache.hit")
+)
+
+// startServerSpan continues the trace of the inbound request or starts a new one.
+// The returned request contains the context of the new span.
+func startServerSpan(r *http.Request, port uint16) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := otel.Tracer(tracerName).Start(ctx, fmt.Sprintf("HTTP %s", r.Method),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", "", r)...),
+		trace.WithAttributes(portAttributeKey.Int(int(port))),
+	)
+	return r.WithContext(ctx), span
+}
+
+func annotateRoute(span trace.Span, r *http.Request, route *route.Route) {
+	span.SetName(fmt.Sprintf("HTTP %s %s", r.Method, route.NameID))
+	span.SetAttributes(routeAttributeKey.String(string(route.NameID)))
+}
+
+func endServerSpan(span trace.Span, recorder *responseRecorder) {
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(recorder.statusCode)...)
+	if recorder.statusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(recorder.statusCode))
+	}
+	span.End()
+}
+
+// startClientSpan starts the span for the upstream request and injects its context into the request headers.
+// Upstream requests are not retried, each request has exactly one client span.
+func startClientSpan(r *http.Request) (*http.Request, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(r.Context(), fmt.Sprintf("HTTP %s", r.Method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(r)...),
+	)
+	r = r.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	return r, span
+}
+
+func endClientSpan(span trace.Span, resp *http.Response, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return
+	}
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(resp.StatusCode)...)
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode))
+	span.End()
+}
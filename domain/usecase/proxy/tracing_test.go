@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func Test_httpProxyUseCase_ServeHTTP_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	}()
+
+	var upstreamTraceParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceParent = r.Header.Get("traceparent")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+	if err := m.CreateRoute(context.Background(), &route.Route{
+		NameID:       "tracing-route",
+		CacheEnabled: true,
+		UpstreamURL:  upstream.URL,
+		Port:         8080,
+		Path:         "/hello",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	u := &httpProxyUseCase{routerManager: m, cache: cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU), port: 8080}
+
+	const inboundTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	r := httptest.NewRequest(http.MethodGet, "/hello", nil)
+	r.Header.Set("traceparent", "00-"+inboundTraceID+"-00f067aa0ba902b7-01")
+	u.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d ended spans, want 2", len(spans))
+	}
+	clientSpan, serverSpan := spans[0], spans[1]
+
+	if serverSpan.SpanKind() != trace.SpanKindServer || clientSpan.SpanKind() != trace.SpanKindClient {
+		t.Errorf("got span kinds %s and %s, want client and server", clientSpan.SpanKind(), serverSpan.SpanKind())
+	}
+	if serverSpan.SpanContext().TraceID().String() != inboundTraceID {
+		t.Errorf("server span trace id is %s, want %s", serverSpan.SpanContext().TraceID(), inboundTraceID)
+	}
+	if clientSpan.Parent().SpanID() != serverSpan.SpanContext().SpanID() {
+		t.Errorf("client span parent is %s, want server span %s", clientSpan.Parent().SpanID(), serverSpan.SpanContext().SpanID())
+	}
+	if serverSpan.Name() != "HTTP GET tracing-route" {
+		t.Errorf("server span name is %s, want %s", serverSpan.Name(), "HTTP GET tracing-route")
+	}
+
+	wantAttributes := map[string]string{
+		string(routeAttributeKey):    "tracing-route",
+		string(cacheHitAttributeKey): "false",
+	}
+	for _, attr := range serverSpan.Attributes() {
+		if want, ok := wantAttributes[string(attr.Key)]; ok {
+			if got := attr.Value.Emit(); got != want {
+				t.Errorf("server span attribute %s is %s, want %s", attr.Key, got, want)
+			}
+			delete(wantAttributes, string(attr.Key))
+		}
+	}
+	if len(wantAttributes) != 0 {
+		t.Errorf("server span is missing the attributes %v", wantAttributes)
+	}
+
+	wantTraceParent := "00-" + inboundTraceID + "-" + clientSpan.SpanContext().SpanID().String() + "-01"
+	if upstreamTraceParent != wantTraceParent {
+		t.Errorf("upstream traceparent header is %s, want %s", upstreamTraceParent, wantTraceParent)
+	}
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/fwiedmann/prox/internal/infra"
+	"github.com/fwiedmann/prox/internal/server"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StatusClientClosedRequest is used for requests which were cancelled by the client before the upstream responded
+const StatusClientClosedRequest = 499
+
+// UpstreamErrorReason classifies failed upstream requests
+type UpstreamErrorReason string
+
+// Reasons of failed upstream requests
+const (
+	UpstreamErrorClientCanceled    UpstreamErrorReason = "client_canceled"
+	UpstreamErrorTimeout           UpstreamErrorReason = "timeout"
+	UpstreamErrorDNS               UpstreamErrorReason = "dns"
+	UpstreamErrorTLS               UpstreamErrorReason = "tls"
+	UpstreamErrorConnectionRefused UpstreamErrorReason = "connection_refused"
+	UpstreamErrorUnreachable       UpstreamErrorReason = "unreachable"
+	UpstreamErrorConnectionReset   UpstreamErrorReason = "connection_reset"
+	UpstreamErrorUnknown           UpstreamErrorReason = "unknown"
+	UpstreamErrorRequestTooLarge   UpstreamErrorReason = "request_body_too_large"
+	UpstreamErrorSlowClient        UpstreamErrorReason = "slow_client"
+)
+
+// classifyUpstreamError returns the reason of the failed upstream request. The context of the client request is
+// used to distinguish requests cancelled by the client and slow clients from other cancellations.
+func classifyUpstreamError(clientCtx context.Context, err error) UpstreamErrorReason {
+	if errors.Is(err, ErrorRequestBodyTooLarge) {
+		return UpstreamErrorRequestTooLarge
+	}
+
+	// the context of the client request is cancelled once its body could not be read in time
+	if server.IsMinTransferRateExceeded(clientCtx) {
+		return UpstreamErrorSlowClient
+	}
+
+	if errors.Is(clientCtx.Err(), context.Canceled) {
+		return UpstreamErrorClientCanceled
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return UpstreamErrorTimeout
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return UpstreamErrorDNS
+	}
+
+	if isTLSError(err) {
+		return UpstreamErrorTLS
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return UpstreamErrorConnectionRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return UpstreamErrorUnreachable
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return UpstreamErrorConnectionReset
+	default:
+		return UpstreamErrorUnknown
+	}
+}
+
+func isTLSError(err error) bool {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var recordHeaderErr tls.RecordHeaderError
+	if errors.As(err, &unknownAuthorityErr) || errors.As(err, &certificateInvalidErr) || errors.As(err, &hostnameErr) || errors.As(err, &recordHeaderErr) {
+		return true
+	}
+	// alerts of the tls handshake are not exported as error types
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// isCausedByClient reports if the request failed because of the client instead of the upstream
+func (reason UpstreamErrorReason) isCausedByClient() bool {
+	switch reason {
+	case UpstreamErrorClientCanceled, UpstreamErrorRequestTooLarge, UpstreamErrorSlowClient:
+		return true
+	default:
+		return false
+	}
+}
+
+// status returns the status code and message for the client
+func (reason UpstreamErrorReason) status() (int, string) {
+	switch reason {
+	case UpstreamErrorClientCanceled:
+		return StatusClientClosedRequest, "client closed the request"
+	case UpstreamErrorTimeout:
+		return http.StatusGatewayTimeout, "upstream request timed out"
+	case UpstreamErrorUnreachable:
+		return http.StatusServiceUnavailable, "upstream is unavailable"
+	case UpstreamErrorDNS:
+		return http.StatusBadGateway, "upstream host could not be resolved"
+	case UpstreamErrorTLS:
+		return http.StatusBadGateway, "tls handshake with the upstream failed"
+	case UpstreamErrorConnectionRefused:
+		return http.StatusBadGateway, "upstream is not reachable"
+	case UpstreamErrorRequestTooLarge:
+		return http.StatusRequestEntityTooLarge, "request body is too large"
+	case UpstreamErrorSlowClient:
+		return http.StatusRequestTimeout, "request body was sent too slowly"
+	default:
+		return http.StatusBadGateway, "upstream request failed"
+	}
+}
+
+// recordUpstreamError classifies, logs and counts a failed upstream request
+func (rh rootHandler) recordUpstreamError(r *http.Request, labels prometheus.Labels, err error) UpstreamErrorReason {
+	reason := classifyUpstreamError(r.Context(), err)
+	setUpstreamErrorReason(r.Context(), reason)
+	infra.UpstreamErrors.With(withLabel(labels, "reason", string(reason))).Inc()
+
+	switch reason {
+	case UpstreamErrorRequestTooLarge, UpstreamErrorSlowClient:
+		requestLogger(r).Warnf("request for route \"%s\" was rejected with reason %s, error: %s", rh.route.NameID, reason, err)
+	case UpstreamErrorClientCanceled:
+		requestLogger(r).Warnf("client closed the request before the upstream of route \"%s\" responded, error: %s", rh.route.NameID, err)
+	default:
+		requestLogger(r).Errorf("upstream request for route \"%s\" failed with reason %s, error: %s", rh.route.NameID, reason, err)
+	}
+	return reason
+}
+
+// answerUpstreamError writes the error response for the reason of a failed upstream request
+func (rh rootHandler) answerUpstreamError(rw http.ResponseWriter, r *http.Request, reason UpstreamErrorReason) {
+	status, message := reason.status()
+	if reason == UpstreamErrorClientCanceled {
+		rw.WriteHeader(status)
+		return
+	}
+	rh.writeError(rw, r, status, message)
+}
@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/accesslog"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/config"
+	"github.com/fwiedmann/prox/internal/errorpage"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func dialError(errno syscall.Errno) error {
+	return &url.Error{Op: "Get", URL: "http://upstream", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}}
+}
+
+func Test_classifyUpstreamError(t *testing.T) {
+	t.Parallel()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		clientCtx  context.Context
+		err        error
+		want       UpstreamErrorReason
+		wantStatus int
+	}{
+		{
+			name:       "ClientCanceled",
+			clientCtx:  canceled,
+			err:        &url.Error{Op: "Get", URL: "http://upstream", Err: context.Canceled},
+			want:       UpstreamErrorClientCanceled,
+			wantStatus: StatusClientClosedRequest,
+		},
+		{
+			name:       "Timeout",
+			err:        &url.Error{Op: "Get", URL: "http://upstream", Err: &net.OpError{Op: "dial", Err: timeoutError{}}},
+			want:       UpstreamErrorTimeout,
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "DeadlineExceeded",
+			err:        fmt.Errorf("get: %w", context.DeadlineExceeded),
+			want:       UpstreamErrorTimeout,
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "DNS",
+			err:        &url.Error{Op: "Get", URL: "http://upstream", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "upstream", IsNotFound: true}}},
+			want:       UpstreamErrorDNS,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "TLSUnknownAuthority",
+			err:        &url.Error{Op: "Get", URL: "https://upstream", Err: x509.UnknownAuthorityError{}},
+			want:       UpstreamErrorTLS,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "TLSAlert",
+			err:        &url.Error{Op: "Get", URL: "https://upstream", Err: errors.New("remote error: tls: handshake failure")},
+			want:       UpstreamErrorTLS,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "ConnectionRefused",
+			err:        dialError(syscall.ECONNREFUSED),
+			want:       UpstreamErrorConnectionRefused,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "Unreachable",
+			err:        dialError(syscall.EHOSTUNREACH),
+			want:       UpstreamErrorUnreachable,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "ConnectionReset",
+			err:        &url.Error{Op: "Get", URL: "http://upstream", Err: io.EOF},
+			want:       UpstreamErrorConnectionReset,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "Unknown",
+			err:        errors.New("something went wrong"),
+			want:       UpstreamErrorUnknown,
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.clientCtx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			got := classifyUpstreamError(ctx, tt.err)
+			if got != tt.want {
+				t.Errorf("classifyUpstreamError() = %v, want %v", got, tt.want)
+			}
+			if status, _ := got.status(); status != tt.wantStatus {
+				t.Errorf("status() = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_httpProxyUseCase_ServeHTTP_ClientCanceled(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+	if err := m.CreateRoute(context.Background(), &route.Route{NameID: "canceled", UpstreamURL: upstream.URL, Hostname: "example.com", Path: "/canceled", Port: 8080}); err != nil {
+		t.Fatal(err)
+	}
+
+	var logged accesslog.Entry
+	u, err := NewUseCase(m, cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU), 8080, accessLoggerFunc(func(entry accesslog.Entry) {
+		logged = entry
+	}), errorpage.Config{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	w := httptest.NewRecorder()
+	u.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/canceled", nil).WithContext(ctx))
+
+	if w.Code != StatusClientClosedRequest {
+		t.Errorf("response code got %d, want %d", w.Code, StatusClientClosedRequest)
+	}
+	if logged.StatusCode != StatusClientClosedRequest || logged.UpstreamError != string(UpstreamErrorClientCanceled) {
+		t.Errorf("access log entry has status %d and reason %q, want %d and %q", logged.StatusCode, logged.UpstreamError, StatusClientClosedRequest, UpstreamErrorClientCanceled)
+	}
+}
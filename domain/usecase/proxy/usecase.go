@@ -3,7 +3,6 @@ package proxy
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"reflect"
@@ -11,15 +10,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/fwiedmann/prox/internal/accesslog"
+	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+	"github.com/fwiedmann/prox/internal/errorpage"
 	"github.com/fwiedmann/prox/internal/infra"
+	"github.com/fwiedmann/prox/internal/modifiers"
 
-	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/fwiedmann/prox/domain/entity/route"
 )
 
 var (
 	ErrorNoMatchingRoute           = errors.New("no matching route found")
+	ErrorNoMatchingHost            = errors.New("no route found for the requested host")
 	ErrorStatusNotFound            = errors.New("404 - Not Found")
 	ErrorStatusInternalServerError = errors.New("500 - Internal Server Error")
 	ErrInvalidCacheInterfaceValue  = errors.New("cache is not allowed to be nil or a pointer")
@@ -28,59 +33,127 @@ var (
 
 // Cache defines a API for caching *http.Response
 type Cache interface {
+	// Get returns a stored response which is fresh for the request or nil
 	Get(route route.Route, request *http.Request) *http.Response
+	// GetStale returns a stored response which has to be revalidated before it can be served or nil.
+	// The stale response tells if it can be served while it is revalidated or if the revalidation fails.
+	GetStale(route route.Route, request *http.Request) *cache.StaleResponse
+	// Save stores the response, if it is cacheable. The cache may replace the body of the response to store it while it is read,
+	// the body has to be read completely and closed afterwards.
 	Save(route route.Route, request *http.Request, response *http.Response)
+	// Refresh updates the stored response with the headers of a 304 Not Modified revalidation response and returns it, nil if there is no stored response
+	Refresh(route route.Route, request *http.Request, notModified *http.Response) *http.Response
 }
 
 type httpProxyUseCase struct {
-	routerManager    route.Router
-	cache            Cache
-	port             uint16
-	accessLogEnabled bool
+	routerManager     route.Router
+	cache             Cache
+	port              uint16
+	accessLogger      AccessLogger
+	errorPages        errorpage.Config
+	flights           *flightGroup
+	revalidations     *flightGroup
+	coalescingTimeout time.Duration
+	portMiddlewares   []route.Middleware
 }
 
-// NewUseCase creates a new proxy UseCase
-func NewUseCase(manager route.Router, cache Cache, port uint16, accessLogEnabled bool) (UseCase, error) {
+// NewUseCase creates a new proxy UseCase. The accessLogger is optional, if nil no access log will be written.
+// The errorPages are used for all routes, pages configured by a route take precedence.
+// Concurrent cache misses of the same resource wait up to the coalescingTimeout for the first request to fill the cache, zero disables the coalescing.
+// The portMiddlewares, like the ip filter of the port, are applied to all requests before the middlewares of the route.
+func NewUseCase(manager route.Router, cache Cache, port uint16, accessLogger AccessLogger, errorPages errorpage.Config, coalescingTimeout time.Duration, portMiddlewares ...route.Middleware) (UseCase, error) {
 	if reflect.ValueOf(cache).Kind() == reflect.Ptr && reflect.ValueOf(cache).IsNil() {
 		return nil, ErrInvalidCacheInterfaceValue
 	}
 
-	return &httpProxyUseCase{
-		routerManager:    manager,
-		cache:            cache,
-		port:             port,
-		accessLogEnabled: accessLogEnabled,
-	}, nil
+	u := &httpProxyUseCase{
+		routerManager:     manager,
+		cache:             cache,
+		port:              port,
+		accessLogger:      accessLogger,
+		errorPages:        errorPages,
+		revalidations:     newFlightGroup(),
+		coalescingTimeout: coalescingTimeout,
+		portMiddlewares:   portMiddlewares,
+	}
+	if coalescingTimeout > 0 {
+		u.flights = newFlightGroup()
+	}
+	return u, nil
 }
 
 // ServeHTTP is the entrypoint for each incoming proxy request
 func (u *httpProxyUseCase) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
-	if u.accessLogEnabled {
-		log.WithFields(log.Fields{"ACCESS LOG": fmt.Sprintf("ACCESS %d", u.port)}).Infof("%+v", *r)
+	recorder := newResponseRecorder(rw)
+	entry := accesslog.Entry{StartTime: time.Now(), Request: r, Port: u.port, RequestID: modifiers.RequestIDFromContext(r.Context())}
+	r, details := withRequestDetails(r)
+	defer func() {
+		entry.UpstreamError = string(details.upstreamErrorReason)
+		u.logAccess(entry, recorder)
+	}()
+
+	r, span := startServerSpan(r, u.port)
+	defer endServerSpan(span, recorder)
+
+	route, err := RouteForRequest(u.routerManager, u.port, r)
+	if err != nil {
+		status := http.StatusNotFound
+		if errors.Is(err, ErrorNoMatchingHost) {
+			status = http.StatusMisdirectedRequest
+		}
+		// the port middlewares answer denied clients before they learn which routes exist
+		chainMiddlewares(func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, r, status, err.Error(), "", u.errorPages)
+		}, u.portMiddlewares...).ServeHTTP(recorder, errorpage.WithConfigs(r, "", u.errorPages))
+		return
 	}
+	entry.Route = string(route.NameID)
+	annotateRoute(span, r, route)
 
-	route, err := u.getRouteForRequest(r)
-	if err != nil {
-		http.Error(rw, ErrorStatusNotFound.Error(), http.StatusNotFound)
+	metrics := startRequestMetrics(string(route.NameID), u.port, r, entry.StartTime)
+	defer metrics.finish(recorder)
+
+	r = errorpage.WithConfigs(r, string(route.NameID), route.ErrorPages, u.errorPages)
+	// the full slice expression lets append copy the port middlewares instead of sharing them between requests
+	middlewares := append(u.portMiddlewares[:len(u.portMiddlewares):len(u.portMiddlewares)], route.GetClientRequestModifiers()...)
+	chainMiddlewares(rootHandler{route: *route, cache: u.cache, errorPages: u.errorPages, flights: u.flights, revalidations: u.revalidations, coalescingTimeout: u.coalescingTimeout}.ServeHTTP, middlewares...).ServeHTTP(recorder, r)
+}
+
+func (u *httpProxyUseCase) logAccess(entry accesslog.Entry, recorder *responseRecorder) {
+	if u.accessLogger == nil {
 		return
 	}
-	chainMiddlewares(rootHandler{route: *route, cache: u.cache}.ServeHTTP, route.GetClientRequestModifiers()...).ServeHTTP(rw, r)
+	entry.Duration = time.Since(entry.StartTime)
+	entry.StatusCode = recorder.statusCode
+	entry.BytesWritten = recorder.bytesWritten
+	u.accessLogger.Log(entry)
 }
 
-func (u *httpProxyUseCase) getRouteForRequest(r *http.Request) (*route.Route, error) {
-	routes, err := u.routerManager.ListRoutes(r.Context())
+// RouteForRequest returns the route of the port with the highest priority which matches the host and the path of the request
+func RouteForRequest(router route.Router, port uint16, r *http.Request) (*route.Route, error) {
+	routes, err := router.ListRoutes(r.Context())
 	if err != nil {
 		return nil, err
 	}
 
 	routeMatches := make([]*route.Route, 0)
+	host := strings.Split(r.Host, ":")[0]
+	var hostMatched bool
 
 	for _, route := range routes {
-		if u.isRouteValidForRequest(route, strings.Split(r.Host, ":")[0], r.RequestURI) {
+		if port != route.Port || !route.IsHostnameMatching(host) {
+			continue
+		}
+		hostMatched = true
+		if route.IsPathMatching(r.RequestURI) {
 			routeMatches = append(routeMatches, route)
 		}
 	}
 
+	if !hostMatched {
+		return nil, ErrorNoMatchingHost
+	}
+
 	if len(routeMatches) == 0 {
 		return nil, ErrorNoMatchingRoute
 	}
@@ -92,71 +165,145 @@ func (u *httpProxyUseCase) getRouteForRequest(r *http.Request) (*route.Route, er
 	return routeMatches[0], nil
 }
 
-func (u *httpProxyUseCase) isRouteValidForRequest(r *route.Route, host, path string) bool {
-	if u.port != r.Port {
-		return false
-	}
-	return r.IsHostnameMatching(host) && r.IsPathMatching(path)
-}
-
 type rootHandler struct {
-	route route.Route
-	cache Cache
+	route             route.Route
+	cache             Cache
+	errorPages        errorpage.Config
+	flights           *flightGroup
+	revalidations     *flightGroup
+	coalescingTimeout time.Duration
 }
 
 // ServeHTTP is the main proxy handler
 func (rh rootHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	labels := infra.RequestLabels(string(rh.route.NameID), rh.route.Port, r.Method)
+	if limit := rh.route.GetMaxRequestBodySizeInBytes(); limit != -1 && r.Body != nil && r.Body != http.NoBody {
+		if r.ContentLength > limit {
+			rh.writeError(rw, r, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+		r.Body = newLimitedBody(r.Body, limit)
+	}
+
 	var resp *http.Response
-	if rh.route.CacheEnabled {
+	var stale *cache.StaleResponse
+	var fromCache, validated bool
+	if rh.route.CacheEnabled && rh.route.IsCacheableMethod(r.Method) {
 		resp = rh.cache.Get(rh.route, r)
+		fromCache = resp != nil
+		trace.SpanFromContext(r.Context()).SetAttributes(cacheHitAttributeKey.Bool(fromCache))
+		if fromCache {
+			infra.CacheHits.With(labels).Inc()
+			defer resp.Body.Close()
+		} else {
+			infra.CacheMisses.With(labels).Inc()
+			if stale = rh.cache.GetStale(rh.route, r); stale != nil {
+				defer stale.Body.Close()
+			}
+		}
+	}
+
+	if stale != nil && stale.WhileRevalidate {
+		rh.revalidateInBackground(r, stale.Header)
+		resp = serveStale(stale, labels, staleReasonRevalidating)
+		fromCache = true
+	}
+
+	if resp == nil && rh.route.CacheEnabled && rh.flights != nil && r.Method == http.MethodGet {
+		var done func()
+		resp, done = rh.coalesce(r, labels)
+		if done != nil {
+			defer done()
+		}
+		if resp != nil {
+			fromCache = true
+			defer resp.Body.Close()
+		}
 	}
 
-	stopChan := make(chan struct{})
 	if resp == nil {
-		requestCopy := r.Clone(r.Context())
-		if err := applyUpstreamModifiers(requestCopy, rh.route); err != nil {
-			http.Error(rw, ErrorStatusInternalServerError.Error(), http.StatusInternalServerError)
-			log.Errorf("could not apply upstream request modifiers for route \"%s\" error: %s", rh.route.NameID, err)
+		requestCopy, err := rh.newUpstreamRequest(r.Context(), r)
+		if err != nil {
+			rh.writeError(rw, r, http.StatusInternalServerError, "")
+			requestLogger(r).Errorf("could not apply upstream request modifiers for route \"%s\" error: %s", rh.route.NameID, err)
 			return
 		}
+		validated = stale != nil && cachecontrol.SetValidators(requestCopy, stale.Header)
 
-		removeHopByHopHeaders(requestCopy.Header)
-		configureRequestForUpstream(requestCopy, rh.route)
+		requestCopy, clientSpan := startClientSpan(requestCopy)
 
 		var respErr error
+		upstreamStart := time.Now()
 		resp, respErr = rh.route.GetHTTPClient().Do(requestCopy)
+		infra.UpstreamDuration.With(labels).Observe(time.Since(upstreamStart).Seconds())
+		endClientSpan(clientSpan, resp, respErr)
 		if respErr != nil {
-			http.Error(rw, respErr.Error(), http.StatusInternalServerError)
-			log.Errorf("upstream request error for route \"%s\" error: %v", rh.route.NameID, resp)
-			return
-		}
-		defer resp.Body.Close()
-
-		removeHopByHopHeaders(resp.Header)
-
-		if rh.route.CacheEnabled {
-			rh.cache.Save(rh.route, r, resp)
+			reason := rh.recordUpstreamError(r, labels, respErr)
+			if stale == nil || !stale.IfError || reason.isCausedByClient() {
+				rh.answerUpstreamError(rw, r, reason)
+				return
+			}
+			resp = serveStale(stale, labels, staleReasonError)
+			fromCache = true
+		} else {
+			removeHopByHopHeaders(resp.Header)
+			rh.route.Middlewares.Compression.Compress(r, resp)
+			defer resp.Body.Close()
+
+			switch {
+			case resp.StatusCode >= http.StatusInternalServerError && stale != nil && stale.IfError:
+				requestLogger(r).Warnf("upstream of route \"%s\" responded with status %d, serving a stale response", rh.route.NameID, resp.StatusCode)
+				resp = serveStale(stale, labels, staleReasonError)
+				fromCache = true
+			case resp.StatusCode >= http.StatusInternalServerError && rh.interceptUpstreamErrors():
+				updateMetric(rh.route, resp)
+				rh.writeError(rw, r, resp.StatusCode, "")
+				return
+			case validated && resp.StatusCode == http.StatusNotModified:
+				resp = rh.revalidated(r, stale.Response, resp)
+				defer resp.Body.Close()
+				fromCache = true
+			case rh.route.CacheEnabled:
+				rh.cache.Save(rh.route, r, resp)
+				defer resp.Body.Close()
+			}
 		}
+	}
 
+	if (fromCache || validated) && resp.StatusCode == http.StatusOK && cachecontrol.IsNotModified(r, resp.Header) {
+		resp = notModifiedResponse(resp)
 	}
 
 	if err := applyDownstreamModifiers(r.Context(), rw, resp, rh.route); err != nil {
-		http.Error(rw, ErrorStatusInternalServerError.Error(), http.StatusInternalServerError)
-		log.Errorf("could not down upstream request modifiers for route \"%s\" error: %s", rh.route.NameID, err)
+		rh.writeError(rw, r, http.StatusInternalServerError, "")
+		requestLogger(r).Errorf("could not down upstream request modifiers for route \"%s\" error: %s", rh.route.NameID, err)
 		return
 	}
-	configureHeadersForClientFromResponseHeaders(rw.Header(), resp.Header)
+	configureHeadersForClientFromResponseHeaders(rw.Header(), resp.Header, rh.route.PreserveUpstreamCacheHeaders)
+
+	updateMetric(rh.route, resp)
+	rw.WriteHeader(resp.StatusCode)
 
+	// the header has to be written before the first flush, otherwise it would be sent with the status 200
+	stopChan := make(chan struct{})
+	defer close(stopChan)
 	if isRespIsBuffered(resp.TransferEncoding) {
 		go flushResponse(stopChan, rw)
 	}
-
-	updateMetric(rh.route, resp)
-	rw.WriteHeader(resp.StatusCode)
 	if _, err := io.Copy(rw, resp.Body); err != nil {
-		log.Error(err)
+		requestLogger(r).Error(err)
 	}
-	close(stopChan)
+}
+
+// newUpstreamRequest creates the request to the upstream of the route from the client request
+func (rh rootHandler) newUpstreamRequest(ctx context.Context, r *http.Request) (*http.Request, error) {
+	requestCopy := r.Clone(ctx)
+	if err := applyUpstreamModifiers(requestCopy, rh.route); err != nil {
+		return nil, err
+	}
+	removeHopByHopHeaders(requestCopy.Header)
+	configureRequestForUpstream(requestCopy, rh.route)
+	return requestCopy, nil
 }
 
 func applyUpstreamModifiers(r *http.Request, route route.Route) error {
@@ -190,13 +337,38 @@ func configureRequestForUpstream(request *http.Request, route route.Route) {
 	request.RequestURI = ""
 }
 
-func configureHeadersForClientFromResponseHeaders(clientResponseHeader, upstreamResponseHeader http.Header) {
+func configureHeadersForClientFromResponseHeaders(clientResponseHeader, upstreamResponseHeader http.Header, preserveCacheHeaders bool) {
 	for key, headerValues := range upstreamResponseHeader {
 		for _, value := range headerValues {
 			clientResponseHeader.Add(key, value)
 		}
 	}
-	clientResponseHeader.Set("cache-control", "max-age=0, private, must-revalidate, no-store")
+	if !preserveCacheHeaders {
+		clientResponseHeader.Set("cache-control", "max-age=0, private, must-revalidate, no-store")
+	}
+}
+
+// revalidated returns the stored response updated by the 304 Not Modified response of the upstream
+func (rh rootHandler) revalidated(r *http.Request, stale, notModified *http.Response) *http.Response {
+	if refreshed := rh.cache.Refresh(rh.route, r, notModified); refreshed != nil {
+		return refreshed
+	}
+	for name, values := range notModified.Header {
+		if name != "Content-Length" {
+			stale.Header[name] = values
+		}
+	}
+	return stale
+}
+
+// notModifiedResponse answers a conditional client request which matches the validators of the response
+func notModifiedResponse(resp *http.Response) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusNotModified,
+		Status:     http.StatusText(http.StatusNotModified),
+		Header:     cachecontrol.NotModifiedHeader(resp.Header),
+		Body:       http.NoBody,
+	}
 }
 
 func chainMiddlewares(rootHandler http.HandlerFunc, middlewares ...route.Middleware) http.HandlerFunc {
@@ -212,6 +384,7 @@ func chainMiddlewares(rootHandler http.HandlerFunc, middlewares ...route.Middlew
 
 func flushResponse(c <-chan struct{}, rw http.ResponseWriter) {
 	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
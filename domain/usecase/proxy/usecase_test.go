@@ -9,9 +9,16 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/fwiedmann/prox/internal/accesslog"
 	"github.com/fwiedmann/prox/internal/cache"
+	"github.com/fwiedmann/prox/internal/config"
+	"github.com/fwiedmann/prox/internal/cors"
+	"github.com/fwiedmann/prox/internal/errorpage"
+	"github.com/fwiedmann/prox/internal/ipfilter"
+	"github.com/fwiedmann/prox/internal/securityheaders"
 
 	"github.com/fwiedmann/prox/domain/entity/route"
 )
@@ -70,7 +77,7 @@ func Test_httpProxyUseCase_ServeHTTP(t *testing.T) {
 				}},
 			},
 			fields: fields{
-				cache:            cache.NewHTTPInMemoryCache(-1),
+				cache:            cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU),
 				createHTTPClient: clientCreator{body: []byte("ok"), header: map[string][]string{"test": {"test"}}, respCode: 200}.CreateFakeHTTPClient,
 			},
 			wantStatusCode: 200,
@@ -124,3 +131,150 @@ func Test_httpProxyUseCase_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func Test_httpProxyUseCase_ServeHTTP_CORS(t *testing.T) {
+	t.Parallel()
+	var upstreamRequests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamRequests, 1)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+	middlewares := route.Middlewares{CORS: cors.Config{Enabled: true, AllowedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{http.MethodGet, http.MethodPut}}}
+	if err := m.CreateRoute(context.Background(), &route.Route{NameID: "cors", UpstreamURL: upstream.URL, Hostname: "example.com", Port: 8080, Middlewares: middlewares}); err != nil {
+		t.Fatal(err)
+	}
+	u, err := NewUseCase(m, cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU), 8080, nil, errorpage.Config{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preflight := httptest.NewRequest(http.MethodOptions, "http://example.com/", nil)
+	preflight.Header.Set("Origin", "https://app.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	w := httptest.NewRecorder()
+	u.ServeHTTP(w, preflight)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") != "GET, PUT" {
+		t.Errorf("preflight got %d with methods %q, want %d with methods %q", w.Code, w.Header().Get("Access-Control-Allow-Methods"), http.StatusNoContent, "GET, PUT")
+	}
+	if got := atomic.LoadInt32(&upstreamRequests); got != 0 {
+		t.Errorf("upstream requests after the preflight got %d, want 0", got)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	u.ServeHTTP(w, r)
+	if got := w.Header().Values("Access-Control-Allow-Origin"); len(got) != 1 || got[0] != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin got %q, want %q", got, "https://app.example.com")
+	}
+	if w.Body.String() != "ok" {
+		t.Errorf("body got %q, want %q", w.Body.String(), "ok")
+	}
+}
+
+func Test_httpProxyUseCase_ServeHTTP_SecurityHeaders(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.19.0")
+		w.Header().Set("X-Powered-By", "PHP/7.4")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name        string
+		config      securityheaders.Config
+		wantProxy   string
+		wantServer  string
+		wantNosniff string
+	}{
+		{
+			name:       "Disabled",
+			wantProxy:  "true",
+			wantServer: "nginx/1.19.0",
+		},
+		{
+			name:        "Enabled",
+			config:      securityheaders.Config{Enabled: true, ContentTypeNosniff: true, StripIdentifyingHeaders: true, DisableProxyHeader: true},
+			wantNosniff: "nosniff",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+			middlewares := route.Middlewares{SecurityHeaders: tt.config}
+			if err := m.CreateRoute(context.Background(), &route.Route{NameID: "security", UpstreamURL: upstream.URL, Hostname: "example.com", Port: 8080, Middlewares: middlewares}); err != nil {
+				t.Fatal(err)
+			}
+			u, err := NewUseCase(m, cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU), 8080, nil, errorpage.Config{}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			u.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+			if got := w.Header().Get("x-hit-by-prox"); got != tt.wantProxy {
+				t.Errorf("x-hit-by-prox got %q, want %q", got, tt.wantProxy)
+			}
+			if got := w.Header().Get("Server"); got != tt.wantServer {
+				t.Errorf("Server got %q, want %q", got, tt.wantServer)
+			}
+			if got := w.Header().Get("X-Content-Type-Options"); got != tt.wantNosniff {
+				t.Errorf("X-Content-Type-Options got %q, want %q", got, tt.wantNosniff)
+			}
+		})
+	}
+}
+
+func Test_httpProxyUseCase_ServeHTTP_PortMiddlewares(t *testing.T) {
+	t.Parallel()
+	m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+	if err := m.CreateRoute(context.Background(), &route.Route{NameID: "filtered", UpstreamURL: "http://127.0.0.1:1", Hostname: "example.com", Port: 8080}); err != nil {
+		t.Fatal(err)
+	}
+	rules := ipfilter.Rules{Deny: []string{"192.0.2.0/24"}}
+	if err := rules.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := ipfilter.NewFilter(rules, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		host      string
+		wantRoute string
+	}{
+		{name: "MatchingRoute", host: "example.com", wantRoute: "filtered"},
+		{name: "UnknownHost", host: "unknown.example.com"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var logged accesslog.Entry
+			logger := accessLoggerFunc(func(entry accesslog.Entry) {
+				logged = entry
+			})
+			u, err := NewUseCase(m, cache.NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU), 8080, logger, errorpage.Config{}, 0, filter.Inject)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			u.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/", nil))
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("response code got %d, want %d", w.Code, http.StatusForbidden)
+			}
+			if logged.StatusCode != http.StatusForbidden || logged.Route != tt.wantRoute {
+				t.Errorf("access log entry got status %d of route %q, want status %d of route %q", logged.StatusCode, logged.Route, http.StatusForbidden, tt.wantRoute)
+			}
+		})
+	}
+}
@@ -3,11 +3,21 @@ module github.com/fwiedmann/prox
 go 1.15
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/antonfisher/nested-logrus-formatter v1.2.0
 	github.com/ghodss/yaml v1.0.0
+	github.com/klauspost/compress v1.13.6
 	github.com/pkg/errors v0.8.1
 	github.com/prometheus/client_golang v1.7.1
 	github.com/sirupsen/logrus v1.6.0
 	github.com/spf13/cobra v1.0.0
+	go.opentelemetry.io/contrib/propagators/b3 v1.0.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	go.opentelemetry.io/proto/otlp v0.9.0
+	golang.org/x/crypto v0.0.0-20201016220609-9e8e0b390897
+	google.golang.org/protobuf v1.27.1
 	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,20 @@
+package accesslog
+
+import (
+	"net/http"
+	"time"
+)
+
+// Entry contains the information of a completed proxy request
+type Entry struct {
+	StartTime    time.Time
+	Duration     time.Duration
+	Request      *http.Request
+	RequestID    string
+	Port         uint16
+	Route        string
+	StatusCode   int
+	BytesWritten int64
+	// UpstreamError is the reason of a failed upstream request
+	UpstreamError string
+}
@@ -0,0 +1,267 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const redactedHeaderValue = "REDACTED"
+const commonLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// Record contains the fields of an access log line. The fields can be used in access log templates.
+type Record struct {
+	Time          time.Time
+	RequestID     string
+	RemoteAddr    string
+	User          string
+	Method        string
+	URI           string
+	Protocol      string
+	Host          string
+	Status        int
+	Bytes         int64
+	Duration      time.Duration
+	Route         string
+	Port          uint16
+	Referer       string
+	UserAgent     string
+	Headers       map[string]string
+	UpstreamError string
+}
+
+// Logger writes the access log entries of completed proxy requests to the configured output
+type Logger struct {
+	format     string
+	template   *template.Template
+	fields     map[string]struct{}
+	headers    []string
+	redact     map[string]struct{}
+	sampleRate float64
+	random     *rand.Rand
+	output     io.WriteCloser
+	mtx        sync.Mutex
+}
+
+// New creates a Logger for the given access log configuration and opens its output
+func New(conf config.AccessLog) (*Logger, error) {
+	output, err := openOutput(conf.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		format:     conf.Format,
+		fields:     make(map[string]struct{}),
+		headers:    conf.Headers,
+		redact:     make(map[string]struct{}),
+		sampleRate: *conf.SampleRate,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		output:     output,
+	}
+
+	if conf.Format == config.AccessLogFormatTemplate {
+		tmpl, err := template.New("access-log").Parse(conf.Template)
+		if err != nil {
+			output.Close()
+			return nil, err
+		}
+		l.template = tmpl
+	}
+
+	for _, field := range conf.Fields {
+		l.fields[field] = struct{}{}
+	}
+
+	for _, header := range conf.RedactHeaders {
+		l.redact[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	return l, nil
+}
+
+// Log writes the entry to the output, if it was picked by the sampling. The entry is formatted outside of the lock of the output.
+func (l *Logger) Log(entry Entry) {
+	if !l.sample() {
+		return
+	}
+
+	line, err := l.formatRecord(l.newRecord(entry))
+	if err != nil {
+		log.Errorf("could not format access log entry, error: %s", err)
+		return
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if _, err := l.output.Write(append(line, '\n')); err != nil {
+		log.Errorf("could not write access log entry, error: %s", err)
+	}
+}
+
+func (l *Logger) sample() bool {
+	if l.sampleRate >= 1 {
+		return true
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.random.Float64() < l.sampleRate
+}
+
+// Close the output of the Logger
+func (l *Logger) Close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.output.Close()
+}
+
+func (l *Logger) newRecord(entry Entry) Record {
+	r := entry.Request
+	remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteAddr = r.RemoteAddr
+	}
+
+	user := ""
+	if username, _, ok := r.BasicAuth(); ok {
+		user = username
+	}
+
+	headers := make(map[string]string, len(l.headers))
+	for _, header := range l.headers {
+		value := r.Header.Get(header)
+		if _, ok := l.redact[http.CanonicalHeaderKey(header)]; ok && value != "" {
+			value = redactedHeaderValue
+		}
+		headers[header] = value
+	}
+
+	return Record{
+		Time:          entry.StartTime,
+		RequestID:     entry.RequestID,
+		RemoteAddr:    remoteAddr,
+		User:          user,
+		Method:        r.Method,
+		URI:           r.RequestURI,
+		Protocol:      r.Proto,
+		Host:          r.Host,
+		Status:        entry.StatusCode,
+		Bytes:         entry.BytesWritten,
+		Duration:      entry.Duration,
+		Route:         string(entry.Route),
+		Port:          entry.Port,
+		Referer:       r.Referer(),
+		UserAgent:     r.UserAgent(),
+		Headers:       headers,
+		UpstreamError: entry.UpstreamError,
+	}
+}
+
+func (l *Logger) formatRecord(r Record) ([]byte, error) {
+	switch l.format {
+	case config.AccessLogFormatCommon:
+		return []byte(withRequestID(formatCommon(r), r.RequestID)), nil
+	case config.AccessLogFormatCombined:
+		return []byte(withRequestID(fmt.Sprintf("%s \"%s\" \"%s\"", formatCommon(r), escape(r.Referer), escape(r.UserAgent)), r.RequestID)), nil
+	case config.AccessLogFormatJSON:
+		return json.Marshal(l.selectFields(r))
+	case config.AccessLogFormatTemplate:
+		var buf bytes.Buffer
+		if err := l.template.Execute(&buf, r); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown access log format \"%s\"", l.format)
+	}
+}
+
+func (l *Logger) selectFields(r Record) map[string]interface{} {
+	all := map[string]interface{}{
+		"time":           r.Time.Format(time.RFC3339Nano),
+		"request_id":     r.RequestID,
+		"remote_addr":    r.RemoteAddr,
+		"user":           r.User,
+		"method":         r.Method,
+		"uri":            r.URI,
+		"protocol":       r.Protocol,
+		"host":           r.Host,
+		"status":         r.Status,
+		"bytes":          r.Bytes,
+		"duration_ms":    float64(r.Duration) / float64(time.Millisecond),
+		"route":          r.Route,
+		"port":           r.Port,
+		"referer":        r.Referer,
+		"user_agent":     r.UserAgent,
+		"headers":        r.Headers,
+		"upstream_error": r.UpstreamError,
+	}
+	if len(l.fields) == 0 {
+		return all
+	}
+
+	selected := make(map[string]interface{}, len(l.fields))
+	for field := range l.fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected
+}
+
+func formatCommon(r Record) string {
+	bytesWritten := "-"
+	if r.Bytes > 0 {
+		bytesWritten = fmt.Sprintf("%d", r.Bytes)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s", orDash(r.RemoteAddr), orDash(r.User), r.Time.Format(commonLogTimeFormat), r.Method, escape(r.URI), r.Protocol, r.Status, bytesWritten)
+}
+
+// withRequestID appends the quoted request id to a common or combined log line, if there is one
+func withRequestID(line, requestID string) string {
+	if requestID == "" {
+		return line
+	}
+	return fmt.Sprintf("%s \"%s\"", line, requestID)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(s, "\"", "\\\"")
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func openOutput(conf config.AccessLogOutput) (io.WriteCloser, error) {
+	switch conf.Type {
+	case config.AccessLogOutputFile:
+		return openRotatingFile(conf.File, conf.FileMaxSizeInMegaByte*megaBytesToBytesMultiplier, conf.GetFileRotationInterval(), conf.FileMaxBackups)
+	case config.AccessLogOutputSyslog:
+		return openSyslog(conf.SyslogNetwork, conf.SyslogAddress, conf.SyslogTag)
+	default:
+		return nopCloser{Writer: os.Stdout}, nil
+	}
+}
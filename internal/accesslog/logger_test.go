@@ -0,0 +1,179 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/config"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (bufferCloser) Close() error {
+	return nil
+}
+
+func testEntry() Entry {
+	r, _ := http.NewRequest(http.MethodGet, "http://example.com/hello?name=prox", nil)
+	r.RequestURI = "/hello?name=prox"
+	r.RemoteAddr = "10.0.0.1:51234"
+	r.Header.Set("User-Agent", "curl/7.64.1")
+	r.Header.Set("Referer", "http://example.com/")
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("X-Tenant", "prox")
+	return Entry{
+		StartTime:    time.Date(2020, 10, 10, 13, 55, 36, 0, time.UTC),
+		Duration:     1500 * time.Microsecond,
+		Request:      r,
+		Port:         80,
+		Route:        "test-route",
+		StatusCode:   200,
+		BytesWritten: 2326,
+	}
+}
+
+func newTestLogger(t *testing.T, conf config.AccessLog) (*Logger, *bufferCloser) {
+	rate := 1.0
+	if conf.SampleRate == nil {
+		conf.SampleRate = &rate
+	}
+	if len(conf.RedactHeaders) == 0 {
+		conf.RedactHeaders = []string{"Authorization"}
+	}
+	l, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bufferCloser{}
+	l.output = buf
+	return l, buf
+}
+
+func TestLogger_Log(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		conf config.AccessLog
+		id   string
+		want string
+	}{
+		{
+			name: "Common",
+			conf: config.AccessLog{Format: config.AccessLogFormatCommon},
+			want: `10.0.0.1 - - [10/Oct/2020:13:55:36 +0000] "GET /hello?name=prox HTTP/1.1" 200 2326` + "\n",
+		},
+		{
+			name: "Combined",
+			conf: config.AccessLog{Format: config.AccessLogFormatCombined},
+			want: `10.0.0.1 - - [10/Oct/2020:13:55:36 +0000] "GET /hello?name=prox HTTP/1.1" 200 2326 "http://example.com/" "curl/7.64.1"` + "\n",
+		},
+		{
+			name: "CombinedWithRequestID",
+			conf: config.AccessLog{Format: config.AccessLogFormatCombined},
+			id:   "01EN6Q9XK2ABCDEF",
+			want: `10.0.0.1 - - [10/Oct/2020:13:55:36 +0000] "GET /hello?name=prox HTTP/1.1" 200 2326 "http://example.com/" "curl/7.64.1" "01EN6Q9XK2ABCDEF"` + "\n",
+		},
+		{
+			name: "Template",
+			conf: config.AccessLog{Format: config.AccessLogFormatTemplate, Template: `{{.Route}} {{.Status}} {{.Duration}} {{index .Headers "Authorization"}}`, Headers: []string{"Authorization"}},
+			want: "test-route 200 1.5ms REDACTED\n",
+		},
+		{
+			name: "NoSampling",
+			conf: config.AccessLog{Format: config.AccessLogFormatCommon, SampleRate: new(float64)},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, buf := newTestLogger(t, tt.conf)
+			entry := testEntry()
+			entry.RequestID = tt.id
+			l.Log(entry)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Log() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogger_LogJSON(t *testing.T) {
+	t.Parallel()
+	l, buf := newTestLogger(t, config.AccessLog{
+		Format:  config.AccessLogFormatJSON,
+		Fields:  []string{"status", "route", "duration_ms", "headers", "request_id"},
+		Headers: []string{"Authorization", "X-Tenant"},
+	})
+	entry := testEntry()
+	entry.RequestID = "01EN6Q9XK2ABCDEF"
+	l.Log(entry)
+
+	got := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5 {
+		t.Errorf("Log() wrote fields %v, want only the selected ones", got)
+	}
+	if got["status"] != float64(200) || got["route"] != "test-route" || got["duration_ms"] != 1.5 || got["request_id"] != "01EN6Q9XK2ABCDEF" {
+		t.Errorf("Log() wrote unexpected values %v", got)
+	}
+	headers := got["headers"].(map[string]interface{})
+	if headers["Authorization"] != redactedHeaderValue || headers["X-Tenant"] != "prox" {
+		t.Errorf("Log() wrote unexpected headers %v", headers)
+	}
+}
+
+func Test_rotatingFile_Write(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "access.log")
+	unrelated := path + ".gz"
+	if err := ioutil.WriteFile(unrelated, []byte("archive"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := openRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	now := time.Date(2020, 10, 10, 0, 0, 0, 0, time.UTC)
+	rf.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := rf.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("rotatingFile kept %d backups, want 2", len(backups))
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("rotatingFile removed the unrelated file %s, error: %s", unrelated, err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(content)) != "line-4" {
+		t.Errorf("rotatingFile current content = %q, want %q", content, "line-4\n")
+	}
+}
@@ -0,0 +1,133 @@
+package accesslog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const megaBytesToBytesMultiplier = 1e+6
+const rotatedFileTimeFormat = "20060102T150405.000"
+
+// rotatingFile is a file which will be rotated when it exceeds its max size or its rotation interval.
+// Rotated files get the rotation time as suffix, only the newest maxBackups rotated files are kept. Not safe for concurrent use.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	openedAt   time.Time
+	now        func() time.Time
+}
+
+func openRotatingFile(path string, maxSize int64, interval time.Duration, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		interval:   interval,
+		maxBackups: maxBackups,
+		now:        time.Now,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.shouldRotate(int64(len(p))) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) Close() error {
+	return rf.file.Close()
+}
+
+func (rf *rotatingFile) shouldRotate(writeSize int64) bool {
+	if rf.size == 0 {
+		return false
+	}
+	if rf.maxSize > 0 && rf.size+writeSize > rf.maxSize {
+		return true
+	}
+	return rf.interval > 0 && rf.now().Sub(rf.openedAt) >= rf.interval
+}
+
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	rf.size = stat.Size()
+	rf.openedAt = rf.now()
+	return nil
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(rf.path, rf.path+"."+rf.now().Format(rotatedFileTimeFormat)); err != nil {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	return rf.removeOldBackups()
+}
+
+func (rf *rotatingFile) removeOldBackups() error {
+	backups, err := rf.backups()
+	if err != nil {
+		return err
+	}
+	if len(backups) <= rf.maxBackups {
+		return nil
+	}
+
+	// the time format of the suffix sorts lexically
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-rf.maxBackups] {
+		if err := os.Remove(backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backups returns the rotated files, other files which start with the name of the file are ignored
+func (rf *rotatingFile) backups() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Dir(rf.path))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(rf.path) + "."
+	backups := make([]string, 0)
+	for _, f := range files {
+		suffix := strings.TrimPrefix(f.Name(), prefix)
+		if f.IsDir() || suffix == f.Name() {
+			continue
+		}
+		if _, err := time.Parse(rotatedFileTimeFormat, suffix); err == nil {
+			backups = append(backups, filepath.Join(filepath.Dir(rf.path), f.Name()))
+		}
+	}
+	return backups, nil
+}
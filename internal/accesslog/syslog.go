@@ -0,0 +1,13 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package accesslog
+
+import (
+	"io"
+	"log/syslog"
+)
+
+func openSyslog(network, address, tag string) (io.WriteCloser, error) {
+	return syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+}
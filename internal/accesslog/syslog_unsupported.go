@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package accesslog
+
+import (
+	"errors"
+	"io"
+)
+
+func openSyslog(_, _, _ string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog access log output is not supported on this platform")
+}
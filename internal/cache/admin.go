@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/errorpage"
+	"github.com/fwiedmann/prox/internal/ipfilter"
+	log "github.com/sirupsen/logrus"
+)
+
+// MethodPurge removes the stored responses of the requested host and path
+const MethodPurge = "PURGE"
+
+// PortEntry is a stored response of the cache of a port
+type PortEntry struct {
+	Port string `json:"port"`
+	Entry
+}
+
+type purgeResult struct {
+	Purged int `json:"purged"`
+}
+
+// NewAdminHandler serves the inspection and purge API for the caches returned by caches, which are keyed by the name of their port.
+// GET requests list the stored responses, DELETE requests purge them. Both accept the port, key, route, host, path, path-prefix
+// and path-regexp query parameters as filters. DELETE requests require at least one filter, all=true purges all responses.
+func NewAdminHandler(caches func() map[string]Inspector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := Filter{
+			Key:        query.Get("key"),
+			Route:      query.Get("route"),
+			Host:       query.Get("host"),
+			Path:       query.Get("path"),
+			PathPrefix: query.Get("path-prefix"),
+		}
+		if expr := query.Get("path-regexp"); expr != "" {
+			pathRegexp, err := regexp.Compile(expr)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid path-regexp: %s", err), http.StatusBadRequest)
+				return
+			}
+			filter.PathRegexp = pathRegexp
+		}
+
+		selected := caches()
+		if port := query.Get("port"); port != "" {
+			selected = map[string]Inspector{port: selected[port]}
+			if selected[port] == nil {
+				http.Error(w, fmt.Sprintf("no cache for port \"%s\"", port), http.StatusNotFound)
+				return
+			}
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, listEntries(selected, filter))
+		case http.MethodDelete:
+			if filter.IsEmpty() && query.Get("all") != "true" {
+				http.Error(w, "at least one filter or all=true is required", http.StatusBadRequest)
+				return
+			}
+			var purged int
+			for _, c := range selected {
+				purged += c.Purge(filter)
+			}
+			log.Infof("Purged %d cached responses", purged)
+			writeJSON(w, http.StatusOK, purgeResult{Purged: purged})
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func listEntries(caches map[string]Inspector, filter Filter) []PortEntry {
+	ports := make([]string, 0, len(caches))
+	for port := range caches {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+
+	entries := make([]PortEntry, 0)
+	for _, port := range ports {
+		for _, e := range caches[port].Entries(filter) {
+			entries = append(entries, PortEntry{Port: port, Entry: e})
+		}
+	}
+	return entries
+}
+
+// PurgeMethod answers PURGE requests by removing the stored responses of the requested host and path of the route which serves the request
+type PurgeMethod struct {
+	cache     Inspector
+	routeFor  func(r *http.Request) (*route.Route, error)
+	isAllowed func(ip net.IP) bool
+}
+
+// NewPurgeMethod creates a PurgeMethod for the cache, routeFor returns the route which serves the request
+// and isAllowed decides which client IPs can purge responses
+func NewPurgeMethod(cache Inspector, routeFor func(r *http.Request) (*route.Route, error), isAllowed func(ip net.IP) bool) *PurgeMethod {
+	return &PurgeMethod{cache: cache, routeFor: routeFor, isAllowed: isAllowed}
+}
+
+// Inject the PurgeMethod before the next handler, all other methods are passed to the next handler
+func (p *PurgeMethod) Inject(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != MethodPurge {
+			next(w, r)
+			return
+		}
+
+		if ip := ipfilter.ClientIP(r); ip == nil || !p.isAllowed(ip) {
+			errorpage.WriteStatus(w, r, http.StatusForbidden, "the client is not allowed to purge cached responses")
+			return
+		}
+
+		var purged int
+		// the responses are stored with the path rewritten by the cache key of the route
+		if route, err := p.routeFor(r); err == nil {
+			purged = p.cache.Purge(Filter{Route: string(route.NameID), Host: r.Host, Path: keyPath(route.CacheKey, r)})
+		}
+		status := http.StatusOK
+		if purged == 0 {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, purgeResult{Purged: purged})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set(httpContentTypeHeader, "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("could not write cache admin response, error: %s", err)
+	}
+}
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/config"
+)
+
+func newTestInspectors(t *testing.T) (map[string]Inspector, func()) {
+	t.Helper()
+	hc := NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+	dc, err := NewDiskCache("test", t.TempDir(), -1, config.CacheEvictionLRU)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := newTestRoute(t, route.Route{NameID: "api", Hostname: "api.example.com"})
+	web := newTestRoute(t, route.Route{NameID: "web", Hostname: "example.com"})
+	for _, stored := range []struct {
+		route route.Route
+		host  string
+		path  string
+	}{
+		{route: api, host: "api.example.com:8080", path: "/v1/users"},
+		{route: api, host: "api.example.com:8080", path: "/v2/users?page=2"},
+		{route: web, host: "example.com", path: "/index.html"},
+	} {
+		request := &http.Request{Method: http.MethodGet, Host: stored.host, RequestURI: stored.path}
+		save(hc, stored.route, request, newTestResponse("body", http.Header{"Cache-Control": {"max-age=60"}}))
+		save(dc, stored.route, request, newTestResponse("body", http.Header{"Cache-Control": {"max-age=60"}}))
+	}
+	return map[string]Inspector{"http": hc, "https": dc}, func() {
+		hc.Close()
+		dc.Close()
+	}
+}
+
+func TestNewAdminHandler(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		method         string
+		query          string
+		wantStatusCode int
+		wantEntries    int
+		wantPurged     int
+		wantRemaining  int
+	}{
+		{
+			name:           "ListAll",
+			method:         http.MethodGet,
+			wantStatusCode: http.StatusOK,
+			wantEntries:    6,
+			wantRemaining:  6,
+		},
+		{
+			name:           "ListPortAndRoute",
+			method:         http.MethodGet,
+			query:          "port=https&route=api",
+			wantStatusCode: http.StatusOK,
+			wantEntries:    2,
+			wantRemaining:  6,
+		},
+		{
+			name:           "PurgeHostAndPathPrefix",
+			method:         http.MethodDelete,
+			query:          "host=API.example.com&path-prefix=/v1/",
+			wantStatusCode: http.StatusOK,
+			wantPurged:     2,
+			wantRemaining:  4,
+		},
+		{
+			name:           "PurgePathRegexp",
+			method:         http.MethodDelete,
+			query:          "path-regexp=" + `\.html$`,
+			wantStatusCode: http.StatusOK,
+			wantPurged:     2,
+			wantRemaining:  4,
+		},
+		{
+			name:           "PurgeKey",
+			method:         http.MethodDelete,
+			query:          "key=web-example.com-/index.html",
+			wantStatusCode: http.StatusOK,
+			wantPurged:     2,
+			wantRemaining:  4,
+		},
+		{
+			name:           "PurgeWithoutFilter",
+			method:         http.MethodDelete,
+			wantStatusCode: http.StatusBadRequest,
+			wantRemaining:  6,
+		},
+		{
+			name:           "PurgeAll",
+			method:         http.MethodDelete,
+			query:          "all=true",
+			wantStatusCode: http.StatusOK,
+			wantPurged:     6,
+		},
+		{
+			name:           "InvalidRegexp",
+			method:         http.MethodGet,
+			query:          "path-regexp=(",
+			wantStatusCode: http.StatusBadRequest,
+			wantRemaining:  6,
+		},
+		{
+			name:           "UnknownPort",
+			method:         http.MethodGet,
+			query:          "port=admin",
+			wantStatusCode: http.StatusNotFound,
+			wantRemaining:  6,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			inspectors, closeCaches := newTestInspectors(t)
+			defer closeCaches()
+			handler := NewAdminHandler(func() map[string]Inspector { return inspectors })
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(tt.method, "/admin/cache/entries?"+tt.query, nil))
+			if w.Code != tt.wantStatusCode {
+				t.Fatalf("status got %d, want %d: %s", w.Code, tt.wantStatusCode, w.Body.String())
+			}
+
+			switch {
+			case w.Code != http.StatusOK:
+			case tt.method == http.MethodGet:
+				var entries []PortEntry
+				if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != tt.wantEntries {
+					t.Errorf("entries got %d, want %d", len(entries), tt.wantEntries)
+				}
+			default:
+				var result purgeResult
+				if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+					t.Fatal(err)
+				}
+				if result.Purged != tt.wantPurged {
+					t.Errorf("purged got %d, want %d", result.Purged, tt.wantPurged)
+				}
+			}
+
+			var remaining int
+			for _, inspector := range inspectors {
+				remaining += len(inspector.Entries(Filter{}))
+			}
+			if remaining != tt.wantRemaining {
+				t.Errorf("remaining entries got %d, want %d", remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestPurgeMethod_Inject(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		method         string
+		remoteAddr     string
+		host           string
+		path           string
+		wantStatusCode int
+		wantRemaining  int
+	}{
+		{
+			name:           "Purged",
+			method:         MethodPurge,
+			remoteAddr:     "10.0.0.1:1234",
+			host:           "api.example.com:8080",
+			path:           "/v1/users",
+			wantStatusCode: http.StatusOK,
+			wantRemaining:  3,
+		},
+		{
+			name:           "PurgedWithCacheKey",
+			method:         MethodPurge,
+			remoteAddr:     "10.0.0.1:1234",
+			host:           "keyed.example.com",
+			path:           "/A?b=1&a=2",
+			wantStatusCode: http.StatusOK,
+			wantRemaining:  3,
+		},
+		{
+			name:           "NoRoute",
+			method:         MethodPurge,
+			remoteAddr:     "10.0.0.1:1234",
+			host:           "unknown.example.com",
+			path:           "/v1/users",
+			wantStatusCode: http.StatusNotFound,
+			wantRemaining:  4,
+		},
+		{
+			name:           "NotStored",
+			method:         MethodPurge,
+			remoteAddr:     "10.0.0.1:1234",
+			host:           "api.example.com",
+			path:           "/v3/users",
+			wantStatusCode: http.StatusNotFound,
+			wantRemaining:  4,
+		},
+		{
+			name:           "ForbiddenClient",
+			method:         MethodPurge,
+			remoteAddr:     "192.168.0.1:1234",
+			host:           "api.example.com",
+			path:           "/v1/users",
+			wantStatusCode: http.StatusForbidden,
+			wantRemaining:  4,
+		},
+		{
+			name:           "OtherMethod",
+			method:         http.MethodGet,
+			remoteAddr:     "10.0.0.1:1234",
+			host:           "api.example.com",
+			path:           "/v1/users",
+			wantStatusCode: http.StatusTeapot,
+			wantRemaining:  4,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			inspectors, closeCaches := newTestInspectors(t)
+			defer closeCaches()
+			routes := []route.Route{
+				newTestRoute(t, route.Route{NameID: "api", Hostname: "api.example.com"}),
+				newTestRoute(t, route.Route{NameID: "keyed", Hostname: "keyed.example.com", CacheKey: route.CacheKey{QuerySort: true, IgnoreCase: true}}),
+			}
+			save(inspectors["http"].(*HTTPInMemoryCache), routes[1], &http.Request{Method: http.MethodGet, Host: "keyed.example.com", RequestURI: "/a?a=2&b=1"}, newTestResponse("body", http.Header{"Cache-Control": {"max-age=60"}}))
+			routeFor := func(r *http.Request) (*route.Route, error) {
+				for _, rt := range routes {
+					if rt.IsHostnameMatching(hostname(r.Host)) {
+						return &rt, nil
+					}
+				}
+				return nil, errors.New("no matching route")
+			}
+			_, allowed, _ := net.ParseCIDR("10.0.0.0/8")
+			handler := NewPurgeMethod(inspectors["http"], routeFor, allowed.Contains).Inject(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Host = tt.host
+			r.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("status got %d, want %d", w.Code, tt.wantStatusCode)
+			}
+			if got := len(inspectors["http"].Entries(Filter{})); got != tt.wantRemaining {
+				t.Errorf("remaining entries got %d, want %d", got, tt.wantRemaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,717 @@
+package cache
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+	"github.com/fwiedmann/prox/internal/infra"
+	log "github.com/sirupsen/logrus"
+)
+
+const diskMetadataSuffix = ".meta"
+const diskBodySuffix = ".body"
+const diskTempPrefix = "tmp-"
+const diskLockFile = ".lock"
+
+// diskLockTimeout is the max time a new cache waits until another process handed off the directory
+const diskLockTimeout = 10 * time.Second
+const diskLockPollInterval = 50 * time.Millisecond
+
+var (
+	ErrorInvalidDiskCacheDirectory = errors.New("disk cache directory is invalid")
+	ErrorDiskCacheLocked           = errors.New("disk cache directory is locked by another process")
+)
+
+var fileSequence uint64
+
+// diskMetadata is stored as JSON next to the body of a response
+type diskMetadata struct {
+	ID            string            `json:"id"`
+	PrimaryID     string            `json:"primary_id"`
+	VaryFields    []string          `json:"vary_fields,omitempty"`
+	Route         string            `json:"route"`
+	Host          string            `json:"host"`
+	Path          string            `json:"path"`
+	Header        http.Header       `json:"header"`
+	StatusCode    int               `json:"status_code"`
+	Status        string            `json:"status"`
+	ContentLength int64             `json:"content_length"`
+	MetricLabels  map[string]string `json:"metric_labels"`
+	ResponseTime  time.Time         `json:"response_time"`
+	InitialAge    time.Duration     `json:"initial_age"`
+	Lifetime      time.Duration     `json:"lifetime"`
+	RemoveAt      time.Time         `json:"remove_at"`
+}
+
+func newDiskMetadata(e *entry, varyFields []string) diskMetadata {
+	return diskMetadata{
+		ID:            e.id,
+		PrimaryID:     e.primaryID,
+		VaryFields:    varyFields,
+		Route:         e.location.route,
+		Host:          e.location.host,
+		Path:          e.location.path,
+		Header:        e.response.header,
+		StatusCode:    e.response.statusCode,
+		Status:        e.response.status,
+		ContentLength: e.response.contentLength,
+		MetricLabels:  e.response.metricLabels,
+		ResponseTime:  e.response.responseTime,
+		InitialAge:    e.response.initialAge,
+		Lifetime:      e.response.lifetime,
+		RemoveAt:      e.response.removeAt,
+	}
+}
+
+func (m diskMetadata) response() response {
+	return response{
+		contentLength: m.ContentLength,
+		header:        m.Header,
+		statusCode:    m.StatusCode,
+		status:        m.Status,
+		metricLabels:  m.MetricLabels,
+		responseTime:  m.ResponseTime,
+		initialAge:    m.InitialAge,
+		lifetime:      m.Lifetime,
+		removeAt:      m.RemoveAt,
+	}
+}
+
+// DiskCache stores http responses in files of a directory, each response with a metadata and a body file.
+// An index of all stored responses is kept in memory and restored from the metadata files on start.
+// The directory is locked, only one process at a time owns it. See HandOff for hot restarts.
+type DiskCache struct {
+	port                string
+	directory           string
+	eviction            string
+	mtx                 sync.Mutex
+	entries             map[string]*entry
+	vary                map[string]varyFieldsOfVariants
+	policy              evictionPolicy
+	maxCacheSizeInBytes int64
+	cacheSizeInBytes    int64
+	expiry              *expiryScheduler
+	closeOnce           sync.Once
+	// ownership is held for reading while the files of the directory are changed and for writing while the directory is handed off
+	ownership sync.RWMutex
+	lock      *directoryLock
+	released  bool
+}
+
+// NewDiskCache creates a cache in the directory and loads all valid responses which are already stored in it.
+// Once the cache is full, responses will be evicted with the given policy, "lru" or "lfu".
+// If another process owns the directory, it waits until the directory was handed off. The size metrics are labeled with the port name.
+func NewDiskCache(port, directory string, maxCacheSizeInMegaBytes int64, eviction string) (*DiskCache, error) {
+	if directory == "" {
+		return nil, ErrorInvalidDiskCacheDirectory
+	}
+	if err := os.MkdirAll(directory, 0750); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrorInvalidDiskCacheDirectory, err)
+	}
+	lock, err := lockDirectory(directory, diskLockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	dc := &DiskCache{
+		port:      port,
+		directory: directory,
+		eviction:  eviction,
+		lock:      lock,
+	}
+	dc.expiry = newExpiryScheduler(dc.expire)
+	dc.setMaxSize(maxCacheSizeInMegaBytes)
+
+	if err := dc.open(); err != nil {
+		lock.release()
+		return nil, err
+	}
+	go dc.expiry.run()
+	return dc, nil
+}
+
+// open loads the index from the directory and evicts the responses which do not fit into the cache
+func (dc *DiskCache) open() error {
+	dc.resetIndex()
+	if err := dc.load(); err != nil {
+		return err
+	}
+	dc.removeFiles(dc.evict(0))
+	return nil
+}
+
+func (dc *DiskCache) resetIndex() {
+	dc.entries = make(map[string]*entry)
+	dc.vary = make(map[string]varyFieldsOfVariants)
+	dc.policy = newEvictionPolicy(dc.eviction)
+	dc.addSize(-dc.cacheSizeInBytes)
+}
+
+// HandOff releases the directory for another process, e.g. the new process of a hot restart. In-flight writes are finished
+// before, responses which are still streamed to clients are discarded. Afterwards the cache answers with misses and stores nothing.
+func (dc *DiskCache) HandOff() error {
+	dc.ownership.Lock()
+	defer dc.ownership.Unlock()
+	if dc.released {
+		return nil
+	}
+	dc.released = true
+	dc.mtx.Lock()
+	dc.resetIndex()
+	dc.mtx.Unlock()
+	return dc.lock.release()
+}
+
+// Resume takes the directory back after a HandOff, e.g. when the new process of a hot restart failed. The index is loaded again from the directory.
+func (dc *DiskCache) Resume() error {
+	dc.ownership.Lock()
+	defer dc.ownership.Unlock()
+	if !dc.released {
+		return nil
+	}
+	lock, err := lockDirectory(dc.directory, diskLockTimeout)
+	if err != nil {
+		return err
+	}
+	dc.mtx.Lock()
+	err = dc.open()
+	dc.mtx.Unlock()
+	if err != nil {
+		lock.release()
+		return err
+	}
+	dc.lock = lock
+	dc.released = false
+	return nil
+}
+
+// Get return a stored response which is fresh for the request, the body is read from the disk. If no fresh response was found nil will be returned
+func (dc *DiskCache) Get(route route.Route, request *http.Request) *http.Response {
+	stored, body, now := dc.get(route, request, true)
+	if body == nil {
+		return nil
+	}
+	resp := stored.toHTTPResponse(now)
+	resp.Body = body
+	return resp
+}
+
+// GetStale returns a stored response which is not fresh for the request and has to be revalidated.
+// If no response was found or the response is fresh nil will be returned.
+func (dc *DiskCache) GetStale(route route.Route, request *http.Request) *StaleResponse {
+	stored, body, now := dc.get(route, request, false)
+	if body == nil {
+		return nil
+	}
+	stale := stored.toStaleResponse(route, now, cachecontrol.Parse(request.Header))
+	stale.Body = body
+	return stale
+}
+
+// get returns the stored response with its opened body file, the body is nil if no response was found
+func (dc *DiskCache) get(route route.Route, request *http.Request, fresh bool) (response, *os.File, time.Time) {
+	dc.ownership.RLock()
+	defer dc.ownership.RUnlock()
+	dc.mtx.Lock()
+	now := time.Now()
+	e, ok := dc.lookup(BuildID(route, request), request)
+	if !ok || e.response.isFresh(now, cachecontrol.Parse(request.Header)) != fresh {
+		dc.mtx.Unlock()
+		return response{}, nil, now
+	}
+	if fresh {
+		dc.policy.touch(e)
+	}
+	stored, file := e.response, e.file
+	dc.mtx.Unlock()
+
+	body, err := os.Open(dc.path(file, diskBodySuffix))
+	if err != nil {
+		log.Errorf("could not open the body of the cached response \"%s\", error: %s", file, err)
+		return response{}, nil, now
+	}
+	return stored, body, now
+}
+
+// Save a http request with its body on the disk. The route.NameID, http.Request.Host including the port, http.Request.RequestURI and the
+// request headers listed in the Vary header of the response will be used to generate an ID.
+// The body of the response is replaced and written to a temporary file while it is read, the response is stored once the body was read completely.
+func (dc *DiskCache) Save(route route.Route, request *http.Request, resp *http.Response) {
+	if !isValidSave(route, request, resp) || dc.isReleased() || !dc.fits(route, resp.ContentLength, resp.ContentLength) {
+		return
+	}
+
+	now := time.Now()
+	stored, ok := newFillResponse(route, request, resp, now)
+	if !ok {
+		return
+	}
+
+	tmp, err := ioutil.TempFile(dc.directory, diskTempPrefix)
+	if err != nil {
+		log.Errorf("could not store the response for route \"%s\" on the disk, error: %s", route.NameID, err)
+		return
+	}
+
+	primaryID := BuildID(route, request)
+	fields := varyFields(resp.Header)
+	sink := &diskSink{
+		dc:     dc,
+		route:  route,
+		entry:  &entry{id: variantID(primaryID, fields, request), primaryID: primaryID, response: stored, location: newLocation(route, request), file: fileName(primaryID, now)},
+		fields: fields,
+		tmp:    tmp,
+		body:   bufio.NewWriter(tmp),
+	}
+	resp.Body = newTeeBody(resp.Body, sink, fillLimit(route, dc.maxSize()))
+}
+
+// diskSink writes the body of a response which will be stored in a DiskCache to a temporary file
+type diskSink struct {
+	dc     *DiskCache
+	route  route.Route
+	entry  *entry
+	fields []string
+	tmp    *os.File
+	body   *bufio.Writer
+}
+
+func (ds *diskSink) Write(p []byte) (int, error) {
+	return ds.body.Write(p)
+}
+
+func (ds *diskSink) commit(bodySize int64) {
+	ds.dc.ownership.RLock()
+	defer ds.dc.ownership.RUnlock()
+	if ds.dc.released {
+		ds.abort()
+		return
+	}
+	if err := ds.body.Flush(); err != nil {
+		ds.abort()
+		log.Errorf("could not store the response for route \"%s\" on the disk, error: %s", ds.route.NameID, err)
+		return
+	}
+	ds.entry.response.contentLength = bodySize
+	size, err := ds.dc.write(ds.entry, ds.fields, ds.tmp)
+	if err != nil {
+		log.Errorf("could not store the response for route \"%s\" on the disk, error: %s", ds.route.NameID, err)
+		return
+	}
+	ds.entry.size = size
+	ds.dc.store(ds.route, ds.entry, ds.fields)
+}
+
+func (ds *diskSink) abort() {
+	ds.tmp.Close()
+	os.Remove(ds.tmp.Name())
+}
+
+// store adds the entry whose files are already written to the index, entries which do not fit into the limits are removed
+func (dc *DiskCache) store(route route.Route, e *entry, fields []string) {
+	dc.mtx.Lock()
+	if !fitsLimits(route, dc.maxCacheSizeInBytes, e.response.contentLength, e.size) {
+		dc.mtx.Unlock()
+		dc.removeFiles([]string{e.file})
+		return
+	}
+	removed := make([]string, 0)
+	if previous, ok := dc.entries[e.id]; ok {
+		removed = append(removed, dc.removeEntry(previous))
+	}
+	removed = append(removed, dc.evict(e.size)...)
+	dc.entries[e.id] = e
+	dc.policy.add(e)
+	variants := dc.vary[e.primaryID]
+	variants.fields = fields
+	variants.variants++
+	dc.vary[e.primaryID] = variants
+	dc.addSize(e.size)
+	dc.mtx.Unlock()
+
+	dc.removeFiles(removed)
+	infra.CacheStores.With(e.response.metricLabels).Inc()
+	dc.expiry.schedule(expiryItem{id: e.id, removeAt: e.response.removeAt})
+}
+
+// Refresh updates a stored response with the headers of a 304 Not Modified upstream response to a revalidation, see RFC 7234 section 4.3.4.
+// Returns the updated response or nil if no response was stored.
+func (dc *DiskCache) Refresh(route route.Route, request *http.Request, notModified *http.Response) *http.Response {
+	dc.ownership.RLock()
+	defer dc.ownership.RUnlock()
+	dc.mtx.Lock()
+	e, ok := dc.lookup(BuildID(route, request), request)
+	if !ok {
+		dc.mtx.Unlock()
+		return nil
+	}
+	now := time.Now()
+	refreshed := *e
+	refreshed.response.refresh(notModified, now, route.GetCacheTimeOut())
+	fields := dc.vary[e.primaryID].fields
+	dc.mtx.Unlock()
+
+	body, err := os.Open(dc.path(refreshed.file, diskBodySuffix))
+	if err != nil {
+		return nil
+	}
+	resp := refreshed.response.toHTTPResponse(now)
+	resp.Body = body
+
+	retention := refreshed.response.retention(route)
+	if retention <= 0 || cachecontrol.Parse(refreshed.response.header).Has(cachecontrol.NoStore) {
+		dc.mtx.Lock()
+		file := dc.removeIfUnchanged(e)
+		dc.mtx.Unlock()
+		dc.removeFiles([]string{file})
+		return resp
+	}
+	refreshed.response.removeAt = now.Add(retention)
+
+	metadataSize, err := dc.writeMetadata(&refreshed, fields)
+	if err != nil {
+		log.Errorf("could not update the cached response for route \"%s\" on the disk, error: %s", route.NameID, err)
+		return resp
+	}
+
+	dc.mtx.Lock()
+	if current, ok := dc.entries[e.id]; ok && current == e {
+		size := refreshed.response.contentLength + metadataSize
+		dc.addSize(size - e.size)
+		e.response = refreshed.response
+		e.size = size
+		dc.policy.touch(e)
+	}
+	dc.mtx.Unlock()
+	dc.expiry.schedule(expiryItem{id: e.id, removeAt: refreshed.response.removeAt})
+	return resp
+}
+
+// Entries returns the stored responses which match the filter sorted by their key
+func (dc *DiskCache) Entries(filter Filter) []Entry {
+	dc.ownership.RLock()
+	defer dc.ownership.RUnlock()
+	dc.mtx.Lock()
+	defer dc.mtx.Unlock()
+
+	now := time.Now()
+	entries := make([]Entry, 0)
+	for _, e := range dc.entries {
+		if filter.matches(e) {
+			entries = append(entries, e.describe(now))
+		}
+	}
+	sortEntries(entries)
+	return entries
+}
+
+// Purge removes the stored responses which match the filter and their files, returns the number of removed responses
+func (dc *DiskCache) Purge(filter Filter) int {
+	dc.ownership.RLock()
+	defer dc.ownership.RUnlock()
+	dc.mtx.Lock()
+	removed := make([]string, 0)
+	for _, e := range dc.entries {
+		if filter.matches(e) {
+			removed = append(removed, dc.removeEntry(e))
+		}
+	}
+	dc.mtx.Unlock()
+
+	dc.removeFiles(removed)
+	return len(removed)
+}
+
+// Resize changes the max size of the cache. Responses will be evicted until the stored responses fit into the new size.
+func (dc *DiskCache) Resize(maxCacheSizeInMegaBytes int64) {
+	dc.ownership.RLock()
+	defer dc.ownership.RUnlock()
+	dc.mtx.Lock()
+	dc.setMaxSize(maxCacheSizeInMegaBytes)
+	removed := dc.evict(0)
+	dc.mtx.Unlock()
+	dc.removeFiles(removed)
+}
+
+// Close stops the expiry of all stored responses and releases the directory, the responses are kept on the disk
+func (dc *DiskCache) Close() error {
+	dc.closeOnce.Do(func() {
+		dc.expiry.close()
+		infra.DiskCacheMaxSizeInBytes.DeleteLabelValues(dc.port)
+		infra.DiskCacheCurrentSizeInBytes.DeleteLabelValues(dc.port)
+	})
+	return dc.HandOff()
+}
+
+func (dc *DiskCache) isReleased() bool {
+	dc.ownership.RLock()
+	defer dc.ownership.RUnlock()
+	return dc.released
+}
+
+func (dc *DiskCache) setMaxSize(maxCacheSizeInMegaBytes int64) {
+	dc.maxCacheSizeInBytes = maxSizeInBytes(maxCacheSizeInMegaBytes)
+	infra.DiskCacheMaxSizeInBytes.WithLabelValues(dc.port).Set(float64(dc.maxCacheSizeInBytes))
+}
+
+func (dc *DiskCache) maxSize() int64 {
+	dc.mtx.Lock()
+	defer dc.mtx.Unlock()
+	return dc.maxCacheSizeInBytes
+}
+
+func (dc *DiskCache) fits(route route.Route, bodySize, size int64) bool {
+	dc.mtx.Lock()
+	defer dc.mtx.Unlock()
+	return fitsLimits(route, dc.maxCacheSizeInBytes, bodySize, size)
+}
+
+// write commits the temporary body file and afterwards writes the metadata of the entry. The metadata file is written last,
+// a response without metadata will be removed on the next start. Returns the size of both files.
+func (dc *DiskCache) write(e *entry, varyFields []string, body *os.File) (int64, error) {
+	if err := dc.commitFile(body, dc.path(e.file, diskBodySuffix)); err != nil {
+		return 0, err
+	}
+	metadataSize, err := dc.writeMetadata(e, varyFields)
+	if err != nil {
+		_ = os.Remove(dc.path(e.file, diskBodySuffix))
+		return 0, err
+	}
+	return e.response.contentLength + metadataSize, nil
+}
+
+func (dc *DiskCache) writeMetadata(e *entry, varyFields []string) (int64, error) {
+	metadata, err := json.Marshal(newDiskMetadata(e, varyFields))
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(metadata)), dc.writeFile(dc.path(e.file, diskMetadataSuffix), metadata)
+}
+
+// writeFile writes the content to a temporary file which will be committed, the file contains either the old or the new content after a crash
+func (dc *DiskCache) writeFile(path string, content []byte) error {
+	tmp, err := ioutil.TempFile(dc.directory, diskTempPrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	return dc.commitFile(tmp, path)
+}
+
+// commitFile syncs, closes and renames the temporary file to the path. The temporary file is removed on errors.
+func (dc *DiskCache) commitFile(tmp *os.File, path string) error {
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return syncDirectory(dc.directory)
+}
+
+// load restores the index from the metadata files. Temporary files, incomplete and expired responses will be removed.
+func (dc *DiskCache) load() error {
+	files, err := ioutil.ReadDir(dc.directory)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrorInvalidDiskCacheDirectory, err)
+	}
+
+	now := time.Now()
+	bodies := make(map[string]int64)
+	metadataFiles := make([]string, 0)
+	for _, f := range files {
+		name := f.Name()
+		switch {
+		case f.IsDir():
+		case strings.HasPrefix(name, diskTempPrefix):
+			dc.removeFile(name)
+		case strings.HasSuffix(name, diskBodySuffix):
+			bodies[strings.TrimSuffix(name, diskBodySuffix)] = f.Size()
+		case strings.HasSuffix(name, diskMetadataSuffix):
+			metadataFiles = append(metadataFiles, name)
+		}
+	}
+
+	loaded := make(map[string]*entry)
+	variants := make(map[string][]string)
+	for _, name := range metadataFiles {
+		file := strings.TrimSuffix(name, diskMetadataSuffix)
+		bodySize, hasBody := bodies[file]
+		delete(bodies, file)
+
+		content, err := ioutil.ReadFile(dc.path(file, diskMetadataSuffix))
+		var metadata diskMetadata
+		if err == nil {
+			err = json.Unmarshal(content, &metadata)
+		}
+		if err != nil || !hasBody || bodySize != metadata.ContentLength || !metadata.RemoveAt.After(now) || metadata.ID == "" {
+			dc.removeFiles([]string{file})
+			continue
+		}
+
+		e := &entry{id: metadata.ID, primaryID: metadata.PrimaryID, response: metadata.response(), size: bodySize + int64(len(content)), file: file}
+		e.location = location{route: metadata.Route, host: metadata.Host, path: metadata.Path}
+		if previous, ok := loaded[e.id]; ok {
+			if previous.response.responseTime.After(e.response.responseTime) {
+				dc.removeFiles([]string{file})
+				continue
+			}
+			dc.removeFiles([]string{previous.file})
+		}
+		loaded[e.id] = e
+		variants[e.primaryID] = metadata.VaryFields
+	}
+
+	for file := range bodies {
+		dc.removeFile(file + diskBodySuffix)
+	}
+
+	sorted := make([]*entry, 0, len(loaded))
+	for _, e := range loaded {
+		sorted = append(sorted, e)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].response.responseTime.Before(sorted[j].response.responseTime)
+	})
+	for _, e := range sorted {
+		dc.entries[e.id] = e
+		dc.policy.add(e)
+		v := dc.vary[e.primaryID]
+		v.fields = variants[e.primaryID]
+		v.variants++
+		dc.vary[e.primaryID] = v
+		dc.addSize(e.size)
+		dc.expiry.schedule(expiryItem{id: e.id, removeAt: e.response.removeAt})
+	}
+	log.Infof("Loaded %d cached responses with %d bytes from \"%s\"", len(sorted), dc.cacheSizeInBytes, dc.directory)
+	return nil
+}
+
+// evict removes the entries chosen by the eviction policy until the reserved bytes fit into the max size of the cache.
+// The lock has to be held, the files of the removed entries are returned.
+func (dc *DiskCache) evict(reserve int64) []string {
+	removed := make([]string, 0)
+	for dc.maxCacheSizeInBytes != -1 && dc.cacheSizeInBytes+reserve > dc.maxCacheSizeInBytes {
+		victim := dc.policy.victim()
+		if victim == nil {
+			break
+		}
+		removed = append(removed, dc.removeEntry(victim))
+		infra.CacheEvictions.With(victim.response.metricLabels).Inc()
+	}
+	return removed
+}
+
+// expire removes a scheduled entry, if it was not replaced by an entry with a different removal time
+func (dc *DiskCache) expire(item expiryItem) {
+	dc.ownership.RLock()
+	defer dc.ownership.RUnlock()
+	dc.mtx.Lock()
+	e, ok := dc.entries[item.id]
+	if !ok || !e.response.removeAt.Equal(item.removeAt) {
+		dc.mtx.Unlock()
+		return
+	}
+	file := dc.removeEntry(e)
+	dc.mtx.Unlock()
+
+	dc.removeFiles([]string{file})
+	infra.CacheEvictions.With(e.response.metricLabels).Inc()
+}
+
+// removeIfUnchanged removes the entry if it is still stored, returns the file of the removed entry
+func (dc *DiskCache) removeIfUnchanged(e *entry) string {
+	if current, ok := dc.entries[e.id]; !ok || current != e {
+		return ""
+	}
+	return dc.removeEntry(e)
+}
+
+// removeEntry from the index, the lock has to be held. Returns the file of the entry which has to be removed.
+func (dc *DiskCache) removeEntry(e *entry) string {
+	delete(dc.entries, e.id)
+	dc.policy.remove(e)
+	if variants := dc.vary[e.primaryID]; variants.variants <= 1 {
+		delete(dc.vary, e.primaryID)
+	} else {
+		variants.variants--
+		dc.vary[e.primaryID] = variants
+	}
+	dc.addSize(-e.size)
+	return e.file
+}
+
+func (dc *DiskCache) removeFiles(files []string) {
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		dc.removeFile(file + diskMetadataSuffix)
+		dc.removeFile(file + diskBodySuffix)
+	}
+}
+
+func (dc *DiskCache) removeFile(name string) {
+	if err := os.Remove(filepath.Join(dc.directory, name)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("could not remove cache file \"%s\", error: %s", name, err)
+	}
+}
+
+func (dc *DiskCache) addSize(delta int64) {
+	dc.cacheSizeInBytes += delta
+	infra.DiskCacheCurrentSizeInBytes.WithLabelValues(dc.port).Set(float64(dc.cacheSizeInBytes))
+}
+
+// lookup returns the stored variant which matches the request, the lock has to be held
+func (dc *DiskCache) lookup(primaryID string, request *http.Request) (*entry, bool) {
+	e, ok := dc.entries[variantID(primaryID, dc.vary[primaryID].fields, request)]
+	return e, ok
+}
+
+func (dc *DiskCache) path(file, suffix string) string {
+	return filepath.Join(dc.directory, file+suffix)
+}
+
+// fileName is unique for each stored response, a replaced response can be removed without touching the files of the new one
+func fileName(primaryID string, now time.Time) string {
+	sum := sha256.Sum256([]byte(primaryID))
+	return fmt.Sprintf("%s-%d-%d", hex.EncodeToString(sum[:16]), now.UnixNano(), atomic.AddUint64(&fileSequence, 1))
+}
+
+func syncDirectory(directory string) error {
+	d, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+	return nil
+}
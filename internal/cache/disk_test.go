@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/config"
+)
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestDiskCache_WarmStart(t *testing.T) {
+	t.Parallel()
+	directory := t.TempDir()
+	r := newTestRoute(t, route.Route{NameID: "disk", Hostname: "example.com"})
+	request := &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/", Header: http.Header{"Accept-Encoding": {"gzip"}}}
+
+	dc, err := NewDiskCache("test", directory, -1, config.CacheEvictionLRU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	save(dc, r, request, newTestResponse("hello", http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Encoding"}}))
+	got := dc.Get(r, request)
+	if got == nil || readBody(t, got) != "hello" {
+		t.Fatal("Get() did not return the stored response")
+	}
+	size := dc.cacheSizeInBytes
+	if err := dc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{"tmp-123": "partial", "orphan.body": "body", "corrupt.meta": "{", "corrupt.body": "body"} {
+		if err := ioutil.WriteFile(filepath.Join(directory, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restarted, err := NewDiskCache("test", directory, -1, config.CacheEvictionLRU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+
+	got = restarted.Get(r, request)
+	if got == nil || readBody(t, got) != "hello" {
+		t.Fatal("Get() did not return the response stored before the restart")
+	}
+	if restarted.Get(r, &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/", Header: http.Header{"Accept-Encoding": {"br"}}}) != nil {
+		t.Error("Get() ignored the restored Vary header")
+	}
+	if restarted.cacheSizeInBytes != size {
+		t.Errorf("restored cache size %d, want %d", restarted.cacheSizeInBytes, size)
+	}
+
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if f.Name() != diskLockFile {
+			names = append(names, f.Name())
+		}
+	}
+	if len(names) != 2 {
+		t.Errorf("directory contains %v, want only the metadata and body of the stored response", names)
+	}
+}
+
+func TestDiskCache_HandOff(t *testing.T) {
+	t.Parallel()
+	directory := t.TempDir()
+	r := newTestRoute(t, route.Route{NameID: "disk", Hostname: "example.com"})
+	request := func(path string) *http.Request {
+		return &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: path, Header: http.Header{}}
+	}
+
+	parent, err := NewDiskCache("test", directory, -1, config.CacheEvictionLRU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+	save(parent, r, request("/stored"), newTestResponse("stored", http.Header{"Cache-Control": {"max-age=60"}}))
+
+	inFlight := newTestResponse("in-flight", http.Header{"Cache-Control": {"max-age=60"}})
+	parent.Save(r, request("/in-flight"), inFlight)
+
+	if err := parent.HandOff(); err != nil {
+		t.Fatal(err)
+	}
+	if got := parent.Get(r, request("/stored")); got != nil {
+		got.Body.Close()
+		t.Error("Get() returned a response after the cache was handed off")
+	}
+	ioutil.ReadAll(inFlight.Body)
+	inFlight.Body.Close()
+	save(parent, r, request("/after"), newTestResponse("after", http.Header{"Cache-Control": {"max-age=60"}}))
+
+	child, err := NewDiskCache("test", directory, -1, config.CacheEvictionLRU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := child.Get(r, request("/stored"))
+	if got == nil || readBody(t, got) != "stored" {
+		t.Fatal("Get() of the new cache did not return the response stored before the hand off")
+	}
+	for _, path := range []string{"/in-flight", "/after"} {
+		if got := child.Get(r, request(path)); got != nil {
+			got.Body.Close()
+			t.Errorf("Get(%s) returned a response which was saved after the hand off", path)
+		}
+	}
+	if err := child.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := parent.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	got = parent.Get(r, request("/stored"))
+	if got == nil || readBody(t, got) != "stored" {
+		t.Error("Get() did not return the stored response after the cache was resumed")
+	}
+}
+
+func TestDiskCache_Eviction(t *testing.T) {
+	t.Parallel()
+	directory := t.TempDir()
+	r := newTestRoute(t, route.Route{NameID: "disk", Hostname: "example.com"})
+	request := func(path string) *http.Request {
+		return &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: path}
+	}
+
+	dc, err := NewDiskCache("test", directory, 1, config.CacheEvictionLRU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+
+	body := string(make([]byte, 300000))
+	for _, path := range []string{"/0", "/1", "/2"} {
+		save(dc, r, request(path), newTestResponse(body, http.Header{}))
+	}
+	if resp := dc.Get(r, request("/0")); resp != nil {
+		resp.Body.Close()
+	}
+	save(dc, r, request("/3"), newTestResponse(body, http.Header{}))
+
+	if resp := dc.Get(r, request("/1")); resp != nil {
+		resp.Body.Close()
+		t.Error("Get() returned the least recently used response")
+	}
+	if dc.cacheSizeInBytes > dc.maxCacheSizeInBytes {
+		t.Errorf("cache size %d exceeds the max size %d", dc.cacheSizeInBytes, dc.maxCacheSizeInBytes)
+	}
+
+	files, err := filepath.Glob(filepath.Join(directory, "*"+diskBodySuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("directory contains %d bodies, want 3", len(files))
+	}
+}
+
+func TestDiskCache_Refresh(t *testing.T) {
+	t.Parallel()
+	directory := t.TempDir()
+	r := newTestRoute(t, route.Route{NameID: "disk", Hostname: "example.com"})
+	request := &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/", Header: http.Header{}}
+
+	dc, err := NewDiskCache("test", directory, -1, config.CacheEvictionLRU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	save(dc, r, request, newTestResponse("hello", http.Header{"Etag": {`"v1"`}, "Cache-Control": {"max-age=0"}}))
+	stale := dc.GetStale(r, request)
+	if stale == nil {
+		t.Fatal("GetStale() returned no response")
+	}
+	stale.Body.Close()
+
+	refreshed := dc.Refresh(r, request, &http.Response{StatusCode: http.StatusNotModified, Header: http.Header{"Cache-Control": {"max-age=60"}}})
+	if refreshed == nil || readBody(t, refreshed) != "hello" {
+		t.Fatal("Refresh() did not return the stored body")
+	}
+	dc.Close()
+
+	restarted, err := NewDiskCache("test", directory, -1, config.CacheEvictionLRU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	got := restarted.Get(r, request)
+	if got == nil {
+		t.Fatal("Get() did not return the refreshed response after the restart")
+	}
+	readBody(t, got)
+}
+
+func TestNewDiskCache_InvalidDirectory(t *testing.T) {
+	t.Parallel()
+	file := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, directory := range []string{"", file} {
+		if _, err := NewDiskCache("test", directory, -1, config.CacheEvictionLRU); err == nil {
+			t.Errorf("NewDiskCache(%q) returned no error", directory)
+		}
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Error(err)
+	}
+}
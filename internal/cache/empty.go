@@ -17,3 +17,13 @@ func (Empty) Get(_ route.Route, _ *http.Request) *http.Response {
 // Save will always discard the request
 func (Empty) Save(route route.Route, _ *http.Request, response *http.Response) {
 }
+
+// GetStale will always return nil
+func (Empty) GetStale(_ route.Route, _ *http.Request) *StaleResponse {
+	return nil
+}
+
+// Refresh will always return nil
+func (Empty) Refresh(_ route.Route, _ *http.Request, _ *http.Response) *http.Response {
+	return nil
+}
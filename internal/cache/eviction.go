@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// entry of a shard or of the disk cache, the fields of the eviction policies are only used by the policy of the shard
+type entry struct {
+	id        string
+	primaryID string
+	response  response
+	size      int64
+	location  location
+	// file is the base name of the files of a response stored by the disk cache
+	file string
+
+	element *list.Element
+
+	frequency uint64
+	access    uint64
+	index     int
+}
+
+// evictionPolicy decides which entry of a shard will be removed first, once the cache is full
+type evictionPolicy interface {
+	add(e *entry)
+	touch(e *entry)
+	remove(e *entry)
+	victim() *entry
+}
+
+// lruPolicy evicts the least recently used entry
+type lruPolicy struct {
+	entries *list.List
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{entries: list.New()}
+}
+
+func (p *lruPolicy) add(e *entry) {
+	e.element = p.entries.PushFront(e)
+}
+
+func (p *lruPolicy) touch(e *entry) {
+	p.entries.MoveToFront(e.element)
+}
+
+func (p *lruPolicy) remove(e *entry) {
+	p.entries.Remove(e.element)
+	e.element = nil
+}
+
+func (p *lruPolicy) victim() *entry {
+	if back := p.entries.Back(); back != nil {
+		return back.Value.(*entry)
+	}
+	return nil
+}
+
+// lfuPolicy evicts the least frequently used entry, the least recently used one if several entries have the same frequency
+type lfuPolicy struct {
+	entries lfuHeap
+	clock   uint64
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{}
+}
+
+func (p *lfuPolicy) add(e *entry) {
+	p.clock++
+	e.frequency = 1
+	e.access = p.clock
+	heap.Push(&p.entries, e)
+}
+
+func (p *lfuPolicy) touch(e *entry) {
+	p.clock++
+	e.frequency++
+	e.access = p.clock
+	heap.Fix(&p.entries, e.index)
+}
+
+func (p *lfuPolicy) remove(e *entry) {
+	heap.Remove(&p.entries, e.index)
+}
+
+func (p *lfuPolicy) victim() *entry {
+	if len(p.entries) == 0 {
+		return nil
+	}
+	return p.entries[0]
+}
+
+type lfuHeap []*entry
+
+func (h lfuHeap) Len() int {
+	return len(h)
+}
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].frequency != h[j].frequency {
+		return h[i].frequency < h[j].frequency
+	}
+	return h[i].access < h[j].access
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	e.index = -1
+	return e
+}
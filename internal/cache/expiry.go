@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+type expiryItem struct {
+	shard    int
+	id       string
+	removeAt time.Time
+}
+
+// expiryScheduler removes stored responses at their removal time with a single goroutine for all entries.
+// Replaced entries are not removed from the schedule, the remove func has to compare the removal time.
+type expiryScheduler struct {
+	mtx    sync.Mutex
+	items  expiryHeap
+	wake   chan struct{}
+	stop   chan struct{}
+	remove func(item expiryItem)
+}
+
+func newExpiryScheduler(remove func(item expiryItem)) *expiryScheduler {
+	return &expiryScheduler{
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		remove: remove,
+	}
+}
+
+func (s *expiryScheduler) schedule(item expiryItem) {
+	s.mtx.Lock()
+	heap.Push(&s.items, item)
+	isNext := s.items[0] == item
+	s.mtx.Unlock()
+
+	if isNext {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run removes the due items until close is called
+func (s *expiryScheduler) run() {
+	for {
+		due, next, ok := s.popDue(time.Now())
+		for _, item := range due {
+			s.remove(item)
+		}
+
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if ok {
+			timer = time.NewTimer(time.Until(next))
+			timeout = timer.C
+		}
+
+		select {
+		case <-timeout:
+		case <-s.wake:
+		case <-s.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// popDue returns all items which have to be removed at now and the removal time of the next item
+func (s *expiryScheduler) popDue(now time.Time) ([]expiryItem, time.Time, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	due := make([]expiryItem, 0)
+	for len(s.items) > 0 && !s.items[0].removeAt.After(now) {
+		due = append(due, heap.Pop(&s.items).(expiryItem))
+	}
+	if len(s.items) == 0 {
+		return due, time.Time{}, false
+	}
+	return due, s.items[0].removeAt, true
+}
+
+func (s *expiryScheduler) close() {
+	close(s.stop)
+}
+
+type expiryHeap []expiryItem
+
+func (h expiryHeap) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].removeAt.Before(h[j].removeAt)
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	*h = append(*h, x.(expiryItem))
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
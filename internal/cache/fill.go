@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+	"github.com/fwiedmann/prox/internal/infra"
+)
+
+// fillSink receives the body of a response while it is streamed to the client
+type fillSink interface {
+	io.Writer
+	// commit stores the response once the whole body of the given size was written
+	commit(bodySize int64)
+	// abort discards everything written so far
+	abort()
+}
+
+// teeBody replaces the body of an upstream response. Everything read by the client will also be written to the sink of a cache.
+// The response is stored once the body was read until io.EOF. The fill is aborted if the body exceeds the limit,
+// the sink fails, reading the body fails or the body is closed before it was read completely.
+type teeBody struct {
+	body     io.ReadCloser
+	sink     fillSink
+	limit    int64
+	written  int64
+	finished bool
+}
+
+func newTeeBody(body io.ReadCloser, sink fillSink, limit int64) *teeBody {
+	return &teeBody{body: body, sink: sink, limit: limit}
+}
+
+// Read from the upstream body and write the read bytes to the sink
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if n > 0 && !t.finished {
+		t.written += int64(n)
+		if t.limit != -1 && t.written > t.limit {
+			t.finish(false)
+		} else if _, writeErr := t.sink.Write(p[:n]); writeErr != nil {
+			t.finish(false)
+		}
+	}
+
+	switch {
+	case err == io.EOF:
+		t.finish(true)
+	case err != nil:
+		t.finish(false)
+	}
+	return n, err
+}
+
+// Close the upstream body, an incomplete fill will be aborted
+func (t *teeBody) Close() error {
+	t.finish(false)
+	return t.body.Close()
+}
+
+func (t *teeBody) finish(complete bool) {
+	if t.finished {
+		return
+	}
+	t.finished = true
+	if complete {
+		t.sink.commit(t.written)
+		return
+	}
+	t.sink.abort()
+}
+
+// fillLimit is the max body size which can be stored for the route in a cache with the max size, -1 means infinite
+func fillLimit(route route.Route, maxSize int64) int64 {
+	limit := route.GetCacheMaxBodySizeInBytes()
+	if maxSize != -1 && (limit == -1 || maxSize < limit) {
+		limit = maxSize
+	}
+	return limit
+}
+
+// newFillResponse creates the stored response without its body. Returns false if the response would expire immediately.
+func newFillResponse(route route.Route, request *http.Request, resp *http.Response, now time.Time) (response, bool) {
+	header := resp.Header.Clone()
+	removeQualifiedFields(header, cachecontrol.Parse(resp.Header))
+	stored := response{
+		header:       header,
+		statusCode:   resp.StatusCode,
+		status:       resp.Status,
+		metricLabels: infra.RequestLabels(string(route.NameID), route.Port, request.Method),
+	}
+	stored.updateFreshness(now, route.GetCacheTimeOut())
+	retention := stored.retention(route)
+	if retention <= 0 {
+		return response{}, false
+	}
+	stored.removeAt = now.Add(retention)
+	return stored, true
+}
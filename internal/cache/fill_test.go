@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/config"
+)
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestSave_StreamingFill(t *testing.T) {
+	t.Parallel()
+	largeBody := string(make([]byte, 1000001))
+	tests := []struct {
+		name       string
+		route      route.Route
+		body       string
+		failing    bool
+		readAll    bool
+		wantBody   string
+		wantStored bool
+	}{
+		{
+			name:       "CompleteBody",
+			route:      route.Route{NameID: "fill", Hostname: "example.com"},
+			body:       "hello",
+			readAll:    true,
+			wantBody:   "hello",
+			wantStored: true,
+		},
+		{
+			name:       "BodyExceedsRouteLimit",
+			route:      route.Route{NameID: "fill", Hostname: "example.com", CacheMaxBodySizeInMegaBytes: 1},
+			body:       largeBody,
+			readAll:    true,
+			wantBody:   largeBody,
+			wantStored: false,
+		},
+		{
+			name:       "BodyClosedBeforeEOF",
+			route:      route.Route{NameID: "fill", Hostname: "example.com"},
+			body:       "hello",
+			readAll:    false,
+			wantStored: false,
+		},
+		{
+			name:       "BodyReadFails",
+			route:      route.Route{NameID: "fill", Hostname: "example.com"},
+			body:       "hello",
+			failing:    true,
+			readAll:    true,
+			wantBody:   "hello",
+			wantStored: false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			directory := t.TempDir()
+			dc, err := NewDiskCache("test", directory, -1, config.CacheEvictionLRU)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dc.Close()
+			hc := NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+			defer hc.Close()
+
+			r := newTestRoute(t, tt.route)
+			request := &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/"}
+			caches := map[string]interface {
+				Save(route.Route, *http.Request, *http.Response)
+				Get(route.Route, *http.Request) *http.Response
+			}{"memory": hc, "disk": dc}
+			for name, c := range caches {
+				var body io.Reader = bytes.NewBufferString(tt.body)
+				if tt.failing {
+					body = io.MultiReader(body, failingReader{})
+				}
+				resp := &http.Response{StatusCode: http.StatusOK, Status: "200 OK", ContentLength: -1, Header: http.Header{}, Body: ioutil.NopCloser(body)}
+				c.Save(r, request, resp)
+
+				if got := c.Get(r, request); got != nil {
+					t.Errorf("%s: Get() returned a response before the body was read", name)
+				}
+				if tt.readAll {
+					got, _ := ioutil.ReadAll(resp.Body)
+					if string(got) != tt.wantBody {
+						t.Errorf("%s: client read %d bytes, want %d", name, len(got), len(tt.wantBody))
+					}
+				} else {
+					_, _ = resp.Body.Read(make([]byte, 1))
+				}
+				resp.Body.Close()
+
+				got := c.Get(r, request)
+				if (got != nil) != tt.wantStored {
+					t.Errorf("%s: Get() returned a response %v, want %v", name, got != nil, tt.wantStored)
+				}
+				if got != nil {
+					if stored, _ := ioutil.ReadAll(got.Body); string(stored) != tt.wantBody {
+						t.Errorf("%s: stored body has %d bytes, want %d", name, len(stored), len(tt.wantBody))
+					}
+					got.Body.Close()
+				}
+			}
+
+			temporary, err := filepath.Glob(filepath.Join(directory, diskTempPrefix+"*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(temporary) != 0 {
+				t.Errorf("disk cache left temporary files %v", temporary)
+			}
+		})
+	}
+}
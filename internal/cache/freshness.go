@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+)
+
+// cacheableByDefault contains the status codes which can be stored without explicit freshness, see RFC 7231 section 6.1
+var cacheableByDefault = map[int]struct{}{
+	http.StatusOK:                   {},
+	http.StatusNonAuthoritativeInfo: {},
+	http.StatusNoContent:            {},
+	http.StatusMultipleChoices:      {},
+	http.StatusMovedPermanently:     {},
+	http.StatusNotFound:             {},
+	http.StatusMethodNotAllowed:     {},
+	http.StatusGone:                 {},
+	http.StatusRequestURITooLong:    {},
+	http.StatusNotImplemented:       {},
+}
+
+// isStorable checks the rules of RFC 7234 section 3 for a shared cache
+func isStorable(request *http.Request, resp *http.Response, directives cachecontrol.Directives) bool {
+	if resp.StatusCode == http.StatusNotModified || resp.StatusCode == http.StatusPartialContent {
+		return false
+	}
+
+	if _, ok := cacheableByDefault[resp.StatusCode]; !ok && !hasExplicitFreshness(resp.Header, directives) {
+		return false
+	}
+
+	if directives.Has(cachecontrol.NoStore) || cachecontrol.Parse(request.Header).Has(cachecontrol.NoStore) {
+		return false
+	}
+
+	if directives.Has(cachecontrol.Private) && len(directives.FieldNames(cachecontrol.Private)) == 0 {
+		return false
+	}
+
+	if request.Header.Get("Authorization") != "" && !directives.Has(cachecontrol.Public) && !directives.Has(cachecontrol.SMaxAge) && !directives.Has(cachecontrol.MustRevalidate) {
+		return false
+	}
+
+	for _, field := range varyFields(resp.Header) {
+		if field == "*" {
+			return false
+		}
+	}
+	return true
+}
+
+func hasExplicitFreshness(header http.Header, directives cachecontrol.Directives) bool {
+	return directives.Has(cachecontrol.MaxAge) || directives.Has(cachecontrol.SMaxAge) || header.Get("Expires") != ""
+}
+
+// freshnessLifetime calculates how long a response is fresh, see RFC 7234 section 4.2.1.
+// Responses with the status 200 and without explicit freshness are fresh for the defaultLifetime.
+func freshnessLifetime(statusCode int, header http.Header, directives cachecontrol.Directives, date time.Time, defaultLifetime time.Duration) time.Duration {
+	if directives.Has(cachecontrol.NoCache) && len(directives.FieldNames(cachecontrol.NoCache)) == 0 {
+		return 0
+	}
+	if sMaxAge, ok := directives.Duration(cachecontrol.SMaxAge); ok {
+		return sMaxAge
+	}
+	if maxAge, ok := directives.Duration(cachecontrol.MaxAge); ok {
+		return maxAge
+	}
+	if header.Get("Expires") != "" {
+		expires, ok := cachecontrol.ParseDate(header, "Expires")
+		if !ok || expires.Before(date) {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	if statusCode == http.StatusOK {
+		return defaultLifetime
+	}
+	return 0
+}
+
+// initialAge is the age of a response when it was received, see RFC 7234 section 4.2.3
+func initialAge(header http.Header, date, responseTime time.Time) time.Duration {
+	age := responseTime.Sub(date)
+	if age < 0 {
+		age = 0
+	}
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(header.Get("Age")), 10, 64); err == nil && time.Duration(seconds)*time.Second > age {
+		age = time.Duration(seconds) * time.Second
+	}
+	return age
+}
+
+// varyFields returns the sorted and canonical header names of all Vary headers
+func varyFields(header http.Header) []string {
+	fields := make([]string, 0)
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, http.CanonicalHeaderKey(field))
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// variantID extends the id of a stored response with the request values of the Vary header fields
+func variantID(id string, fields []string, request *http.Request) string {
+	if len(fields) == 0 {
+		return id
+	}
+	var b strings.Builder
+	b.WriteString(id)
+	for _, field := range fields {
+		b.WriteString("\n")
+		b.WriteString(field)
+		b.WriteString(":")
+		for i, value := range request.Header.Values(field) {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(strings.Join(strings.Fields(value), " "))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+	"github.com/fwiedmann/prox/internal/config"
+)
+
+func Test_freshnessLifetime(t *testing.T) {
+	t.Parallel()
+	date := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		statusCode int
+		header     http.Header
+		want       time.Duration
+	}{
+		{
+			name:       "SMaxAgeBeforeMaxAge",
+			statusCode: http.StatusOK,
+			header:     http.Header{"Cache-Control": {"max-age=60, s-maxage=120"}},
+			want:       120 * time.Second,
+		},
+		{
+			name:       "MaxAgeBeforeExpires",
+			statusCode: http.StatusOK,
+			header:     http.Header{"Cache-Control": {"max-age=60"}, "Expires": {date.Add(time.Hour).Format(http.TimeFormat)}},
+			want:       60 * time.Second,
+		},
+		{
+			name:       "Expires",
+			statusCode: http.StatusOK,
+			header:     http.Header{"Expires": {date.Add(time.Hour).Format(http.TimeFormat)}},
+			want:       time.Hour,
+		},
+		{
+			name:       "InvalidExpires",
+			statusCode: http.StatusOK,
+			header:     http.Header{"Expires": {"0"}},
+			want:       0,
+		},
+		{
+			name:       "NoCache",
+			statusCode: http.StatusOK,
+			header:     http.Header{"Cache-Control": {"no-cache, max-age=60"}},
+			want:       0,
+		},
+		{
+			name:       "DefaultLifetime",
+			statusCode: http.StatusOK,
+			header:     http.Header{},
+			want:       10 * time.Minute,
+		},
+		{
+			name:       "NoDefaultLifetimeForNotFound",
+			statusCode: http.StatusNotFound,
+			header:     http.Header{},
+			want:       0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := freshnessLifetime(tt.statusCode, tt.header, cachecontrol.Parse(tt.header), date, 10*time.Minute); got != tt.want {
+				t.Errorf("freshnessLifetime() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_response_isFresh(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	tests := []struct {
+		name          string
+		response      response
+		requestHeader http.Header
+		want          bool
+	}{
+		{
+			name:     "Fresh",
+			response: response{header: http.Header{}, responseTime: now.Add(-30 * time.Second), lifetime: time.Minute},
+			want:     true,
+		},
+		{
+			name:     "StaleByInitialAge",
+			response: response{header: http.Header{}, responseTime: now.Add(-30 * time.Second), initialAge: 40 * time.Second, lifetime: time.Minute},
+			want:     false,
+		},
+		{
+			name:          "RequestNoCache",
+			response:      response{header: http.Header{}, responseTime: now, lifetime: time.Minute},
+			requestHeader: http.Header{"Cache-Control": {"no-cache"}},
+			want:          false,
+		},
+		{
+			name:          "RequestPragmaNoCache",
+			response:      response{header: http.Header{}, responseTime: now, lifetime: time.Minute},
+			requestHeader: http.Header{"Pragma": {"no-cache"}},
+			want:          false,
+		},
+		{
+			name:          "RequestMaxAge",
+			response:      response{header: http.Header{}, responseTime: now.Add(-30 * time.Second), lifetime: time.Minute},
+			requestHeader: http.Header{"Cache-Control": {"max-age=10"}},
+			want:          false,
+		},
+		{
+			name:          "RequestMinFresh",
+			response:      response{header: http.Header{}, responseTime: now.Add(-30 * time.Second), lifetime: time.Minute},
+			requestHeader: http.Header{"Cache-Control": {"min-fresh=40"}},
+			want:          false,
+		},
+		{
+			name:          "RequestMaxStale",
+			response:      response{header: http.Header{}, responseTime: now.Add(-90 * time.Second), lifetime: time.Minute},
+			requestHeader: http.Header{"Cache-Control": {"max-stale=60"}},
+			want:          true,
+		},
+		{
+			name:          "MaxStaleWithMustRevalidate",
+			response:      response{header: http.Header{"Cache-Control": {"must-revalidate"}}, responseTime: now.Add(-90 * time.Second), lifetime: time.Minute},
+			requestHeader: http.Header{"Cache-Control": {"max-stale"}},
+			want:          false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.response.isFresh(now, cachecontrol.Parse(tt.requestHeader)); got != tt.want {
+				t.Errorf("isFresh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPInMemoryCache_Vary(t *testing.T) {
+	t.Parallel()
+	r := &route.Route{NameID: "vary", Hostname: "example.com", CacheEnabled: true}
+	if err := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute).CreateRoute(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	hc := NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+	defer hc.Close()
+
+	gzipRequest := &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/", Header: http.Header{"Accept-Encoding": {"gzip"}}}
+	save(hc, *r, gzipRequest, &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Vary": {"Accept-Encoding"}, "Cache-Control": {"max-age=60"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString("gzip")),
+	})
+
+	if got := hc.Get(*r, gzipRequest); got == nil {
+		t.Error("Get() returned no response for the same variant")
+	}
+	if got := hc.Get(*r, &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/", Header: http.Header{"Accept-Encoding": {"br"}}}); got != nil {
+		t.Error("Get() returned a response of another variant")
+	}
+}
+
+func TestHTTPInMemoryCache_Refresh(t *testing.T) {
+	t.Parallel()
+	r := &route.Route{NameID: "refresh", Hostname: "example.com", CacheEnabled: true}
+	if err := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute).CreateRoute(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+
+	hc := NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+	defer hc.Close()
+
+	request := &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/", Header: http.Header{}}
+	save(hc, *r, request, &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": {`"v1"`}, "Cache-Control": {"max-age=0"}, "X-Version": {"1"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString("body")),
+	})
+
+	if got := hc.Get(*r, request); got != nil {
+		t.Fatal("Get() returned a stale response")
+	}
+	stale := hc.GetStale(*r, request)
+	if stale == nil {
+		t.Fatal("GetStale() returned no response")
+	}
+
+	refreshed := hc.Refresh(*r, request, &http.Response{StatusCode: http.StatusNotModified, Header: http.Header{"Cache-Control": {"max-age=60"}, "X-Version": {"2"}}})
+	if refreshed == nil {
+		t.Fatal("Refresh() returned no response")
+	}
+	body, _ := ioutil.ReadAll(refreshed.Body)
+	if refreshed.StatusCode != http.StatusOK || string(body) != "body" || refreshed.Header.Get("X-Version") != "2" {
+		t.Errorf("Refresh() returned status %d, body %q and version %q, want the stored body with the updated headers", refreshed.StatusCode, body, refreshed.Header.Get("X-Version"))
+	}
+	if got := hc.Get(*r, request); got == nil || got.Header.Get(httpAgeHeader) != "0" {
+		t.Error("Get() returned no fresh response with an age after the refresh")
+	}
+}
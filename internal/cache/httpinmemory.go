@@ -2,116 +2,371 @@ package cache
 
 import (
 	"bytes"
-	"fmt"
-	"io/ioutil"
+	"hash/fnv"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+	"github.com/fwiedmann/prox/internal/config"
 	"github.com/fwiedmann/prox/internal/infra"
 
 	"github.com/fwiedmann/prox/domain/entity/route"
 )
 
-type response struct {
-	body          []byte
-	contentLength int64
-	header        http.Header
-	statusCode    int
-	status        string
+const megaBytesToBytesMultiplier = 1e+6
+const shardCount = 16
+
+// shard contains a part of the stored responses with its own lock and eviction policy.
+// All variants of a request are stored in the same shard.
+type shard struct {
+	mtx     sync.Mutex
+	entries map[string]*entry
+	vary    map[string]varyFieldsOfVariants
+	policy  evictionPolicy
 }
 
-const megaBytesToBytesMultiplier = 1e+6
-const httpInMemoryCacheHeader = "x-cached-by-prox"
-const httpContentTypeHeader = "Content-Type"
+// varyFieldsOfVariants are the Vary header fields of the stored variants of a request
+type varyFieldsOfVariants struct {
+	fields   []string
+	variants int
+}
 
-// NewHTTPInMemoryCache creates a new http cache which stores http responses in memory
-func NewHTTPInMemoryCache(maxCacheSizeInMegaBytes int64) *HTTPInMemoryCache {
-	infra.HTTPInMemCacheMaxSizeInBytes.Set(float64(maxCacheSizeInMegaBytes))
-	return &HTTPInMemoryCache{
-		store:               make(map[string]response),
-		maxCacheSizeInBytes: maxCacheSizeInMegaBytes * megaBytesToBytesMultiplier,
+// NewHTTPInMemoryCache creates a new http cache which stores http responses in memory.
+// Once the cache is full, responses will be evicted with the given policy, "lru" or "lfu". The size metrics are labeled with the port name.
+func NewHTTPInMemoryCache(port string, maxCacheSizeInMegaBytes int64, eviction string) *HTTPInMemoryCache {
+	hc := &HTTPInMemoryCache{
+		port:   port,
+		shards: make([]*shard, shardCount),
+	}
+	for i := range hc.shards {
+		hc.shards[i] = &shard{
+			entries: make(map[string]*entry),
+			vary:    make(map[string]varyFieldsOfVariants),
+			policy:  newEvictionPolicy(eviction),
+		}
 	}
+	hc.expiry = newExpiryScheduler(hc.expire)
+	hc.setMaxSize(maxCacheSizeInMegaBytes)
+	go hc.expiry.run()
+	return hc
 }
 
-// HTTPInMemoryCache stores http responses in memory for a defined duration
+func newEvictionPolicy(eviction string) evictionPolicy {
+	if eviction == config.CacheEvictionLFU {
+		return newLFUPolicy()
+	}
+	return newLRUPolicy()
+}
+
+// HTTPInMemoryCache stores http responses in memory as long as they are fresh or can be revalidated, see RFC 7234.
+// The size of the stored bodies and headers is limited, the least recently or least frequently used responses will be evicted.
 type HTTPInMemoryCache struct {
-	store               map[string]response
-	mtx                 sync.RWMutex
+	shards              []*shard
 	maxCacheSizeInBytes int64
 	cacheSizeInBytes    int64
+	nextVictimShard     uint32
+	expiry              *expiryScheduler
+	closeOnce           sync.Once
+	port                string
 }
 
-// Get return a stored in memory response. If no response was found nil will be returned
+// Get return a stored in memory response which is fresh for the request. If no fresh response was found nil will be returned
 func (hc *HTTPInMemoryCache) Get(route route.Route, request *http.Request) *http.Response {
-	hc.mtx.RLock()
-	defer hc.mtx.RUnlock()
+	id := BuildID(route, request)
+	s := hc.shardFor(id)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
 
-	if val, ok := hc.store[buildID(route, request)]; ok {
-		if val.contentLength > 0 {
-			hc.cacheSizeInBytes -= val.contentLength
-		}
-		val.header.Set(httpInMemoryCacheHeader, "true")
-
-		return &http.Response{
-			Body:          ioutil.NopCloser(bytes.NewBuffer(val.body)),
-			ContentLength: val.contentLength,
-			Header:        val.header,
-			StatusCode:    val.statusCode,
-			Status:        val.status,
-		}
+	now := time.Now()
+	if e, ok := s.lookup(id, request); ok && e.response.isFresh(now, cachecontrol.Parse(request.Header)) {
+		s.policy.touch(e)
+		return e.response.toHTTPResponse(now)
 	}
 	return nil
 }
 
-// Save a http request with its body in memory. The route.NameID, http.Request.Hostname and http.Request.RequestURI will be used to generate an ID.
+// GetStale returns a stored response which is not fresh for the request and has to be revalidated.
+// If no response was found or the response is fresh nil will be returned.
+func (hc *HTTPInMemoryCache) GetStale(route route.Route, request *http.Request) *StaleResponse {
+	id := BuildID(route, request)
+	s := hc.shardFor(id)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := time.Now()
+	requestDirectives := cachecontrol.Parse(request.Header)
+	if e, ok := s.lookup(id, request); ok && !e.response.isFresh(now, requestDirectives) {
+		return e.response.toStaleResponse(route, now, requestDirectives)
+	}
+	return nil
+}
+
+// Save a http request with its body in memory. The route.NameID, http.Request.Host including the port, http.Request.RequestURI and the
+// request headers listed in the Vary header of the response will be used to generate an ID.
+// The body of the response is replaced and stored while it is read, the response is stored once the body was read completely.
 func (hc *HTTPInMemoryCache) Save(route route.Route, request *http.Request, resp *http.Response) {
 	if !hc.isValidateSave(route, request, resp) {
 		return
 	}
 
-	hc.mtx.Lock()
-	defer hc.mtx.Unlock()
+	stored, ok := newFillResponse(route, request, resp, time.Now())
+	if !ok {
+		return
+	}
+
+	primaryID := BuildID(route, request)
+	fields := varyFields(resp.Header)
+	sink := &memorySink{
+		hc:        hc,
+		route:     route,
+		primaryID: primaryID,
+		id:        variantID(primaryID, fields, request),
+		fields:    fields,
+		location:  newLocation(route, request),
+		stored:    stored,
+	}
+	resp.Body = newTeeBody(resp.Body, sink, fillLimit(route, atomic.LoadInt64(&hc.maxCacheSizeInBytes)))
+}
+
+// memorySink buffers the body of a response which will be stored in a HTTPInMemoryCache
+type memorySink struct {
+	hc        *HTTPInMemoryCache
+	route     route.Route
+	primaryID string
+	id        string
+	fields    []string
+	location  location
+	stored    response
+	body      bytes.Buffer
+}
+
+func (ms *memorySink) Write(p []byte) (int, error) {
+	return ms.body.Write(p)
+}
+
+func (ms *memorySink) commit(bodySize int64) {
+	stored := ms.stored
+	stored.body = ms.body.Bytes()
+	stored.contentLength = bodySize
+	ms.hc.store(ms.route, &entry{id: ms.id, primaryID: ms.primaryID, response: stored, location: ms.location}, ms.fields)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+func (ms *memorySink) abort() {
+	ms.body = bytes.Buffer{}
+}
+
+// store adds the entry of a response with a complete body to its shard, responses which do not fit into the limits are discarded
+func (hc *HTTPInMemoryCache) store(route route.Route, e *entry, fields []string) {
+	e.size = e.response.size()
+	if !hc.fits(route, e.response.contentLength, e.size) {
 		return
 	}
 
-	resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	hc.evict(e.size)
+	s := hc.shardFor(e.primaryID)
+	s.mtx.Lock()
+	if previous, ok := s.entries[e.id]; ok {
+		hc.removeEntry(s, previous)
+	}
+	s.entries[e.id] = e
+	s.policy.add(e)
+	variants := s.vary[e.primaryID]
+	variants.fields = fields
+	variants.variants++
+	s.vary[e.primaryID] = variants
+	hc.addSize(e.size)
+	s.mtx.Unlock()
+
+	infra.CacheStores.With(e.response.metricLabels).Inc()
+	hc.expiry.schedule(expiryItem{shard: hc.shardIndex(e.primaryID), id: e.id, removeAt: e.response.removeAt})
+	hc.evict(0)
+}
 
-	id := buildID(route, request)
-	hc.store[id] = response{
-		body:          body,
-		contentLength: resp.ContentLength,
-		header:        resp.Header,
-		statusCode:    resp.StatusCode,
-		status:        resp.Status,
+// Refresh updates a stored response with the headers of a 304 Not Modified upstream response to a revalidation, see RFC 7234 section 4.3.4.
+// Returns the updated response or nil if no response was stored.
+func (hc *HTTPInMemoryCache) Refresh(route route.Route, request *http.Request, notModified *http.Response) *http.Response {
+	primaryID := BuildID(route, request)
+	s := hc.shardFor(primaryID)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.lookup(primaryID, request)
+	if !ok {
+		return nil
 	}
 
-	if resp.ContentLength > 0 {
-		hc.cacheSizeInBytes += resp.ContentLength
-		infra.HTTPInMemCacheCurrentSizeInBytes.Set(float64(hc.cacheSizeInBytes))
+	now := time.Now()
+	refreshed := e.response
+	refreshed.refresh(notModified, now, route.GetCacheTimeOut())
+	retention := refreshed.retention(route)
+	if retention <= 0 || cachecontrol.Parse(refreshed.header).Has(cachecontrol.NoStore) {
+		hc.removeEntry(s, e)
+		return refreshed.toHTTPResponse(now)
 	}
 
-	go hc.deleteStoredResponseAfterTimeout(id, route.GetCacheTimeOut())
+	refreshed.removeAt = now.Add(retention)
+	size := refreshed.size()
+	hc.addSize(size - e.size)
+	e.response = refreshed
+	e.size = size
+	s.policy.touch(e)
+	hc.expiry.schedule(expiryItem{shard: hc.shardIndex(primaryID), id: e.id, removeAt: refreshed.removeAt})
+	return refreshed.toHTTPResponse(now)
 }
 
 func (hc *HTTPInMemoryCache) isValidateSave(route route.Route, request *http.Request, resp *http.Response) bool {
-	if request.Method != http.MethodGet {
-		return false
+	return isValidSave(route, request, resp) && hc.fits(route, resp.ContentLength, resp.ContentLength)
+}
+
+// fits checks if a body and a stored response of the given sizes are within the limits of the route and the cache
+func (hc *HTTPInMemoryCache) fits(route route.Route, bodySize, size int64) bool {
+	return fitsLimits(route, atomic.LoadInt64(&hc.maxCacheSizeInBytes), bodySize, size)
+}
+
+// Entries returns the stored responses which match the filter sorted by their key
+func (hc *HTTPInMemoryCache) Entries(filter Filter) []Entry {
+	now := time.Now()
+	entries := make([]Entry, 0)
+	for _, s := range hc.shards {
+		s.mtx.Lock()
+		for _, e := range s.entries {
+			if filter.matches(e) {
+				entries = append(entries, e.describe(now))
+			}
+		}
+		s.mtx.Unlock()
 	}
+	sortEntries(entries)
+	return entries
+}
 
-	if !isValidResponseCode(resp.StatusCode) {
-		return false
+// Purge removes the stored responses which match the filter and returns their number
+func (hc *HTTPInMemoryCache) Purge(filter Filter) int {
+	var purged int
+	for _, s := range hc.shards {
+		s.mtx.Lock()
+		for _, e := range s.entries {
+			if filter.matches(e) {
+				hc.removeEntry(s, e)
+				purged++
+			}
+		}
+		s.mtx.Unlock()
+	}
+	return purged
+}
+
+// Resize changes the max size of the cache. Responses will be evicted until the stored responses fit into the new size.
+func (hc *HTTPInMemoryCache) Resize(maxCacheSizeInMegaBytes int64) {
+	hc.setMaxSize(maxCacheSizeInMegaBytes)
+	hc.evict(0)
+}
+
+// Close stops the expiry of all stored responses
+func (hc *HTTPInMemoryCache) Close() error {
+	hc.closeOnce.Do(func() {
+		hc.expiry.close()
+		infra.HTTPInMemCacheMaxSizeInBytes.DeleteLabelValues(hc.port)
+		infra.HTTPInMemCacheCurrentSizeInBytes.DeleteLabelValues(hc.port)
+	})
+	return nil
+}
+
+func (hc *HTTPInMemoryCache) setMaxSize(maxCacheSizeInMegaBytes int64) {
+	maxSize := maxSizeInBytes(maxCacheSizeInMegaBytes)
+	atomic.StoreInt64(&hc.maxCacheSizeInBytes, maxSize)
+	infra.HTTPInMemCacheMaxSizeInBytes.WithLabelValues(hc.port).Set(float64(maxSize))
+}
+
+// evict removes the entries chosen by the eviction policies of the shards until the reserved bytes fit into the max size of the cache.
+// The shards will be locked one after another, the evicted entry is the victim of one shard and not of the whole cache.
+func (hc *HTTPInMemoryCache) evict(reserve int64) {
+	next := atomic.AddUint32(&hc.nextVictimShard, 1)
+	for emptyShards := 0; emptyShards < len(hc.shards); {
+		maxSize := atomic.LoadInt64(&hc.maxCacheSizeInBytes)
+		if maxSize == -1 || atomic.LoadInt64(&hc.cacheSizeInBytes)+reserve <= maxSize {
+			return
+		}
+
+		s := hc.shards[next%uint32(len(hc.shards))]
+		next++
+		s.mtx.Lock()
+		victim := s.policy.victim()
+		if victim == nil {
+			emptyShards++
+		} else {
+			emptyShards = 0
+			hc.removeEntry(s, victim)
+			infra.CacheEvictions.With(victim.response.metricLabels).Inc()
+		}
+		s.mtx.Unlock()
+	}
+}
+
+// expire removes a scheduled entry, if it was not replaced by an entry with a different removal time
+func (hc *HTTPInMemoryCache) expire(item expiryItem) {
+	s := hc.shards[item.shard]
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.entries[item.id]
+	if !ok || !e.response.removeAt.Equal(item.removeAt) {
+		return
+	}
+	hc.removeEntry(s, e)
+	infra.CacheEvictions.With(e.response.metricLabels).Inc()
+}
+
+// removeEntry of the locked shard
+func (hc *HTTPInMemoryCache) removeEntry(s *shard, e *entry) {
+	delete(s.entries, e.id)
+	s.policy.remove(e)
+	if variants := s.vary[e.primaryID]; variants.variants <= 1 {
+		delete(s.vary, e.primaryID)
+	} else {
+		variants.variants--
+		s.vary[e.primaryID] = variants
 	}
+	hc.addSize(-e.size)
+}
+
+func (hc *HTTPInMemoryCache) addSize(delta int64) {
+	infra.HTTPInMemCacheCurrentSizeInBytes.WithLabelValues(hc.port).Set(float64(atomic.AddInt64(&hc.cacheSizeInBytes, delta)))
+}
+
+func (hc *HTTPInMemoryCache) shardIndex(primaryID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(primaryID))
+	return int(h.Sum32() % uint32(len(hc.shards)))
+}
 
-	if hc.maxCacheSizeInBytes-hc.cacheSizeInBytes <= resp.ContentLength && hc.maxCacheSizeInBytes != -1 {
+func (hc *HTTPInMemoryCache) shardFor(primaryID string) *shard {
+	return hc.shards[hc.shardIndex(primaryID)]
+}
+
+// lookup returns the stored variant which matches the request
+func (s *shard) lookup(primaryID string, request *http.Request) (*entry, bool) {
+	e, ok := s.entries[variantID(primaryID, s.vary[primaryID].fields, request)]
+	return e, ok
+}
+
+// maxSizeInBytes converts the configured size, sizes less than or equal to zero mean an infinite size which is represented by -1
+func maxSizeInBytes(maxCacheSizeInMegaBytes int64) int64 {
+	if maxCacheSizeInMegaBytes <= 0 {
+		return -1
+	}
+	return maxCacheSizeInMegaBytes * megaBytesToBytesMultiplier
+}
+
+// isValidSave checks if the response to the request can be stored for the route
+func isValidSave(route route.Route, request *http.Request, resp *http.Response) bool {
+	if request.Method != http.MethodGet {
 		return false
 	}
 
-	if route.GetCacheMaxBodySizeInBytes() < resp.ContentLength && route.GetCacheMaxBodySizeInBytes() != -1 {
+	if !isStorable(request, resp, cachecontrol.Parse(resp.Header)) {
 		return false
 	}
 
@@ -121,24 +376,16 @@ func (hc *HTTPInMemoryCache) isValidateSave(route route.Route, request *http.Req
 	return true
 }
 
-func (hc *HTTPInMemoryCache) deleteStoredResponseAfterTimeout(id string, duration time.Duration) {
-	time.Sleep(duration)
-	hc.mtx.Lock()
-	defer hc.mtx.Unlock()
-	hc.cacheSizeInBytes -= hc.store[id].contentLength
-	delete(hc.store, id)
-	infra.HTTPInMemCacheCurrentSizeInBytes.Set(float64(hc.cacheSizeInBytes))
-}
+// fitsLimits checks if a body and a stored response of the given sizes are within the limits of the route and a cache with the max size
+func fitsLimits(route route.Route, maxSize, bodySize, size int64) bool {
+	if maxSize != -1 && size > maxSize {
+		return false
+	}
 
-func isValidResponseCode(code int) bool {
-	switch code {
-	case http.StatusOK:
-		return true
-	case http.StatusNotModified:
-		return true
-	default:
+	if route.GetCacheMaxBodySizeInBytes() < bodySize && route.GetCacheMaxBodySizeInBytes() != -1 {
 		return false
 	}
+	return true
 }
 
 func isValidContentType(r *http.Response, allowedContentTypes []string) bool {
@@ -154,11 +401,3 @@ func isValidContentType(r *http.Response, allowedContentTypes []string) bool {
 	}
 	return false
 }
-
-func buildID(route route.Route, clientRequest *http.Request) string {
-	path := "/"
-	if clientRequest.RequestURI != "" {
-		path = clientRequest.RequestURI
-	}
-	return fmt.Sprintf("%s-%s-%s", route.NameID, clientRequest.Host, path)
-}
@@ -3,88 +3,91 @@ package cache
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/config"
 )
 
-func TestHTTPInMemoryCache_Get(t *testing.T) {
-	t.Parallel()
-	type fields struct {
-		store               map[string]response
-		mtx                 sync.RWMutex
-		maxCacheSizeInBytes int64
-		cacheSizeInBytes    int64
+func newTestRoute(t *testing.T, r route.Route) route.Route {
+	t.Helper()
+	if err := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute).CreateRoute(context.Background(), &r); err != nil {
+		t.Fatal(err)
 	}
-	type args struct {
-		route   route.Route
-		request *http.Request
+	return r
+}
+
+func newTestResponse(body string, header http.Header) *http.Response {
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: header, ContentLength: int64(len(body)), Body: ioutil.NopCloser(bytes.NewBufferString(body))}
+}
+
+// save stores the response and reads its body completely like the proxy does
+func save(c interface {
+	Save(route.Route, *http.Request, *http.Response)
+}, r route.Route, request *http.Request, resp *http.Response) {
+	c.Save(r, request, resp)
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func (hc *HTTPInMemoryCache) len() int {
+	var count int
+	for _, s := range hc.shards {
+		s.mtx.Lock()
+		count += len(s.entries)
+		s.mtx.Unlock()
 	}
+	return count
+}
+
+func TestHTTPInMemoryCache_Get(t *testing.T) {
+	t.Parallel()
+	r := newTestRoute(t, route.Route{NameID: "test-route", Hostname: "test.com"})
 	tests := []struct {
-		name               string
-		fields             fields
-		args               args
-		wantNil            bool
-		cacheSizeAfterExec int64
+		name    string
+		stored  *http.Response
+		wantNil bool
 	}{
 		{
-			name: "NilResponse",
-			fields: fields{
-				store:               map[string]response{},
-				mtx:                 sync.RWMutex{},
-				maxCacheSizeInBytes: 0,
-				cacheSizeInBytes:    2,
-			},
-			args: args{
-				route:   route.Route{NameID: "test-route"},
-				request: &http.Request{Host: "test.com", RequestURI: "/hello", ContentLength: 1},
-			},
-			wantNil:            true,
-			cacheSizeAfterExec: 2,
+			name:    "NilResponse",
+			wantNil: true,
 		},
 		{
-			name: "ValidReturn",
-			fields: fields{
-				store:               map[string]response{"test-route-test.com-/hello": {contentLength: 1, header: map[string][]string{httpInMemoryCacheHeader: {"true"}}}},
-				mtx:                 sync.RWMutex{},
-				maxCacheSizeInBytes: 0,
-				cacheSizeInBytes:    2,
-			},
-			args: args{
-				route:   route.Route{NameID: "test-route"},
-				request: &http.Request{Host: "test.com", RequestURI: "/hello", ContentLength: 1},
-			},
-			wantNil:            false,
-			cacheSizeAfterExec: 1,
+			name:    "ValidReturn",
+			stored:  newTestResponse("hello", http.Header{}),
+			wantNil: false,
 		},
 	}
-	for _, tt := range tests { //nolint
+	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			hc := &HTTPInMemoryCache{
-				store:               tt.fields.store,
-				mtx:                 tt.fields.mtx, //nolint
-				maxCacheSizeInBytes: tt.fields.maxCacheSizeInBytes,
-				cacheSizeInBytes:    tt.fields.cacheSizeInBytes,
+			hc := NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+			defer hc.Close()
+			request := &http.Request{Method: http.MethodGet, Host: "test.com", RequestURI: "/hello"}
+			if tt.stored != nil {
+				save(hc, r, request, tt.stored)
 			}
-			got := hc.Get(tt.args.route, tt.args.request)
-			if got != nil && tt.wantNil {
+			sizeBefore := hc.cacheSizeInBytes
+
+			got := hc.Get(r, request)
+			if (got == nil) != tt.wantNil {
 				t.Errorf("Get() = %v, wantNil %v", got, tt.wantNil)
 			}
 
-			if tt.cacheSizeAfterExec != hc.cacheSizeInBytes {
-				t.Error("did not update cacheSizeAfterExec ")
+			if sizeBefore != hc.cacheSizeInBytes {
+				t.Error("Get() changed the cache size")
 			}
 
 			if got != nil {
 				if got.Header.Get(httpInMemoryCacheHeader) == "" {
 					t.Error("Get() did not set the cache header")
 				}
-
 			}
-
 		})
 	}
 }
@@ -92,10 +95,7 @@ func TestHTTPInMemoryCache_Get(t *testing.T) {
 func TestHTTPInMemoryCache_isValidateSave(t *testing.T) {
 	t.Parallel()
 	type fields struct {
-		store               map[string]response
-		mtx                 sync.RWMutex
 		maxCacheSizeInBytes int64
-		cacheSizeInBytes    int64
 	}
 	type args struct {
 		route   route.Route
@@ -163,14 +163,101 @@ func TestHTTPInMemoryCache_isValidateSave(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name:   "responseNoStore",
+			fields: fields{maxCacheSizeInBytes: -1},
+			args: args{
+				request: &http.Request{Method: http.MethodGet},
+				resp:    &http.Response{StatusCode: 200, Header: map[string][]string{"Cache-Control": {"no-store"}}},
+				route:   route.Route{NameID: "test-route", Hostname: "docker.com"},
+			},
+			want: false,
+		},
+		{
+			name:   "requestNoStore",
+			fields: fields{maxCacheSizeInBytes: -1},
+			args: args{
+				request: &http.Request{Method: http.MethodGet, Header: map[string][]string{"Cache-Control": {"no-store"}}},
+				resp:    &http.Response{StatusCode: 200},
+				route:   route.Route{NameID: "test-route", Hostname: "docker.com"},
+			},
+			want: false,
+		},
+		{
+			name:   "private",
+			fields: fields{maxCacheSizeInBytes: -1},
+			args: args{
+				request: &http.Request{Method: http.MethodGet},
+				resp:    &http.Response{StatusCode: 200, Header: map[string][]string{"Cache-Control": {"private, max-age=60"}}},
+				route:   route.Route{NameID: "test-route", Hostname: "docker.com"},
+			},
+			want: false,
+		},
+		{
+			name:   "qualifiedPrivate",
+			fields: fields{maxCacheSizeInBytes: -1},
+			args: args{
+				request: &http.Request{Method: http.MethodGet},
+				resp:    &http.Response{StatusCode: 200, Header: map[string][]string{"Cache-Control": {`private="Set-Cookie", max-age=60`}}},
+				route:   route.Route{NameID: "test-route", Hostname: "docker.com"},
+			},
+			want: true,
+		},
+		{
+			name:   "authorizationWithoutPublic",
+			fields: fields{maxCacheSizeInBytes: -1},
+			args: args{
+				request: &http.Request{Method: http.MethodGet, Header: map[string][]string{"Authorization": {"Basic dXNlcjpwYXNz"}}},
+				resp:    &http.Response{StatusCode: 200, Header: map[string][]string{"Cache-Control": {"max-age=60"}}},
+				route:   route.Route{NameID: "test-route", Hostname: "docker.com"},
+			},
+			want: false,
+		},
+		{
+			name:   "authorizationWithPublic",
+			fields: fields{maxCacheSizeInBytes: -1},
+			args: args{
+				request: &http.Request{Method: http.MethodGet, Header: map[string][]string{"Authorization": {"Basic dXNlcjpwYXNz"}}},
+				resp:    &http.Response{StatusCode: 200, Header: map[string][]string{"Cache-Control": {"public, max-age=60"}}},
+				route:   route.Route{NameID: "test-route", Hostname: "docker.com"},
+			},
+			want: true,
+		},
+		{
+			name:   "varyAll",
+			fields: fields{maxCacheSizeInBytes: -1},
+			args: args{
+				request: &http.Request{Method: http.MethodGet},
+				resp:    &http.Response{StatusCode: 200, Header: map[string][]string{"Vary": {"*"}}},
+				route:   route.Route{NameID: "test-route", Hostname: "docker.com"},
+			},
+			want: false,
+		},
+		{
+			name:   "notModified",
+			fields: fields{maxCacheSizeInBytes: -1},
+			args: args{
+				request: &http.Request{Method: http.MethodGet},
+				resp:    &http.Response{StatusCode: 304},
+				route:   route.Route{NameID: "test-route", Hostname: "docker.com"},
+			},
+			want: false,
+		},
+		{
+			name:   "notFoundWithMaxAge",
+			fields: fields{maxCacheSizeInBytes: -1},
+			args: args{
+				request: &http.Request{Method: http.MethodGet},
+				resp:    &http.Response{StatusCode: 404, Header: map[string][]string{"Cache-Control": {"max-age=60"}}},
+				route:   route.Route{NameID: "test-route", Hostname: "docker.com"},
+			},
+			want: true,
+		},
 	}
-	for _, tt := range tests { //nolint
+	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			hc := &HTTPInMemoryCache{
-				store:               tt.fields.store,
-				mtx:                 tt.fields.mtx, //nolint
 				maxCacheSizeInBytes: tt.fields.maxCacheSizeInBytes,
-				cacheSizeInBytes:    tt.fields.cacheSizeInBytes,
 			}
 
 			m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
@@ -180,23 +267,7 @@ func TestHTTPInMemoryCache_isValidateSave(t *testing.T) {
 				return
 			}
 
-			routes, err := m.ListRoutes(context.Background())
-			if err != nil {
-				t.Error(err)
-				return
-			}
-			var routeToUse *route.Route
-			for _, r := range routes {
-				if r.NameID == tt.args.route.NameID {
-					routeToUse = r
-				}
-			}
-			if routeToUse == nil {
-				t.Error("route is empty")
-				return
-			}
-
-			if got := hc.isValidateSave(*routeToUse, tt.args.request, tt.args.resp); got != tt.want {
+			if got := hc.isValidateSave(tt.args.route, tt.args.request, tt.args.resp); got != tt.want {
 				t.Errorf("isValidateSave() = %v, want %v", got, tt.want)
 			}
 		})
@@ -205,101 +276,172 @@ func TestHTTPInMemoryCache_isValidateSave(t *testing.T) {
 
 func TestHTTPInMemoryCache_Save(t *testing.T) {
 	t.Parallel()
-	type fields struct {
-		store               map[string]response
-		mtx                 sync.RWMutex
-		maxCacheSizeInBytes int64
-		cacheSizeInBytes    int64
-	}
-	type args struct {
-		route   route.Route
-		request *http.Request
-		resp    *http.Response
-	}
 	tests := []struct {
 		name                string
-		fields              fields
-		args                args
+		maxCacheSizeInMB    int64
+		route               route.Route
+		resp                *http.Response
 		storeCountAfterSave int
 		cacheSizeAfterSave  int64
 	}{
-
 		{
-			name: "InvalidSave",
-			fields: fields{
-				store:               map[string]response{},
-				mtx:                 sync.RWMutex{},
-				maxCacheSizeInBytes: 0,
-				cacheSizeInBytes:    0,
-			},
-			args: args{
-				request: &http.Request{Method: http.MethodGet},
-				resp:    &http.Response{StatusCode: 200, ContentLength: 15000},
-				route:   route.Route{NameID: "test-route", CacheMaxBodySizeInMegaBytes: 10, Hostname: "docker.com"},
-			},
+			name:                "InvalidSave",
+			route:               route.Route{NameID: "test-route", CacheMaxBodySizeInMegaBytes: 10, Hostname: "docker.com"},
+			resp:                &http.Response{StatusCode: 200, ContentLength: 15000000, Body: ioutil.NopCloser(bytes.NewBuffer([]byte{1}))},
 			storeCountAfterSave: 0,
 			cacheSizeAfterSave:  0,
 		},
 		{
-			name: "ValidSave",
-			fields: fields{
-				store:               map[string]response{},
-				mtx:                 sync.RWMutex{},
-				maxCacheSizeInBytes: 1000000000000,
-				cacheSizeInBytes:    0,
-			},
-			args: args{
-				request: &http.Request{Method: http.MethodGet},
-				resp:    &http.Response{StatusCode: 200, ContentLength: 15000, Body: ioutil.NopCloser(bytes.NewBuffer([]byte{1}))},
-				route:   route.Route{NameID: "test-route", CacheMaxBodySizeInMegaBytes: 1000, Hostname: "docker.com"},
-			},
+			name:                "ValidSave",
+			maxCacheSizeInMB:    1000,
+			route:               route.Route{NameID: "test-route", CacheMaxBodySizeInMegaBytes: 1000, Hostname: "docker.com"},
+			resp:                &http.Response{StatusCode: 200, Status: "200 OK", ContentLength: 15000, Body: ioutil.NopCloser(bytes.NewBuffer([]byte{1})), Header: http.Header{"Etag": {"v1"}}},
 			storeCountAfterSave: 1,
-			cacheSizeAfterSave:  15000,
+			cacheSizeAfterSave:  int64(len("200 OK") + 1 + len("Etag") + len("v1")),
+		},
+		{
+			name:                "ChunkedBodyLargerThanRouteLimit",
+			route:               route.Route{NameID: "test-route", CacheMaxBodySizeInMegaBytes: 1, Hostname: "docker.com"},
+			resp:                &http.Response{StatusCode: 200, ContentLength: -1, Body: ioutil.NopCloser(bytes.NewBuffer(make([]byte, 1000001)))},
+			storeCountAfterSave: 0,
+			cacheSizeAfterSave:  0,
 		},
 	}
 
-	for _, tt := range tests { //nolint
+	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			hc := NewHTTPInMemoryCache("test", tt.maxCacheSizeInMB, config.CacheEvictionLRU)
+			defer hc.Close()
+			save(hc, newTestRoute(t, tt.route), &http.Request{Method: http.MethodGet}, tt.resp)
 
-			m := route.NewManager(route.NewInMemRepo(), route.CreateHTTPClientForRoute)
+			if tt.cacheSizeAfterSave != hc.cacheSizeInBytes {
+				t.Errorf("Save() cache size want %d, got %d", tt.cacheSizeAfterSave, hc.cacheSizeInBytes)
+			}
 
-			if err := m.CreateRoute(context.Background(), &tt.args.route); err != nil {
-				t.Error(err)
-				return
+			if tt.storeCountAfterSave != hc.len() {
+				t.Errorf("Save() store size want %d, got %d", tt.storeCountAfterSave, hc.len())
 			}
+		})
+	}
+}
 
-			routes, err := m.ListRoutes(context.Background())
-			if err != nil {
-				t.Error(err)
-				return
+func TestHTTPInMemoryCache_Eviction(t *testing.T) {
+	t.Parallel()
+	r := newTestRoute(t, route.Route{NameID: "eviction", Hostname: "example.com"})
+	request := func(path string) *http.Request {
+		return &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: path}
+	}
+	body := string(make([]byte, 300000))
+
+	tests := []struct {
+		name        string
+		eviction    string
+		accesses    []string
+		wantEvicted string
+	}{
+		{
+			name:        "LRU",
+			eviction:    config.CacheEvictionLRU,
+			accesses:    []string{"/1", "/1", "/2", "/0"},
+			wantEvicted: "/1",
+		},
+		{
+			name:        "LFU",
+			eviction:    config.CacheEvictionLFU,
+			accesses:    []string{"/0", "/0", "/2", "/2", "/1"},
+			wantEvicted: "/1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := NewHTTPInMemoryCache("test", 1, tt.eviction)
+			defer hc.Close()
+			// all entries have to be stored in the same shard, the victim is chosen per shard
+			hc.shards = hc.shards[:1]
+
+			for _, path := range []string{"/0", "/1", "/2"} {
+				save(hc, r, request(path), newTestResponse(body, http.Header{}))
+			}
+			for _, path := range tt.accesses {
+				hc.Get(r, request(path))
 			}
-			var routeToUse *route.Route
-			for _, r := range routes {
-				if r.NameID == tt.args.route.NameID {
-					routeToUse = r
+			save(hc, r, request("/3"), newTestResponse(body, http.Header{}))
+
+			for _, path := range []string{"/0", "/1", "/2", "/3"} {
+				got := hc.Get(r, request(path))
+				if path == tt.wantEvicted && got != nil {
+					t.Errorf("Get(%s) returned a response which should have been evicted", path)
+				}
+				if path != tt.wantEvicted && got == nil {
+					t.Errorf("Get(%s) returned no response", path)
 				}
 			}
-			if routeToUse == nil {
-				t.Error("route is empty")
-				return
+			if hc.cacheSizeInBytes > hc.maxCacheSizeInBytes {
+				t.Errorf("cache size %d exceeds the max size %d", hc.cacheSizeInBytes, hc.maxCacheSizeInBytes)
 			}
+		})
+	}
+}
 
-			hc := &HTTPInMemoryCache{
-				store:               tt.fields.store,
-				mtx:                 tt.fields.mtx, //nolint
-				maxCacheSizeInBytes: tt.fields.maxCacheSizeInBytes,
-				cacheSizeInBytes:    tt.fields.cacheSizeInBytes,
-			}
-			hc.Save(*routeToUse, tt.args.request, tt.args.resp)
+func TestHTTPInMemoryCache_Resize(t *testing.T) {
+	t.Parallel()
+	r := newTestRoute(t, route.Route{NameID: "resize", Hostname: "example.com"})
+	hc := NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+	defer hc.Close()
 
-			if tt.cacheSizeAfterSave != hc.cacheSizeInBytes {
-				t.Errorf("Save() cache size want %d, got %d", tt.cacheSizeAfterSave, hc.cacheSizeInBytes)
-			}
+	body := string(make([]byte, 300000))
+	for i := 0; i < 10; i++ {
+		save(hc, r, &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: fmt.Sprintf("/%d", i)}, newTestResponse(body, http.Header{}))
+	}
+	if hc.len() != 10 {
+		t.Fatalf("stored %d responses, want 10", hc.len())
+	}
 
-			if tt.storeCountAfterSave != len(hc.store) {
-				t.Errorf("Save() store size want %d, got %d", tt.storeCountAfterSave, len(hc.store))
+	hc.Resize(1)
+	if hc.cacheSizeInBytes > 1e6 || hc.len() != 3 {
+		t.Errorf("Resize() kept %d responses with %d bytes, want 3 responses within 1 MB", hc.len(), hc.cacheSizeInBytes)
+	}
+}
+
+func TestHTTPInMemoryCache_Expiry(t *testing.T) {
+	t.Parallel()
+	r := newTestRoute(t, route.Route{NameID: "expiry", Hostname: "example.com", CacheTimeOutDuration: "50ms"})
+	hc := NewHTTPInMemoryCache("test", -1, config.CacheEvictionLRU)
+	defer hc.Close()
+
+	request := &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/"}
+	save(hc, r, request, newTestResponse("short", http.Header{}))
+	save(hc, r, &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: "/long"}, newTestResponse("long", http.Header{"Cache-Control": {"max-age=60"}}))
+
+	time.Sleep(200 * time.Millisecond)
+	if hc.len() != 1 || hc.Get(r, request) != nil {
+		t.Errorf("expired response was not removed, %d responses are stored", hc.len())
+	}
+}
+
+func TestHTTPInMemoryCache_Concurrent(t *testing.T) {
+	t.Parallel()
+	r := newTestRoute(t, route.Route{NameID: "concurrent", Hostname: "example.com"})
+	hc := NewHTTPInMemoryCache("test", 1, config.CacheEvictionLFU)
+	defer hc.Close()
+
+	body := string(make([]byte, 10000))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				request := &http.Request{Method: http.MethodGet, Host: "example.com", RequestURI: fmt.Sprintf("/%d", (i*j)%150)}
+				if hc.Get(r, request) == nil {
+					save(hc, r, request, newTestResponse(body, http.Header{}))
+				}
 			}
+		}(i)
+	}
+	wg.Wait()
 
-		})
+	if hc.cacheSizeInBytes > hc.maxCacheSizeInBytes {
+		t.Errorf("cache size %d exceeds the max size %d", hc.cacheSizeInBytes, hc.maxCacheSizeInBytes)
 	}
 }
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+)
+
+// Inspector lists and purges the stored responses of a cache
+type Inspector interface {
+	// Entries returns the stored responses which match the filter
+	Entries(filter Filter) []Entry
+	// Purge removes the stored responses which match the filter and returns their number
+	Purge(filter Filter) int
+}
+
+// Entry describes a stored response
+type Entry struct {
+	Key        string `json:"key"`
+	Route      string `json:"route"`
+	Host       string `json:"host"`
+	Path       string `json:"path"`
+	StatusCode int    `json:"status_code"`
+	SizeBytes  int64  `json:"size_bytes"`
+	AgeSeconds int64  `json:"age_seconds"`
+	Stale      bool   `json:"stale"`
+}
+
+// Filter selects stored responses. All configured fields have to match, an empty Filter matches all responses.
+type Filter struct {
+	Key        string
+	Route      string
+	Host       string
+	Path       string
+	PathPrefix string
+	PathRegexp *regexp.Regexp
+}
+
+// IsEmpty checks if no field of the filter is configured
+func (f Filter) IsEmpty() bool {
+	return f == Filter{}
+}
+
+func (f Filter) matches(e *entry) bool {
+	switch {
+	case f.Key != "" && f.Key != e.primaryID:
+		return false
+	case f.Route != "" && f.Route != e.location.route:
+		return false
+	case f.Host != "" && hostname(f.Host) != e.location.host:
+		return false
+	case f.Path != "" && f.Path != e.location.path:
+		return false
+	case f.PathPrefix != "" && !strings.HasPrefix(e.location.path, f.PathPrefix):
+		return false
+	case f.PathRegexp != nil && !f.PathRegexp.MatchString(e.location.path):
+		return false
+	}
+	return true
+}
+
+// location of a stored response, it is used to inspect and purge the cache
+type location struct {
+	route string
+	host  string
+	path  string
+}
+
+func newLocation(route route.Route, request *http.Request) location {
+	return location{route: string(route.NameID), host: hostname(request.Host), path: keyPath(route.CacheKey, request)}
+}
+
+// requestPath is the request URI or "/" if it is empty
+func requestPath(request *http.Request) string {
+	if request.RequestURI == "" {
+		return "/"
+	}
+	return request.RequestURI
+}
+
+// hostname without the port in lower case
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+func (e *entry) describe(now time.Time) Entry {
+	return Entry{
+		Key:        e.primaryID,
+		Route:      e.location.route,
+		Host:       e.location.host,
+		Path:       e.location.path,
+		StatusCode: e.response.statusCode,
+		SizeBytes:  e.size,
+		AgeSeconds: int64(e.response.age(now) / time.Second),
+		Stale:      !e.response.isFresh(now, cachecontrol.Directives{}),
+	}
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/stringutil"
+)
+
+// BuildID returns the id of the stored responses to a request of the route, it does not contain the request headers listed in the Vary header.
+// The id is composed of the route.NameID, the http.Request.Host including the port and the request URI rewritten by the route.CacheKey, followed by the configured headers and cookies.
+func BuildID(route route.Route, clientRequest *http.Request) string {
+	host := clientRequest.Host
+	if route.CacheKey.IgnoreCase {
+		host = strings.ToLower(host)
+	}
+
+	var id strings.Builder
+	fmt.Fprintf(&id, "%s-%s-%s", route.NameID, host, keyPath(route.CacheKey, clientRequest))
+	for _, header := range route.CacheKey.Headers {
+		fmt.Fprintf(&id, "-%s=%s", header, strings.Join(clientRequest.Header.Values(header), ","))
+	}
+	for _, name := range route.CacheKey.Cookies {
+		var value string
+		if cookie, err := clientRequest.Cookie(name); err == nil {
+			value = cookie.Value
+		}
+		fmt.Fprintf(&id, "-cookie:%s=%s", name, value)
+	}
+	return id.String()
+}
+
+// keyPath is the request URI with the query parameters selected and sorted by the key, ignore case converts the path to lower case
+func keyPath(key route.CacheKey, request *http.Request) string {
+	uri := requestPath(request)
+	if !key.HasQueryRules() && !key.IgnoreCase {
+		return uri
+	}
+
+	path, query := uri, ""
+	if i := strings.IndexByte(uri, '?'); i != -1 {
+		path, query = uri[:i], uri[i+1:]
+	}
+	if key.IgnoreCase {
+		path = strings.ToLower(path)
+	}
+
+	params := keyQueryParams(key, query)
+	if len(params) == 0 {
+		return path
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+// keyQueryParams returns the query parameters which are part of the key in their original encoding
+func keyQueryParams(key route.CacheKey, query string) []string {
+	type param struct {
+		name string
+		raw  string
+	}
+
+	var params []param
+	for _, raw := range strings.Split(query, "&") {
+		if raw == "" {
+			continue
+		}
+		name := raw
+		if i := strings.IndexByte(raw, '='); i != -1 {
+			name = raw[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+
+		if len(key.QueryInclude) != 0 && !stringutil.Contains(key.QueryInclude, name) {
+			continue
+		}
+		if stringutil.Contains(key.QueryExclude, name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+
+	if key.QuerySort {
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].name < params[j].name
+		})
+	}
+
+	rawParams := make([]string, 0, len(params))
+	for _, p := range params {
+		rawParams = append(rawParams, p.raw)
+	}
+	return rawParams
+}
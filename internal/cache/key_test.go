@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+)
+
+func TestBuildID(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		cacheKey route.CacheKey
+		host     string
+		uri      string
+		header   http.Header
+		want     string
+	}{
+		{
+			name: "Default",
+			host: "Example.com",
+			uri:  "/Items?b=2&a=1",
+			want: "key-Example.com-/Items?b=2&a=1",
+		},
+		{
+			name:     "SortQuery",
+			cacheKey: route.CacheKey{QuerySort: true},
+			host:     "example.com",
+			uri:      "/items?b=2&a=1&b=1",
+			want:     "key-example.com-/items?a=1&b=2&b=1",
+		},
+		{
+			name:     "ExcludeQuery",
+			cacheKey: route.CacheKey{QueryExclude: []string{"utm_source", "fbclid"}},
+			host:     "example.com",
+			uri:      "/items?utm_source=mail&page=2&fbclid=abc",
+			want:     "key-example.com-/items?page=2",
+		},
+		{
+			name:     "IncludeQuery",
+			cacheKey: route.CacheKey{QueryInclude: []string{"page"}},
+			host:     "example.com",
+			uri:      "/items?session=1&page=2",
+			want:     "key-example.com-/items?page=2",
+		},
+		{
+			name:     "IncludeNoParam",
+			cacheKey: route.CacheKey{QueryInclude: []string{"page"}},
+			host:     "example.com",
+			uri:      "/items?session=1",
+			want:     "key-example.com-/items",
+		},
+		{
+			name:     "IgnoreCase",
+			cacheKey: route.CacheKey{IgnoreCase: true},
+			host:     "Example.com",
+			uri:      "/Items?Page=2",
+			want:     "key-example.com-/items?Page=2",
+		},
+		{
+			name:     "HeadersAndCookies",
+			cacheKey: route.CacheKey{Headers: []string{"accept-language"}, Cookies: []string{"tenant", "theme"}},
+			host:     "example.com",
+			uri:      "/",
+			header:   http.Header{"Accept-Language": {"de"}, "Cookie": {"tenant=a; session=b"}},
+			want:     "key-example.com-/-Accept-Language=de-cookie:tenant=a-cookie:theme=",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := newTestRoute(t, route.Route{NameID: "key", Hostname: "example.com", CacheKey: tt.cacheKey})
+			request := &http.Request{Method: http.MethodGet, Host: tt.host, RequestURI: tt.uri, Header: tt.header}
+			if request.Header == nil {
+				request.Header = http.Header{}
+			}
+			if got := BuildID(r, request); got != tt.want {
+				t.Errorf("BuildID() got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// directoryLock is an exclusive flock on the lock file of a disk cache directory, it is released when the process exits
+type directoryLock struct {
+	file *os.File
+}
+
+// lockDirectory acquires the lock of the directory. Waits until another process released the lock or the timeout is reached.
+func lockDirectory(directory string, timeout time.Duration) (*directoryLock, error) {
+	f, err := os.OpenFile(filepath.Join(directory, diskLockFile), os.O_CREATE|os.O_RDWR, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrorInvalidDiskCacheDirectory, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		switch {
+		case err == nil:
+			return &directoryLock{file: f}, nil
+		case !errors.Is(err, syscall.EWOULDBLOCK):
+			f.Close()
+			return nil, err
+		case time.Now().After(deadline):
+			f.Close()
+			return nil, fmt.Errorf("%w: \"%s\"", ErrorDiskCacheLocked, directory)
+		}
+		time.Sleep(diskLockPollInterval)
+	}
+}
+
+// release the lock, closing the file releases the flock
+func (l *directoryLock) release() error {
+	return l.file.Close()
+}
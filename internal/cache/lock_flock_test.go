@@ -0,0 +1,39 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockDirectory(t *testing.T) {
+	t.Parallel()
+	directory := t.TempDir()
+
+	lock, err := lockDirectory(directory, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockDirectory(directory, 100*time.Millisecond); !errors.Is(err, ErrorDiskCacheLocked) {
+		t.Fatalf("lockDirectory() of a locked directory returned error %v, want %v", err, ErrorDiskCacheLocked)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		waiting, err := lockDirectory(directory, 5*time.Second)
+		if err == nil {
+			err = waiting.release()
+		}
+		acquired <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := lock.release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-acquired; err != nil {
+		t.Errorf("lockDirectory() did not wait until the directory was released, error: %s", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package cache
+
+import "time"
+
+// directoryLock does nothing on platforms without flock, the directory is not protected against other processes
+type directoryLock struct{}
+
+func lockDirectory(_ string, _ time.Duration) (*directoryLock, error) {
+	return &directoryLock{}, nil
+}
+
+func (l *directoryLock) release() error {
+	return nil
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+)
+
+const httpInMemoryCacheHeader = "x-cached-by-prox"
+const httpContentTypeHeader = "Content-Type"
+const httpAgeHeader = "Age"
+
+type response struct {
+	body          []byte
+	contentLength int64
+	header        http.Header
+	statusCode    int
+	status        string
+	metricLabels  map[string]string
+	responseTime  time.Time
+	initialAge    time.Duration
+	lifetime      time.Duration
+	removeAt      time.Time
+}
+
+// age of the response, see RFC 7234 section 4.2.3
+func (r response) age(now time.Time) time.Duration {
+	return r.initialAge + now.Sub(r.responseTime)
+}
+
+// isFresh checks if the response can be served without a revalidation for a request with the given directives, see RFC 7234 section 4.2 and 5.2.1
+func (r response) isFresh(now time.Time, requestDirectives cachecontrol.Directives) bool {
+	if requestDirectives.Has(cachecontrol.NoCache) {
+		return false
+	}
+
+	age := r.age(now)
+	lifetime := r.lifetime
+	if maxAge, ok := requestDirectives.Duration(cachecontrol.MaxAge); ok && maxAge < lifetime {
+		lifetime = maxAge
+	}
+	if minFresh, ok := requestDirectives.Duration(cachecontrol.MinFresh); ok {
+		age += minFresh
+	}
+	if lifetime > age {
+		return true
+	}
+
+	responseDirectives := cachecontrol.Parse(r.header)
+	if !requestDirectives.Has(cachecontrol.MaxStale) || responseDirectives.Has(cachecontrol.MustRevalidate) || responseDirectives.Has(cachecontrol.ProxyRevalidate) {
+		return false
+	}
+	maxStale, ok := requestDirectives.Duration(cachecontrol.MaxStale)
+	return !ok || age-lifetime <= maxStale
+}
+
+// retention is the duration the response will be kept from its response time on. Responses with validators are kept
+// for the cache timeout of the route after they became stale, responses which can be served stale are kept for their grace period.
+func (r response) retention(route route.Route) time.Duration {
+	var keepStale time.Duration
+	if cachecontrol.HasValidators(r.header) {
+		keepStale = route.GetCacheTimeOut()
+	}
+	if grace := staleGracePeriod(route, r.header); grace > keepStale {
+		keepStale = grace
+	}
+
+	retention := r.lifetime - r.initialAge
+	if keepStale > 0 {
+		if retention < 0 {
+			retention = 0
+		}
+		retention += keepStale
+	}
+	return retention
+}
+
+// size is the number of bytes of the stored body and headers
+func (r response) size() int64 {
+	size := int64(len(r.body)) + int64(len(r.status))
+	for name, values := range r.header {
+		for _, value := range values {
+			size += int64(len(name) + len(value))
+		}
+	}
+	return size
+}
+
+// updateFreshness calculates the age and the freshness lifetime of the response received at now
+func (r *response) updateFreshness(now time.Time, defaultLifetime time.Duration) {
+	date, ok := cachecontrol.ParseDate(r.header, "Date")
+	if !ok {
+		date = now
+	}
+	r.responseTime = now
+	r.initialAge = initialAge(r.header, date, now)
+	r.lifetime = freshnessLifetime(r.statusCode, r.header, cachecontrol.Parse(r.header), date, defaultLifetime)
+}
+
+// refresh updates the headers with the ones of a 304 Not Modified response, see RFC 7234 section 4.3.4
+func (r *response) refresh(notModified *http.Response, now time.Time, defaultLifetime time.Duration) {
+	r.header = r.header.Clone()
+	for name, values := range notModified.Header {
+		if name == "Content-Length" {
+			continue
+		}
+		r.header[name] = append([]string(nil), values...)
+	}
+	removeQualifiedFields(r.header, cachecontrol.Parse(r.header))
+	r.updateFreshness(now, defaultLifetime)
+}
+
+func (r response) toHTTPResponse(now time.Time) *http.Response {
+	header := r.header.Clone()
+	header.Set(httpInMemoryCacheHeader, "true")
+	header.Set(httpAgeHeader, strconv.FormatInt(int64(r.age(now)/time.Second), 10))
+	return &http.Response{
+		Body:          ioutil.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: r.contentLength,
+		Header:        header,
+		StatusCode:    r.statusCode,
+		Status:        r.status,
+	}
+}
+
+// removeQualifiedFields removes the headers named by a qualified private or no-cache directive, they must not be sent in responses of a shared cache
+func removeQualifiedFields(header http.Header, directives cachecontrol.Directives) {
+	for _, name := range append(directives.FieldNames(cachecontrol.Private), directives.FieldNames(cachecontrol.NoCache)...) {
+		header.Del(name)
+	}
+}
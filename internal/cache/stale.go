@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+)
+
+// StaleResponse is a stored response which is not fresh anymore and has to be revalidated.
+// It can be served without a successful revalidation within the durations of the stale extensions of RFC 5861.
+type StaleResponse struct {
+	*http.Response
+	// WhileRevalidate is true if the response can be served while it is revalidated in the background
+	WhileRevalidate bool
+	// IfError is true if the response can be served if the revalidation failed
+	IfError bool
+}
+
+// staleDurations returns how long a response can be served after it became stale while it is revalidated and if the revalidation failed.
+// The durations configured by the route take precedence over the stale-while-revalidate and stale-if-error directives of the response.
+// Responses with a must-revalidate, proxy-revalidate or no-cache directive are never served stale.
+func staleDurations(route route.Route, header http.Header) (whileRevalidate, ifError time.Duration) {
+	directives := cachecontrol.Parse(header)
+	if directives.Has(cachecontrol.MustRevalidate) || directives.Has(cachecontrol.ProxyRevalidate) || directives.Has(cachecontrol.NoCache) {
+		return 0, 0
+	}
+
+	whileRevalidate, ok := route.GetCacheStaleWhileRevalidate()
+	if !ok {
+		whileRevalidate, _ = directives.Duration(cachecontrol.StaleWhileRevalidate)
+	}
+	ifError, ok = route.GetCacheStaleIfError()
+	if !ok {
+		ifError, _ = directives.Duration(cachecontrol.StaleIfError)
+	}
+	return whileRevalidate, ifError
+}
+
+// staleGracePeriod is the duration a response is kept after it became stale to serve it without a successful revalidation
+func staleGracePeriod(route route.Route, header http.Header) time.Duration {
+	whileRevalidate, ifError := staleDurations(route, header)
+	if whileRevalidate > ifError {
+		return whileRevalidate
+	}
+	return ifError
+}
+
+func (r response) toStaleResponse(route route.Route, now time.Time, requestDirectives cachecontrol.Directives) *StaleResponse {
+	stale := &StaleResponse{Response: r.toHTTPResponse(now)}
+	if requestDirectives.Has(cachecontrol.NoCache) {
+		return stale
+	}
+
+	staleness := r.age(now) - r.lifetime
+	whileRevalidate, ifError := staleDurations(route, r.header)
+	stale.WhileRevalidate = whileRevalidate > 0 && staleness <= whileRevalidate
+	stale.IfError = ifError > 0 && staleness <= ifError
+	return stale
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/domain/entity/route"
+	"github.com/fwiedmann/prox/internal/cachecontrol"
+)
+
+func Test_response_toStaleResponse(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	tests := []struct {
+		name                string
+		route               route.Route
+		cacheControl        string
+		staleness           time.Duration
+		requestNoCache      bool
+		wantWhileRevalidate bool
+		wantIfError         bool
+		wantRetention       time.Duration
+	}{
+		{
+			name:                "Directives",
+			route:               route.Route{NameID: "stale", Hostname: "example.com"},
+			cacheControl:        "max-age=60, stale-while-revalidate=30, stale-if-error=300",
+			staleness:           time.Minute,
+			wantWhileRevalidate: false,
+			wantIfError:         true,
+			wantRetention:       6 * time.Minute,
+		},
+		{
+			name:                "RouteOverrides",
+			route:               route.Route{NameID: "stale", Hostname: "example.com", CacheStaleWhileRevalidate: "2m", CacheStaleIfError: "0s"},
+			cacheControl:        "max-age=60, stale-if-error=300",
+			staleness:           time.Minute,
+			wantWhileRevalidate: true,
+			wantIfError:         false,
+			wantRetention:       3 * time.Minute,
+		},
+		{
+			name:          "MustRevalidate",
+			route:         route.Route{NameID: "stale", Hostname: "example.com", CacheStaleIfError: "5m"},
+			cacheControl:  "max-age=60, must-revalidate",
+			staleness:     time.Second,
+			wantRetention: time.Minute,
+		},
+		{
+			name:           "RequestNoCache",
+			route:          route.Route{NameID: "stale", Hostname: "example.com"},
+			cacheControl:   "max-age=60, stale-while-revalidate=30, stale-if-error=300",
+			staleness:      time.Second,
+			requestNoCache: true,
+			wantRetention:  6 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := newTestRoute(t, tt.route)
+			stored := response{header: http.Header{"Cache-Control": {tt.cacheControl}}, statusCode: http.StatusOK, lifetime: time.Minute, responseTime: now.Add(-time.Minute - tt.staleness)}
+
+			requestDirectives := cachecontrol.Directives{}
+			if tt.requestNoCache {
+				requestDirectives[cachecontrol.NoCache] = ""
+			}
+			stale := stored.toStaleResponse(r, now, requestDirectives)
+			if stale.WhileRevalidate != tt.wantWhileRevalidate || stale.IfError != tt.wantIfError {
+				t.Errorf("toStaleResponse() while revalidate %v, if error %v, want %v, %v", stale.WhileRevalidate, stale.IfError, tt.wantWhileRevalidate, tt.wantIfError)
+			}
+			if got := stored.retention(r); got != tt.wantRetention {
+				t.Errorf("retention() = %s, want %s", got, tt.wantRetention)
+			}
+		})
+	}
+}
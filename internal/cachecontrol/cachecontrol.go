@@ -0,0 +1,121 @@
+// Package cachecontrol implements the parsing of Cache-Control headers and the evaluation of conditional requests
+// as defined in RFC 7234 and RFC 7232.
+package cachecontrol
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NoStore         = "no-store"
+	NoCache         = "no-cache"
+	Private         = "private"
+	Public          = "public"
+	MaxAge          = "max-age"
+	SMaxAge         = "s-maxage"
+	MaxStale        = "max-stale"
+	MinFresh        = "min-fresh"
+	MustRevalidate  = "must-revalidate"
+	ProxyRevalidate = "proxy-revalidate"
+	// StaleWhileRevalidate and StaleIfError are the extensions of RFC 5861
+	StaleWhileRevalidate = "stale-while-revalidate"
+	StaleIfError         = "stale-if-error"
+)
+
+// Directives of one or more Cache-Control headers. The names are lower cased, directives without a value have an empty value.
+type Directives map[string]string
+
+// Parse all Cache-Control values of the header. A "Pragma: no-cache" will be treated as "Cache-Control: no-cache" if there is no Cache-Control header.
+func Parse(header http.Header) Directives {
+	directives := make(Directives)
+	values := header.Values("Cache-Control")
+	if len(values) == 0 && strings.EqualFold(strings.TrimSpace(header.Get("Pragma")), NoCache) {
+		directives[NoCache] = ""
+		return directives
+	}
+
+	for _, value := range values {
+		for _, directive := range splitDirectives(value) {
+			name, argument := directive, ""
+			if i := strings.Index(directive, "="); i != -1 {
+				name, argument = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), "\"")
+			}
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, ok := directives[name]; ok && argument == "" {
+				continue
+			}
+			directives[name] = argument
+		}
+	}
+	return directives
+}
+
+// Has reports if the directive is present
+func (d Directives) Has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// Duration returns the value of a delta-seconds directive like max-age. Invalid values are reported as not present.
+func (d Directives) Duration(name string) (time.Duration, bool) {
+	value, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// FieldNames returns the header names of a qualified directive like private="Set-Cookie"
+func (d Directives) FieldNames(name string) []string {
+	value := d[name]
+	if value == "" {
+		return nil
+	}
+	names := make([]string, 0)
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			names = append(names, http.CanonicalHeaderKey(field))
+		}
+	}
+	return names
+}
+
+// ParseDate returns the time of a http date header like Date or Expires
+func ParseDate(header http.Header, name string) (time.Time, bool) {
+	value := header.Get(name)
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// splitDirectives splits a Cache-Control value by commas which are not part of a quoted string
+func splitDirectives(value string) []string {
+	directives := make([]string, 0)
+	var quoted bool
+	start := 0
+	for i, c := range value {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			directives = append(directives, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(directives, strings.TrimSpace(value[start:]))
+}
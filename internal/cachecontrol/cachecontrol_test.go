@@ -0,0 +1,119 @@
+package cachecontrol
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		header http.Header
+		want   Directives
+	}{
+		{
+			name:   "MultipleValues",
+			header: http.Header{"Cache-Control": {"public, MAX-AGE=60", "s-maxage=\"120\""}},
+			want:   Directives{"public": "", "max-age": "60", "s-maxage": "120"},
+		},
+		{
+			name:   "QuotedFieldNames",
+			header: http.Header{"Cache-Control": {`private="Set-Cookie, X-User", max-age=60`}},
+			want:   Directives{"private": "Set-Cookie, X-User", "max-age": "60"},
+		},
+		{
+			name:   "Pragma",
+			header: http.Header{"Pragma": {"no-cache"}},
+			want:   Directives{"no-cache": ""},
+		},
+		{
+			name:   "Empty",
+			header: http.Header{},
+			want:   Directives{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirectives_Duration(t *testing.T) {
+	t.Parallel()
+	d := Directives{"max-age": "60", "s-maxage": "-1", "max-stale": ""}
+	if got, ok := d.Duration("max-age"); !ok || got != time.Minute {
+		t.Errorf("Duration(max-age) = %s, %v", got, ok)
+	}
+	if _, ok := d.Duration("s-maxage"); ok {
+		t.Error("Duration() accepted a negative value")
+	}
+	if _, ok := d.Duration("max-stale"); ok {
+		t.Error("Duration() accepted an empty value")
+	}
+	if got := (Directives{"private": "set-cookie, x-user"}).FieldNames("private"); !reflect.DeepEqual(got, []string{"Set-Cookie", "X-User"}) {
+		t.Errorf("FieldNames() = %v", got)
+	}
+}
+
+func TestIsNotModified(t *testing.T) {
+	t.Parallel()
+	lastModified := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	header := http.Header{"Etag": {`"v1"`}, "Last-Modified": {lastModified.Format(http.TimeFormat)}}
+	tests := []struct {
+		name          string
+		method        string
+		requestHeader http.Header
+		want          bool
+	}{
+		{
+			name:          "MatchingETag",
+			method:        http.MethodGet,
+			requestHeader: http.Header{"If-None-Match": {`"v0", W/"v1"`}},
+			want:          true,
+		},
+		{
+			name:          "Wildcard",
+			method:        http.MethodGet,
+			requestHeader: http.Header{"If-None-Match": {"*"}},
+			want:          true,
+		},
+		{
+			name:          "ETagBeforeModifiedSince",
+			method:        http.MethodGet,
+			requestHeader: http.Header{"If-None-Match": {`"v2"`}, "If-Modified-Since": {lastModified.Format(http.TimeFormat)}},
+			want:          false,
+		},
+		{
+			name:          "NotModifiedSince",
+			method:        http.MethodGet,
+			requestHeader: http.Header{"If-Modified-Since": {lastModified.Add(time.Hour).Format(http.TimeFormat)}},
+			want:          true,
+		},
+		{
+			name:          "ModifiedSince",
+			method:        http.MethodGet,
+			requestHeader: http.Header{"If-Modified-Since": {lastModified.Add(-time.Hour).Format(http.TimeFormat)}},
+			want:          false,
+		},
+		{
+			name:          "UnsafeMethod",
+			method:        http.MethodPost,
+			requestHeader: http.Header{"If-None-Match": {`"v1"`}},
+			want:          false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Method: tt.method, Header: tt.requestHeader}
+			if got := IsNotModified(r, header); got != tt.want {
+				t.Errorf("IsNotModified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package cachecontrol
+
+import (
+	"net/http"
+	"strings"
+)
+
+// headersOfNotModified will be copied from the full response to a 304 Not Modified response, see RFC 7232 section 4.1
+var headersOfNotModified = []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary", "Age"}
+
+// HasValidators reports if the response header contains an ETag or a Last-Modified validator
+func HasValidators(header http.Header) bool {
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+// SetValidators configures the request as conditional request with the validators of the stored response header.
+// Conditional headers sent by the client will be replaced. Returns false if the stored response has no validators.
+func SetValidators(request *http.Request, stored http.Header) bool {
+	if !HasValidators(stored) {
+		return false
+	}
+	request.Header.Del("If-None-Match")
+	request.Header.Del("If-Modified-Since")
+	if etag := stored.Get("ETag"); etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := stored.Get("Last-Modified"); lastModified != "" {
+		request.Header.Set("If-Modified-Since", lastModified)
+	}
+	return true
+}
+
+// IsNotModified evaluates the If-None-Match and If-Modified-Since headers of a GET or HEAD request against the response header.
+// If-Modified-Since will be ignored if the request contains If-None-Match, see RFC 7232 section 6.
+func IsNotModified(request *http.Request, header http.Header) bool {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakMatch(candidate, etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ifModifiedSince)
+}
+
+// NotModifiedHeader returns the headers of the full response which are sent with a 304 Not Modified response
+func NotModifiedHeader(header http.Header) http.Header {
+	notModified := make(http.Header)
+	for _, name := range headersOfNotModified {
+		if values := header.Values(name); len(values) > 0 {
+			notModified[name] = append([]string(nil), values...)
+		}
+	}
+	return notModified
+}
+
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
@@ -0,0 +1,50 @@
+package compression
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedBody is compressed while it is read. The upstream body is compressed by a goroutine into a pipe,
+// closing the compressedBody stops the goroutine and closes the upstream body.
+type compressedBody struct {
+	*io.PipeReader
+	body io.ReadCloser
+}
+
+func newCompressedBody(body io.ReadCloser, encoding string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		encoder, err := newEncoder(pw, encoding)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		_, err = io.Copy(encoder, body)
+		if closeErr := encoder.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+	return &compressedBody{PipeReader: pr, body: body}
+}
+
+// Close the pipe and the upstream body
+func (b *compressedBody) Close() error {
+	_ = b.PipeReader.Close()
+	return b.body.Close()
+}
+
+func newEncoder(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingBrotli:
+		return brotli.NewWriter(w), nil
+	case EncodingZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return gzip.NewWriter(w), nil
+	}
+}
@@ -0,0 +1,140 @@
+package compression
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+var ErrorInvalidConfig = errors.New("invalid compression configuration")
+
+const (
+	EncodingGzip     = "gzip"
+	EncodingBrotli   = "br"
+	EncodingZstd     = "zstd"
+	EncodingIdentity = "identity"
+
+	acceptEncodingHeader  = "Accept-Encoding"
+	contentEncodingHeader = "Content-Encoding"
+	varyHeader            = "Vary"
+
+	defaultMinSizeInBytes = 1024
+)
+
+var (
+	defaultEncodings    = []string{EncodingBrotli, EncodingZstd, EncodingGzip}
+	defaultContentTypes = []string{
+		"text/*",
+		"application/javascript",
+		"application/json",
+		"application/xml",
+		"application/xhtml+xml",
+		"image/svg+xml",
+	}
+)
+
+// Config of the response compression of a route
+type Config struct {
+	Enabled        bool     `yaml:"enabled"`
+	Encodings      []string `yaml:"encodings,omitempty"`
+	ContentTypes   []string `yaml:"content-types,omitempty"`
+	MinSizeInBytes int64    `yaml:"min-size-in-bytes"`
+}
+
+// Parse validates the configuration and sets the defaults
+func (c *Config) Parse() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if len(c.Encodings) == 0 {
+		c.Encodings = defaultEncodings
+	}
+	for i, encoding := range c.Encodings {
+		c.Encodings[i] = strings.ToLower(encoding)
+		switch c.Encodings[i] {
+		case EncodingGzip, EncodingBrotli, EncodingZstd:
+		default:
+			return fmt.Errorf("%w: unsupported encoding \"%s\"", ErrorInvalidConfig, encoding)
+		}
+	}
+
+	if len(c.ContentTypes) == 0 {
+		c.ContentTypes = defaultContentTypes
+	}
+	if c.MinSizeInBytes < 0 {
+		return fmt.Errorf("%w: negative min size %d", ErrorInvalidConfig, c.MinSizeInBytes)
+	}
+	if c.MinSizeInBytes == 0 {
+		c.MinSizeInBytes = defaultMinSizeInBytes
+	}
+	return nil
+}
+
+// Compress replaces the body of the response with the compressed body if the request accepts one of the encodings,
+// the response has an eligible content type and size and is neither encoded already nor a partial response.
+// The Vary header of all eligible responses contains Accept-Encoding, so every encoding is stored as its own variant in the cache.
+func (c Config) Compress(request *http.Request, resp *http.Response) {
+	if !c.isEligible(request, resp) {
+		return
+	}
+	addVary(resp.Header, acceptEncodingHeader)
+
+	encoding := c.negotiate(request.Header.Get(acceptEncodingHeader))
+	if encoding == EncodingIdentity {
+		return
+	}
+
+	resp.Body = newCompressedBody(resp.Body, encoding)
+	resp.Header.Set(contentEncodingHeader, encoding)
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = false
+	if etag := resp.Header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		resp.Header.Set("ETag", "W/"+etag)
+	}
+}
+
+func (c Config) isEligible(request *http.Request, resp *http.Response) bool {
+	switch {
+	case !c.Enabled, request.Method == http.MethodHead, resp.StatusCode != http.StatusOK:
+		return false
+	case resp.Header.Get(contentEncodingHeader) != "" && !strings.EqualFold(resp.Header.Get(contentEncodingHeader), EncodingIdentity):
+		return false
+	case resp.Header.Get("Content-Range") != "":
+		return false
+	case resp.ContentLength >= 0 && resp.ContentLength < c.MinSizeInBytes:
+		return false
+	case strings.Contains(strings.ToLower(resp.Header.Get("Cache-Control")), "no-transform"):
+		return false
+	}
+	return c.isEligibleContentType(resp.Header.Get("Content-Type"))
+}
+
+func (c Config) isEligibleContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, eligible := range c.ContentTypes {
+		if eligible == mediaType || strings.HasSuffix(eligible, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(eligible, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary adds the field to the Vary header if it is not listed yet
+func addVary(header http.Header, field string) {
+	for _, value := range header.Values(varyHeader) {
+		for _, listed := range strings.Split(value, ",") {
+			listed = strings.TrimSpace(listed)
+			if listed == "*" || strings.EqualFold(listed, field) {
+				return
+			}
+		}
+	}
+	header.Add(varyHeader, field)
+}
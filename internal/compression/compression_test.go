@@ -0,0 +1,258 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var testBody = strings.Repeat("compress me ", 200)
+
+func newTestConfig(t *testing.T, c Config) Config {
+	t.Helper()
+	c.Enabled = true
+	if err := c.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestConfig_Parse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{
+			name:   "Defaults",
+			config: Config{Enabled: true},
+		},
+		{
+			name:   "Disabled",
+			config: Config{Encodings: []string{"deflate"}},
+		},
+		{
+			name:    "UnsupportedEncoding",
+			config:  Config{Enabled: true, Encodings: []string{"gzip", "deflate"}},
+			wantErr: true,
+		},
+		{
+			name:    "NegativeMinSize",
+			config:  Config{Enabled: true, MinSizeInBytes: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tt.config.Parse(); (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_negotiate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		encodings      []string
+		acceptEncoding string
+		want           string
+	}{
+		{
+			name:           "Empty",
+			acceptEncoding: "",
+			want:           EncodingIdentity,
+		},
+		{
+			name:           "ServerPreference",
+			acceptEncoding: "gzip, deflate, br",
+			want:           EncodingBrotli,
+		},
+		{
+			name:           "ClientQuality",
+			acceptEncoding: "br;q=0.5, gzip;q=0.8",
+			want:           EncodingGzip,
+		},
+		{
+			name:           "Rejected",
+			encodings:      []string{"gzip"},
+			acceptEncoding: "gzip;q=0, br",
+			want:           EncodingIdentity,
+		},
+		{
+			name:           "Wildcard",
+			encodings:      []string{"zstd", "gzip"},
+			acceptEncoding: "*",
+			want:           EncodingZstd,
+		},
+		{
+			name:           "Unsupported",
+			acceptEncoding: "deflate, compress",
+			want:           EncodingIdentity,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := newTestConfig(t, Config{Encodings: tt.encodings})
+			if got := c.negotiate(tt.acceptEncoding); got != tt.want {
+				t.Errorf("negotiate() got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Compress(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		header         http.Header
+		body           string
+		wantEncoding   string
+		wantVary       bool
+	}{
+		{
+			name:           "Gzip",
+			acceptEncoding: "gzip",
+			header:         http.Header{"Content-Type": {"text/html; charset=utf-8"}, "Etag": {`"v1"`}},
+			body:           testBody,
+			wantEncoding:   EncodingGzip,
+			wantVary:       true,
+		},
+		{
+			name:           "Brotli",
+			acceptEncoding: "br",
+			header:         http.Header{"Content-Type": {"application/json"}},
+			body:           testBody,
+			wantEncoding:   EncodingBrotli,
+			wantVary:       true,
+		},
+		{
+			name:           "Zstd",
+			acceptEncoding: "zstd",
+			header:         http.Header{"Content-Type": {"image/svg+xml"}, "Vary": {"Accept-Language"}},
+			body:           testBody,
+			wantEncoding:   EncodingZstd,
+			wantVary:       true,
+		},
+		{
+			name:     "IdentityVariant",
+			header:   http.Header{"Content-Type": {"text/plain"}},
+			body:     testBody,
+			wantVary: true,
+		},
+		{
+			name:           "TooSmall",
+			acceptEncoding: "gzip",
+			header:         http.Header{"Content-Type": {"text/plain"}},
+			body:           "small",
+		},
+		{
+			name:           "IneligibleContentType",
+			acceptEncoding: "gzip",
+			header:         http.Header{"Content-Type": {"image/png"}},
+			body:           testBody,
+		},
+		{
+			name:           "AlreadyEncoded",
+			acceptEncoding: "gzip",
+			header:         http.Header{"Content-Type": {"text/plain"}, "Content-Encoding": {"br"}},
+			body:           testBody,
+		},
+		{
+			name:           "Range",
+			acceptEncoding: "gzip",
+			header:         http.Header{"Content-Type": {"text/plain"}, "Content-Range": {"bytes 0-99/2400"}},
+			body:           testBody,
+		},
+		{
+			name:           "NoTransform",
+			acceptEncoding: "gzip",
+			header:         http.Header{"Content-Type": {"text/plain"}, "Cache-Control": {"max-age=60, no-transform"}},
+			body:           testBody,
+		},
+		{
+			name:           "Head",
+			method:         http.MethodHead,
+			acceptEncoding: "gzip",
+			header:         http.Header{"Content-Type": {"text/plain"}},
+			body:           testBody,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := newTestConfig(t, Config{})
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			request := &http.Request{Method: method, Header: http.Header{}}
+			if tt.acceptEncoding != "" {
+				request.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			resp := &http.Response{StatusCode: http.StatusOK, Header: tt.header, ContentLength: int64(len(tt.body)), Body: ioutil.NopCloser(strings.NewReader(tt.body))}
+
+			c.Compress(request, resp)
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get("Content-Encoding"); tt.wantEncoding != "" && got != tt.wantEncoding {
+				t.Errorf("Content-Encoding got %q, want %q", got, tt.wantEncoding)
+			}
+			if got := strings.Contains(strings.Join(resp.Header.Values("Vary"), ","), "Accept-Encoding"); got != tt.wantVary {
+				t.Errorf("Vary contains Accept-Encoding got %t, want %t", got, tt.wantVary)
+			}
+			if etag := resp.Header.Get("Etag"); tt.wantEncoding != "" && etag != "" && !strings.HasPrefix(etag, "W/") {
+				t.Errorf("ETag of the compressed response got %q, want a weak ETag", etag)
+			}
+
+			decoded, err := decode(tt.wantEncoding, resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != tt.body {
+				t.Errorf("decoded body does not match the upstream body")
+			}
+		})
+	}
+}
+
+// decode reads the body with the encoding, an empty encoding reads it unchanged
+func decode(encoding string, body io.Reader) (string, error) {
+	var reader io.Reader = body
+	switch encoding {
+	case EncodingGzip:
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return "", err
+		}
+		reader = gz
+	case EncodingBrotli:
+		reader = brotli.NewReader(body)
+	case EncodingZstd:
+		zr, err := zstd.NewReader(body)
+		if err != nil {
+			return "", err
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, reader)
+	return buf.String(), err
+}
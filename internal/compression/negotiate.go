@@ -0,0 +1,42 @@
+package compression
+
+import (
+	"strconv"
+	"strings"
+)
+
+// negotiate returns the configured encoding with the highest quality in the Accept-Encoding header, the order of
+// the configured encodings decides between equal qualities. Identity is used if no configured encoding is accepted.
+func (c Config) negotiate(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(coding, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := EncodingIdentity, 0.0
+	for _, encoding := range c.Encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = qualities["*"]
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+var ErrorInvalidAccessLogConfig = errors.New("static configuration has an invalid access log configuration")
+
+// Supported access log formats
+const (
+	AccessLogFormatCommon   = "common"
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatJSON     = "json"
+	AccessLogFormatTemplate = "template"
+)
+
+// Supported access log outputs
+const (
+	AccessLogOutputStdout = "stdout"
+	AccessLogOutputFile   = "file"
+	AccessLogOutputSyslog = "syslog"
+)
+
+const defaultAccessLogSampleRate = 1.0
+const defaultAccessLogFileMaxSizeInMegaByte = 100
+const defaultAccessLogFileMaxBackups = 5
+
+var defaultAccessLogRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// AccessLog configures the format and the output of the access log. The access log is enabled by Static.AccessLogEnabled.
+type AccessLog struct {
+	Format        string          `yaml:"format"`
+	Template      string          `yaml:"template"`
+	Fields        []string        `yaml:"fields,omitempty"`
+	Headers       []string        `yaml:"headers,omitempty"`
+	RedactHeaders []string        `yaml:"redact-headers,omitempty"`
+	SampleRate    *float64        `yaml:"sample-rate,omitempty"`
+	Output        AccessLogOutput `yaml:"output"`
+}
+
+// AccessLogOutput configures where the access log will be written to
+type AccessLogOutput struct {
+	Type                  string        `yaml:"type"`
+	File                  string        `yaml:"file"`
+	FileMaxSizeInMegaByte int64         `yaml:"file-max-size-in-mega-byte"`
+	FileRotationInterval  string        `yaml:"file-rotation-interval"`
+	FileMaxBackups        int           `yaml:"file-max-backups"`
+	SyslogNetwork         string        `yaml:"syslog-network"`
+	SyslogAddress         string        `yaml:"syslog-address"`
+	SyslogTag             string        `yaml:"syslog-tag"`
+	fileRotationInterval  time.Duration `yaml:"-"`
+}
+
+// GetFileRotationInterval returns a parsed duration, zero disables the time based rotation
+func (o AccessLogOutput) GetFileRotationInterval() time.Duration {
+	return o.fileRotationInterval
+}
+
+func parseAccessLog(a *AccessLog) error {
+	switch a.Format {
+	case "":
+		a.Format = AccessLogFormatCombined
+	case AccessLogFormatCommon, AccessLogFormatCombined, AccessLogFormatJSON:
+	case AccessLogFormatTemplate:
+		if _, err := template.New("access-log").Parse(a.Template); err != nil || a.Template == "" {
+			return fmt.Errorf("%w: invalid template \"%s\"", ErrorInvalidAccessLogConfig, a.Template)
+		}
+	default:
+		return fmt.Errorf("%w: unknown format \"%s\"", ErrorInvalidAccessLogConfig, a.Format)
+	}
+
+	if len(a.RedactHeaders) == 0 {
+		a.RedactHeaders = defaultAccessLogRedactHeaders
+	}
+
+	if a.SampleRate == nil {
+		rate := defaultAccessLogSampleRate
+		a.SampleRate = &rate
+	}
+	if *a.SampleRate < 0 || *a.SampleRate > 1 {
+		return fmt.Errorf("%w: sample rate has to be between 0 and 1", ErrorInvalidAccessLogConfig)
+	}
+
+	o := &a.Output
+	switch o.Type {
+	case "":
+		o.Type = AccessLogOutputStdout
+	case AccessLogOutputStdout:
+	case AccessLogOutputFile:
+		if o.File == "" {
+			return fmt.Errorf("%w: output type file requires a file path", ErrorInvalidAccessLogConfig)
+		}
+		if o.FileMaxSizeInMegaByte == 0 {
+			o.FileMaxSizeInMegaByte = defaultAccessLogFileMaxSizeInMegaByte
+		}
+		if o.FileMaxBackups == 0 {
+			o.FileMaxBackups = defaultAccessLogFileMaxBackups
+		}
+		if o.FileRotationInterval != "" {
+			interval, err := time.ParseDuration(o.FileRotationInterval)
+			if err != nil || interval < 0 {
+				return fmt.Errorf("%w: invalid file rotation interval \"%s\"", ErrorInvalidAccessLogConfig, o.FileRotationInterval)
+			}
+			o.fileRotationInterval = interval
+		}
+	case AccessLogOutputSyslog:
+		if o.SyslogTag == "" {
+			o.SyslogTag = "prox"
+		}
+	default:
+		return fmt.Errorf("%w: unknown output type \"%s\"", ErrorInvalidAccessLogConfig, o.Type)
+	}
+	return nil
+}
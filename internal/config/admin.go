@@ -0,0 +1,27 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrorInvalidAdminConfig = errors.New("static configuration has an invalid admin configuration")
+
+// Admin configures the authentication of the admin endpoints on the infra port
+type Admin struct {
+	Token string `yaml:"token"`
+}
+
+// parseAdmin requires a token as soon as one of the admin endpoints is enabled
+func parseAdmin(s *Static) error {
+	if s.Admin.Token != "" {
+		return nil
+	}
+	if s.HotRestart.EndpointEnabled {
+		return fmt.Errorf("%w: admin.token is required for hot-restart.endpoint-enabled", ErrorInvalidAdminConfig)
+	}
+	if s.Cache.Enabled && s.Cache.Admin.APIEnabled {
+		return fmt.Errorf("%w: admin.token is required for cache.admin.api-enabled", ErrorInvalidAdminConfig)
+	}
+	return nil
+}
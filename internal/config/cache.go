@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/ipfilter"
+)
+
+var ErrorInvalidCacheConfig = errors.New("static configuration has an invalid cache configuration")
+
+// Supported cache types
+const (
+	CacheTypeMemory = "memory"
+	CacheTypeDisk   = "disk"
+)
+
+// Supported cache eviction policies
+const (
+	CacheEvictionLRU = "lru"
+	CacheEvictionLFU = "lfu"
+)
+
+const defaultCacheCoalescingWaitTimeout = "5s"
+
+// Cache
+type Cache struct {
+	Enabled                bool            `yaml:"enabled"`
+	CacheMaxSizeInMegaByte int64           `yaml:"cache-max-size-in-mega-byte"`
+	Eviction               string          `yaml:"eviction"`
+	Type                   string          `yaml:"type"`
+	Directory              string          `yaml:"directory"`
+	Coalescing             CacheCoalescing `yaml:"coalescing"`
+	Admin                  CacheAdmin      `yaml:"admin"`
+}
+
+// CacheAdmin configures the inspection and purge API on the infra port and the PURGE method on the proxy ports
+type CacheAdmin struct {
+	APIEnabled           bool         `yaml:"api-enabled"`
+	PurgeMethodEnabled   bool         `yaml:"purge-method-enabled"`
+	PurgeAllowedIPs      []string     `yaml:"purge-allowed-ips,omitempty"`
+	purgeAllowedNetworks []*net.IPNet `yaml:"-"`
+}
+
+// IsPurgeAllowed checks if the client IP is allowed to use the PURGE method
+func (a CacheAdmin) IsPurgeAllowed(ip net.IP) bool {
+	return ipfilter.Contains(a.purgeAllowedNetworks, ip)
+}
+
+// CacheCoalescing configures the collapsing of concurrent cache misses of the same request into one upstream request
+type CacheCoalescing struct {
+	Enabled     bool          `yaml:"enabled"`
+	WaitTimeout string        `yaml:"wait-timeout"`
+	waitTimeout time.Duration `yaml:"-"`
+}
+
+// GetWaitTimeout returns a parsed duration
+func (c CacheCoalescing) GetWaitTimeout() time.Duration {
+	return c.waitTimeout
+}
+
+func parseCache(c *Cache) error {
+	switch c.Type {
+	case "":
+		c.Type = CacheTypeMemory
+	case CacheTypeMemory:
+	case CacheTypeDisk:
+		if c.Directory == "" {
+			return fmt.Errorf("%w: the disk cache requires a directory", ErrorInvalidCacheConfig)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type \"%s\"", ErrorInvalidCacheConfig, c.Type)
+	}
+
+	switch c.Eviction {
+	case "":
+		c.Eviction = CacheEvictionLRU
+	case CacheEvictionLRU, CacheEvictionLFU:
+	default:
+		return fmt.Errorf("%w: unknown eviction policy \"%s\"", ErrorInvalidCacheConfig, c.Eviction)
+	}
+
+	if c.Coalescing.WaitTimeout == "" {
+		c.Coalescing.WaitTimeout = defaultCacheCoalescingWaitTimeout
+	}
+	waitTimeout, err := time.ParseDuration(c.Coalescing.WaitTimeout)
+	if err != nil || waitTimeout <= 0 {
+		return fmt.Errorf("%w: invalid coalescing wait timeout \"%s\"", ErrorInvalidCacheConfig, c.Coalescing.WaitTimeout)
+	}
+	c.Coalescing.waitTimeout = waitTimeout
+	return parseCacheAdmin(&c.Admin)
+}
+
+func parseCacheAdmin(a *CacheAdmin) error {
+	if !a.PurgeMethodEnabled {
+		return nil
+	}
+	if len(a.PurgeAllowedIPs) == 0 {
+		a.PurgeAllowedIPs = []string{"127.0.0.1", "::1"}
+	}
+
+	a.purgeAllowedNetworks = make([]*net.IPNet, 0, len(a.PurgeAllowedIPs))
+	for _, allowed := range a.PurgeAllowedIPs {
+		network, err := ipfilter.ParseNetwork(allowed)
+		if err != nil {
+			return fmt.Errorf("%w: invalid purge allowed IP \"%s\"", ErrorInvalidCacheConfig, allowed)
+		}
+		a.purgeAllowedNetworks = append(a.purgeAllowedNetworks, network)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"net"
+	"testing"
+)
+
+func Test_parseCacheAdmin(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		admin       CacheAdmin
+		ip          string
+		wantAllowed bool
+		wantErr     bool
+	}{
+		{
+			name:        "DefaultAllowsLoopback",
+			admin:       CacheAdmin{PurgeMethodEnabled: true},
+			ip:          "::1",
+			wantAllowed: true,
+		},
+		{
+			name:        "CIDR",
+			admin:       CacheAdmin{PurgeMethodEnabled: true, PurgeAllowedIPs: []string{"10.0.0.0/8"}},
+			ip:          "10.1.2.3",
+			wantAllowed: true,
+		},
+		{
+			name:        "SingleIP",
+			admin:       CacheAdmin{PurgeMethodEnabled: true, PurgeAllowedIPs: []string{"192.168.0.1"}},
+			ip:          "192.168.0.2",
+			wantAllowed: false,
+		},
+		{
+			name:        "PurgeMethodDisabled",
+			admin:       CacheAdmin{PurgeAllowedIPs: []string{"10.0.0.0/8"}},
+			ip:          "10.1.2.3",
+			wantAllowed: false,
+		},
+		{
+			name:    "InvalidIP",
+			admin:   CacheAdmin{PurgeMethodEnabled: true, PurgeAllowedIPs: []string{"10.0.0.256"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := parseCacheAdmin(&tt.admin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCacheAdmin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := tt.admin.IsPurgeAllowed(net.ParseIP(tt.ip)); got != tt.wantAllowed {
+				t.Errorf("IsPurgeAllowed(%s) = %v, want %v", tt.ip, got, tt.wantAllowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/infra"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	ErrorNoIssuerCertificate = errors.New("certificate chain does not contain an issuer certificate")
+	ErrorNoOCSPServer        = errors.New("certificate does not define an ocsp server")
+	ErrorOCSPStatusNotGood   = errors.New("ocsp responder did not return the status good")
+)
+
+const ocspRequestTimeout = 10 * time.Second
+const ocspMaxResponseSizeInBytes = 1 << 20
+
+// certificateState holds the monitoring information of a stored certificate
+type certificateState struct {
+	labels          prometheus.Labels
+	warnedThreshold time.Duration
+	ocspNextUpdate  time.Time
+	// ocspUnsupported is set for certificates without an issuer or ocsp server, they are never stapled
+	ocspUnsupported bool
+}
+
+// StartMonitoring checks the expiry of all loaded certificates in the configured interval and refreshes the OCSP staples if enabled.
+// Blocks until the context is done.
+func (t *TLS) StartMonitoring(ctx context.Context) {
+	expiryTicker := time.NewTicker(t.certificates.GetExpiryCheckInterval())
+	defer expiryTicker.Stop()
+
+	var ocspRefresh <-chan time.Time
+	if t.certificates.OCSPStapling {
+		ocspTicker := time.NewTicker(t.certificates.GetOCSPRefreshInterval())
+		defer ocspTicker.Stop()
+		ocspRefresh = ocspTicker.C
+	}
+
+	for {
+		select {
+		case now := <-expiryTicker.C:
+			t.checkCertificatesExpiry(now)
+		case <-ocspRefresh:
+			t.refreshOCSPStaples()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// storeCertificate parses the leaf of the certificate, updates its expiry metric and stores it
+func (t *TLS) storeCertificate(pair Pair, cer tls.Certificate) error {
+	leaf, err := x509.ParseCertificate(cer.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cer.Leaf = leaf
+
+	t.mtx.Lock()
+	if state, ok := t.certStates[pair.ID()]; ok {
+		infra.TLSCertificateExpiryTimestamp.Delete(state.labels)
+	}
+	state := &certificateState{
+		labels: prometheus.Labels{
+			"certificate": pair.Certificate,
+			"common_name": leaf.Subject.CommonName,
+			"sans":        strings.Join(subjectAlternativeNames(leaf), ","),
+		},
+	}
+	if err := checkOCSPSupport(cer); err != nil {
+		state.ocspUnsupported = true
+		if t.certificates.OCSPStapling {
+			log.Warnf("ocsp stapling is skipped for tls certificate \"%s\", error: %s", pair.Certificate, err)
+		}
+	}
+	t.certStore[pair.ID()] = cer
+	t.certStates[pair.ID()] = state
+	infra.TLSCertificateExpiryTimestamp.With(state.labels).Set(float64(leaf.NotAfter.Unix()))
+	t.mtx.Unlock()
+
+	t.checkCertificatesExpiry(time.Now())
+	if t.certificates.OCSPStapling && !state.ocspUnsupported {
+		go t.refreshOCSPStaple(pair.ID())
+	}
+	return nil
+}
+
+// deleteCertificate removes the certificate and its metrics. The caller has to hold the write lock.
+func (t *TLS) deleteCertificate(id string) {
+	if state, ok := t.certStates[id]; ok {
+		infra.TLSCertificateExpiryTimestamp.Delete(state.labels)
+	}
+	delete(t.certStore, id)
+	delete(t.certStates, id)
+}
+
+func (t *TLS) checkCertificatesExpiry(now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for id, cert := range t.certStore {
+		state, ok := t.certStates[id]
+		if !ok {
+			continue
+		}
+
+		remaining := cert.Leaf.NotAfter.Sub(now)
+		if remaining <= 0 {
+			log.Errorf("tls certificate \"%s\" (%s) expired at %s", state.labels["certificate"], state.labels["common_name"], cert.Leaf.NotAfter)
+			continue
+		}
+
+		threshold, crossed := crossedThreshold(t.certificates.GetExpiryWarningThresholds(), remaining)
+		if crossed && threshold != state.warnedThreshold {
+			log.Warnf("tls certificate \"%s\" (%s) expires in %s at %s", state.labels["certificate"], state.labels["common_name"], remaining.Round(time.Minute), cert.Leaf.NotAfter)
+			state.warnedThreshold = threshold
+		}
+	}
+}
+
+// crossedThreshold returns the smallest threshold which is larger than the remaining duration.
+// The thresholds have to be sorted from the largest to the smallest duration.
+func crossedThreshold(thresholds []time.Duration, remaining time.Duration) (time.Duration, bool) {
+	var crossed bool
+	var threshold time.Duration
+	for _, th := range thresholds {
+		if remaining <= th {
+			threshold = th
+			crossed = true
+		}
+	}
+	return threshold, crossed
+}
+
+func (t *TLS) refreshOCSPStaples() {
+	t.mtx.RLock()
+	ids := make([]string, 0, len(t.certStore))
+	for id := range t.certStore {
+		if state, ok := t.certStates[id]; ok && !state.ocspUnsupported {
+			ids = append(ids, id)
+		}
+	}
+	t.mtx.RUnlock()
+
+	for _, id := range ids {
+		t.refreshOCSPStaple(id)
+	}
+}
+
+func (t *TLS) refreshOCSPStaple(id string) {
+	t.mtx.RLock()
+	cert, ok := t.certStore[id]
+	t.mtx.RUnlock()
+	if !ok {
+		return
+	}
+
+	staple, ocspResp, err := fetchOCSPResponse(t.ocspClient, cert)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	stored, ok := t.certStore[id]
+	if !ok || !bytes.Equal(stored.Certificate[0], cert.Certificate[0]) {
+		return
+	}
+	state := t.certStates[id]
+
+	if err != nil {
+		log.Warnf("could not refresh ocsp staple for tls certificate \"%s\", error: %s", state.labels["certificate"], err)
+		if stored.OCSPStaple != nil && !state.ocspNextUpdate.IsZero() && time.Now().After(state.ocspNextUpdate) {
+			log.Warnf("removed outdated ocsp staple of tls certificate \"%s\"", state.labels["certificate"])
+			stored.OCSPStaple = nil
+			t.certStore[id] = stored
+		}
+		return
+	}
+
+	stored.OCSPStaple = staple
+	t.certStore[id] = stored
+	state.ocspNextUpdate = ocspResp.NextUpdate
+	log.Debugf("Refreshed ocsp staple for tls certificate \"%s\", next update at %s", state.labels["certificate"], ocspResp.NextUpdate)
+}
+
+// checkOCSPSupport checks if the certificate chain contains an issuer and the leaf defines an ocsp server, e.g. self-signed certificates do not
+func checkOCSPSupport(cert tls.Certificate) error {
+	if len(cert.Certificate) < 2 {
+		return ErrorNoIssuerCertificate
+	}
+	if len(cert.Leaf.OCSPServer) == 0 {
+		return ErrorNoOCSPServer
+	}
+	return nil
+}
+
+func fetchOCSPResponse(client *http.Client, cert tls.Certificate) ([]byte, *ocsp.Response, error) {
+	if err := checkOCSPSupport(cert); err != nil {
+		return nil, nil, err
+	}
+
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ocspReq, err := ocsp.CreateRequest(cert.Leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := client.Post(cert.Leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(ocspReq))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("ocsp responder returned status code %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, ocspMaxResponseSizeInBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ocspResp, err := ocsp.ParseResponseForCert(body, cert.Leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ocspResp.Status != ocsp.Good {
+		return nil, nil, ErrorOCSPStatusNotGood
+	}
+	return body, ocspResp, nil
+}
+
+func subjectAlternativeNames(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses))
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
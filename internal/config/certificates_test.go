@@ -0,0 +1,226 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/infra"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "prox test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{cert: cert, key: key}
+}
+
+func (ca testCA) issue(t *testing.T, notAfter time.Time, ocspServer string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost", "prox.localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		OCSPServer:   []string{ocspServer},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der, ca.cert.Raw}, PrivateKey: key}
+}
+
+func newTestOCSPResponder(t *testing.T, ca testCA, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, ca.key)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		_, _ = w.Write(resp)
+	}))
+}
+
+func Test_crossedThreshold(t *testing.T) {
+	t.Parallel()
+	thresholds := []time.Duration{720 * time.Hour, 168 * time.Hour, 24 * time.Hour}
+	tests := []struct {
+		name        string
+		remaining   time.Duration
+		wantCrossed bool
+		want        time.Duration
+	}{
+		{name: "NotCrossed", remaining: 1000 * time.Hour, wantCrossed: false},
+		{name: "FirstThreshold", remaining: 500 * time.Hour, wantCrossed: true, want: 720 * time.Hour},
+		{name: "LastThreshold", remaining: time.Hour, wantCrossed: true, want: 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, crossed := crossedThreshold(thresholds, tt.remaining)
+			if crossed != tt.wantCrossed {
+				t.Errorf("crossedThreshold() crossed = %v, want %v", crossed, tt.wantCrossed)
+			}
+			if got != tt.want {
+				t.Errorf("crossedThreshold() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fetchOCSPResponse(t *testing.T) {
+	t.Parallel()
+	ca := newTestCA(t)
+
+	tests := []struct {
+		name        string
+		status      int
+		withoutCA   bool
+		wantErrType error
+	}{
+		{name: "Good", status: ocsp.Good},
+		{name: "Revoked", status: ocsp.Revoked, wantErrType: ErrorOCSPStatusNotGood},
+		{name: "NoIssuer", status: ocsp.Good, withoutCA: true, wantErrType: ErrorNoIssuerCertificate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responder := newTestOCSPResponder(t, ca, tt.status)
+			defer responder.Close()
+
+			cert := ca.issue(t, time.Now().Add(time.Hour), responder.URL)
+			if tt.withoutCA {
+				cert.Certificate = cert.Certificate[:1]
+			}
+			leaf, err := x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert.Leaf = leaf
+
+			staple, _, err := fetchOCSPResponse(responder.Client(), cert)
+			if !errors.Is(err, tt.wantErrType) {
+				t.Errorf("fetchOCSPResponse() error = %v, want %v", err, tt.wantErrType)
+				return
+			}
+			if tt.wantErrType == nil && len(staple) == 0 {
+				t.Error("fetchOCSPResponse() returned an empty staple")
+			}
+		})
+	}
+}
+
+func TestTLS_storeCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	responder := newTestOCSPResponder(t, ca, ocsp.Good)
+	defer responder.Close()
+
+	certificates := Certificates{OCSPStapling: false}
+	if err := parseCertificates(&certificates); err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConf := NewDynamicTLSConfig("", certificates)
+	tlsConf.ocspClient = responder.Client()
+
+	notAfter := time.Now().Add(100 * time.Hour).Truncate(time.Second)
+	pair := Pair{Certificate: "test.pem", Key: "test-key.pem"}
+	if err := tlsConf.storeCertificate(pair, ca.issue(t, notAfter, responder.URL)); err != nil {
+		t.Fatal(err)
+	}
+
+	state := tlsConf.certStates[pair.ID()]
+	if state.labels["sans"] != "localhost,prox.localhost" {
+		t.Errorf("storeCertificate() sans label = %s", state.labels["sans"])
+	}
+	if state.warnedThreshold != 168*time.Hour {
+		t.Errorf("storeCertificate() warned threshold = %s, want %s", state.warnedThreshold, 168*time.Hour)
+	}
+
+	if got := testutil.ToFloat64(infra.TLSCertificateExpiryTimestamp.With(state.labels)); got != float64(notAfter.Unix()) {
+		t.Errorf("storeCertificate() expiry metric = %f, want %d", got, notAfter.Unix())
+	}
+
+	tlsConf.refreshOCSPStaple(pair.ID())
+	if len(tlsConf.certStore[pair.ID()].OCSPStaple) == 0 {
+		t.Error("refreshOCSPStaple() did not staple the ocsp response")
+	}
+
+	selfSigned := Pair{Certificate: "self-signed.pem", Key: "self-signed-key.pem"}
+	cert := ca.issue(t, notAfter, responder.URL)
+	cert.Certificate = cert.Certificate[:1]
+	if err := tlsConf.storeCertificate(selfSigned, cert); err != nil {
+		t.Fatal(err)
+	}
+	if !tlsConf.certStates[selfSigned.ID()].ocspUnsupported {
+		t.Error("storeCertificate() did not detect the missing issuer certificate")
+	}
+	tlsConf.refreshOCSPStaples()
+	if len(tlsConf.certStore[selfSigned.ID()].OCSPStaple) != 0 {
+		t.Error("refreshOCSPStaples() stapled a certificate without an issuer")
+	}
+
+	tlsConf.mtx.Lock()
+	tlsConf.deleteCertificate(selfSigned.ID())
+	tlsConf.deleteCertificate(pair.ID())
+	tlsConf.mtx.Unlock()
+	if got := testutil.CollectAndCount(infra.TLSCertificateExpiryTimestamp); got != 0 {
+		t.Errorf("deleteCertificate() did not remove the expiry metric, got %d series", got)
+	}
+}
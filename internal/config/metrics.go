@@ -0,0 +1,43 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrorInvalidMetricsConfig = errors.New("static configuration has an invalid metrics configuration")
+
+var defaultMetricsDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+var defaultMetricsSizeBuckets = []float64{100, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9}
+
+// Metrics configures the buckets of the exported prometheus histograms
+type Metrics struct {
+	DurationBuckets []float64 `yaml:"duration-buckets,omitempty"`
+	SizeBuckets     []float64 `yaml:"size-buckets,omitempty"`
+}
+
+func parseMetrics(m *Metrics) error {
+	if len(m.DurationBuckets) == 0 {
+		m.DurationBuckets = defaultMetricsDurationBuckets
+	}
+	if len(m.SizeBuckets) == 0 {
+		m.SizeBuckets = defaultMetricsSizeBuckets
+	}
+
+	if !isIncreasing(m.DurationBuckets) {
+		return fmt.Errorf("%w: duration buckets %v have to be in increasing order", ErrorInvalidMetricsConfig, m.DurationBuckets)
+	}
+	if !isIncreasing(m.SizeBuckets) {
+		return fmt.Errorf("%w: size buckets %v have to be in increasing order", ErrorInvalidMetricsConfig, m.SizeBuckets)
+	}
+	return nil
+}
+
+func isIncreasing(buckets []float64) bool {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/fwiedmann/prox/internal/ipfilter"
+)
+
+var ErrorInvalidPortIPFilter = errors.New("static port configuration has an invalid ip filter")
+
+// PortIPFilter configures the resolution of the real client IP and the ip filter for all requests of a Port.
+// The allow and deny lists can be extended by a file, which is reloaded on changes.
+type PortIPFilter struct {
+	TrustedProxies []string       `yaml:"trusted-proxies,omitempty"`
+	Rules          ipfilter.Rules `yaml:",inline"`
+	File           string         `yaml:"file"`
+	trustedProxies []*net.IPNet   `yaml:"-"`
+}
+
+// GetTrustedProxies returns the parsed networks of the trusted proxies
+func (f PortIPFilter) GetTrustedProxies() []*net.IPNet {
+	return f.trustedProxies
+}
+
+// IsEnabled checks if an allow or deny list or a file is configured
+func (f PortIPFilter) IsEnabled() bool {
+	return f.File != "" || !f.Rules.IsEmpty()
+}
+
+func parsePortIPFilter(p *Port) error {
+	f := &p.IPFilter
+	trustedProxies, err := ipfilter.ParseNetworks(f.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("%w: port \"%s\": invalid trusted proxies: %s", ErrorInvalidPortIPFilter, p.Name, err)
+	}
+	f.trustedProxies = trustedProxies
+
+	if err := f.Rules.Parse(); err != nil {
+		return fmt.Errorf("%w: port \"%s\": %s", ErrorInvalidPortIPFilter, p.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ErrorInvalidPortLimits = errors.New("static port configuration has invalid limits")
+
+const (
+	defaultReadHeaderTimeout          = "10s"
+	defaultIdleTimeout                = "120s"
+	defaultMinTransferRateGracePeriod = "5s"
+	defaultDisabledTimeout            = "0s"
+)
+
+// PortLimits protect a Port against slow clients and oversized request headers
+type PortLimits struct {
+	ReadHeaderTimeout             string        `yaml:"read-header-timeout"`
+	ReadTimeout                   string        `yaml:"read-timeout"`
+	WriteTimeout                  string        `yaml:"write-timeout"`
+	IdleTimeout                   string        `yaml:"idle-timeout"`
+	MaxHeaderBytes                int           `yaml:"max-header-bytes"`
+	MinTransferRateBytesPerSecond int64         `yaml:"min-transfer-rate-bytes-per-second"`
+	MinTransferRateGracePeriod    string        `yaml:"min-transfer-rate-grace-period"`
+	readHeaderTimeout             time.Duration `yaml:"-"`
+	readTimeout                   time.Duration `yaml:"-"`
+	writeTimeout                  time.Duration `yaml:"-"`
+	idleTimeout                   time.Duration `yaml:"-"`
+	minTransferRateGracePeriod    time.Duration `yaml:"-"`
+}
+
+// GetReadHeaderTimeout returns a parsed duration
+func (l PortLimits) GetReadHeaderTimeout() time.Duration {
+	return l.readHeaderTimeout
+}
+
+// GetReadTimeout returns a parsed duration, zero means no timeout
+func (l PortLimits) GetReadTimeout() time.Duration {
+	return l.readTimeout
+}
+
+// GetWriteTimeout returns a parsed duration, zero means no timeout
+func (l PortLimits) GetWriteTimeout() time.Duration {
+	return l.writeTimeout
+}
+
+// GetIdleTimeout returns a parsed duration
+func (l PortLimits) GetIdleTimeout() time.Duration {
+	return l.idleTimeout
+}
+
+// GetMinTransferRateGracePeriod returns a parsed duration
+func (l PortLimits) GetMinTransferRateGracePeriod() time.Duration {
+	return l.minTransferRateGracePeriod
+}
+
+// ConfigureServer applies the timeouts and the max header bytes to the server
+func (l PortLimits) ConfigureServer(s *http.Server) {
+	s.ReadHeaderTimeout = l.readHeaderTimeout
+	s.ReadTimeout = l.readTimeout
+	s.WriteTimeout = l.writeTimeout
+	s.IdleTimeout = l.idleTimeout
+	s.MaxHeaderBytes = l.MaxHeaderBytes
+}
+
+func parsePortLimits(p *Port) error {
+	l := &p.Limits
+	if l.ReadHeaderTimeout == "" {
+		l.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if l.ReadTimeout == "" {
+		l.ReadTimeout = defaultDisabledTimeout
+	}
+	if l.WriteTimeout == "" {
+		l.WriteTimeout = defaultDisabledTimeout
+	}
+	if l.IdleTimeout == "" {
+		l.IdleTimeout = defaultIdleTimeout
+	}
+	if l.MinTransferRateGracePeriod == "" {
+		l.MinTransferRateGracePeriod = defaultMinTransferRateGracePeriod
+	}
+	if l.MaxHeaderBytes == 0 {
+		l.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+
+	for _, d := range []struct {
+		name   string
+		value  string
+		parsed *time.Duration
+	}{
+		{name: "read-header-timeout", value: l.ReadHeaderTimeout, parsed: &l.readHeaderTimeout},
+		{name: "read-timeout", value: l.ReadTimeout, parsed: &l.readTimeout},
+		{name: "write-timeout", value: l.WriteTimeout, parsed: &l.writeTimeout},
+		{name: "idle-timeout", value: l.IdleTimeout, parsed: &l.idleTimeout},
+		{name: "min-transfer-rate-grace-period", value: l.MinTransferRateGracePeriod, parsed: &l.minTransferRateGracePeriod},
+	} {
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("%w: port \"%s\" has an invalid %s \"%s\"", ErrorInvalidPortLimits, p.Name, d.name, d.value)
+		}
+		*d.parsed = parsed
+	}
+
+	if l.MaxHeaderBytes < 0 {
+		return fmt.Errorf("%w: port \"%s\" has a negative max-header-bytes", ErrorInvalidPortLimits, p.Name)
+	}
+	if l.MinTransferRateBytesPerSecond < 0 {
+		return fmt.Errorf("%w: port \"%s\" has a negative min-transfer-rate-bytes-per-second", ErrorInvalidPortLimits, p.Name)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var defaultTestPortLimits = PortLimits{
+	ReadHeaderTimeout:          "10s",
+	ReadTimeout:                "0s",
+	WriteTimeout:               "0s",
+	IdleTimeout:                "120s",
+	MaxHeaderBytes:             http.DefaultMaxHeaderBytes,
+	MinTransferRateGracePeriod: "5s",
+	readHeaderTimeout:          10 * time.Second,
+	idleTimeout:                120 * time.Second,
+	minTransferRateGracePeriod: 5 * time.Second,
+}
+
+func Test_parsePortLimits(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		limits  PortLimits
+		want    PortLimits
+		wantErr error
+	}{
+		{
+			name: "Defaults",
+			want: defaultTestPortLimits,
+		},
+		{
+			name: "Configured",
+			limits: PortLimits{
+				ReadHeaderTimeout:             "5s",
+				ReadTimeout:                   "1m",
+				WriteTimeout:                  "2m",
+				IdleTimeout:                   "30s",
+				MaxHeaderBytes:                8192,
+				MinTransferRateBytesPerSecond: 240,
+				MinTransferRateGracePeriod:    "10s",
+			},
+			want: PortLimits{
+				ReadHeaderTimeout:             "5s",
+				ReadTimeout:                   "1m",
+				WriteTimeout:                  "2m",
+				IdleTimeout:                   "30s",
+				MaxHeaderBytes:                8192,
+				MinTransferRateBytesPerSecond: 240,
+				MinTransferRateGracePeriod:    "10s",
+				readHeaderTimeout:             5 * time.Second,
+				readTimeout:                   time.Minute,
+				writeTimeout:                  2 * time.Minute,
+				idleTimeout:                   30 * time.Second,
+				minTransferRateGracePeriod:    10 * time.Second,
+			},
+		},
+		{
+			name:    "InvalidTimeout",
+			limits:  PortLimits{ReadTimeout: "-1s"},
+			wantErr: ErrorInvalidPortLimits,
+		},
+		{
+			name:    "NegativeMaxHeaderBytes",
+			limits:  PortLimits{MaxHeaderBytes: -1},
+			wantErr: ErrorInvalidPortLimits,
+		},
+		{
+			name:    "NegativeMinTransferRate",
+			limits:  PortLimits{MinTransferRateBytesPerSecond: -1},
+			wantErr: ErrorInvalidPortLimits,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p := Port{Name: "test", Limits: tt.limits}
+			err := parsePortLimits(&p)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parsePortLimits() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(p.Limits, tt.want) {
+				t.Errorf("parsePortLimits() got %+v, want %+v", p.Limits, tt.want)
+			}
+		})
+	}
+}
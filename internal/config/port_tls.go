@@ -0,0 +1,227 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fwiedmann/prox/internal/filewatch"
+	"github.com/fwiedmann/prox/internal/modifiers"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrorInvalidTLSOptions       = errors.New("static port configuration has invalid tls options")
+	ErrorInvalidSessionTicketKey = errors.New("session ticket key file contains an invalid key, keys have to be base64 encoded with a length of 32 bytes")
+)
+
+const sessionTicketKeyLength = 32
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// TLSOptions configures the tls policy of a Port
+type TLSOptions struct {
+	MinVersion           string                `yaml:"min-version"`
+	MaxVersion           string                `yaml:"max-version"`
+	CipherSuites         []string              `yaml:"cipher-suites,omitempty"`
+	CurvePreferences     []string              `yaml:"curve-preferences,omitempty"`
+	ALPNProtocols        []string              `yaml:"alpn-protocols,omitempty"`
+	SessionTicketKeyFile string                `yaml:"session-ticket-key-file"`
+	HSTS                 modifiers.HSTSOptions `yaml:"hsts"`
+	minVersion           uint16                `yaml:"-"`
+	maxVersion           uint16                `yaml:"-"`
+	cipherSuites         []uint16              `yaml:"-"`
+	curvePreferences     []tls.CurveID         `yaml:"-"`
+}
+
+// IsHTTP2Enabled reports if the h2 protocol may be negotiated via ALPN
+func (o TLSOptions) IsHTTP2Enabled() bool {
+	if len(o.ALPNProtocols) == 0 {
+		return true
+	}
+	for _, proto := range o.ALPNProtocols {
+		if proto == "h2" {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTLSOptions(p *Port) error {
+	o := &p.TLSOptions
+	if !p.TlSEnabled && !isEmptyTLSOptions(*o) {
+		return fmt.Errorf("%w: port \"%s\" has tls options configured but tls is disabled", ErrorInvalidTLSOptions, p.Name)
+	}
+
+	if o.MinVersion != "" {
+		version, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return fmt.Errorf("%w: port \"%s\" has an unknown min-version \"%s\"", ErrorInvalidTLSOptions, p.Name, o.MinVersion)
+		}
+		o.minVersion = version
+	}
+
+	if o.MaxVersion != "" {
+		version, ok := tlsVersions[o.MaxVersion]
+		if !ok {
+			return fmt.Errorf("%w: port \"%s\" has an unknown max-version \"%s\"", ErrorInvalidTLSOptions, p.Name, o.MaxVersion)
+		}
+		o.maxVersion = version
+	}
+
+	if o.minVersion != 0 && o.maxVersion != 0 && o.minVersion > o.maxVersion {
+		return fmt.Errorf("%w: port \"%s\" has a min-version which is greater than the max-version", ErrorInvalidTLSOptions, p.Name)
+	}
+
+	if len(o.CipherSuites) != 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+			suites[suite.Name] = suite.ID
+		}
+		o.cipherSuites = make([]uint16, 0, len(o.CipherSuites))
+		for _, name := range o.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return fmt.Errorf("%w: port \"%s\" has an unknown cipher suite \"%s\"", ErrorInvalidTLSOptions, p.Name, name)
+			}
+			o.cipherSuites = append(o.cipherSuites, id)
+		}
+	}
+
+	if len(o.CurvePreferences) != 0 {
+		o.curvePreferences = make([]tls.CurveID, 0, len(o.CurvePreferences))
+		for _, name := range o.CurvePreferences {
+			curve, ok := tlsCurves[name]
+			if !ok {
+				return fmt.Errorf("%w: port \"%s\" has an unknown curve \"%s\"", ErrorInvalidTLSOptions, p.Name, name)
+			}
+			o.curvePreferences = append(o.curvePreferences, curve)
+		}
+	}
+
+	if o.SessionTicketKeyFile != "" {
+		if _, err := readSessionTicketKeys(o.SessionTicketKeyFile); err != nil {
+			return fmt.Errorf("%w: port \"%s\": %s", ErrorInvalidTLSOptions, p.Name, err)
+		}
+	}
+
+	if err := o.HSTS.Parse(); err != nil {
+		return fmt.Errorf("%w: port \"%s\": %s", ErrorInvalidTLSOptions, p.Name, err)
+	}
+	return nil
+}
+
+func isEmptyTLSOptions(o TLSOptions) bool {
+	return o.MinVersion == "" && o.MaxVersion == "" && len(o.CipherSuites) == 0 && len(o.CurvePreferences) == 0 &&
+		len(o.ALPNProtocols) == 0 && o.SessionTicketKeyFile == "" && !o.HSTS.Enabled
+}
+
+// readSessionTicketKeys reads one base64 encoded key per line. The first key will be used to encrypt new session tickets.
+func readSessionTicketKeys(path string) ([][sessionTicketKeyLength]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([][sessionTicketKeyLength]byte, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(decoded) != sessionTicketKeyLength {
+			return nil, ErrorInvalidSessionTicketKey
+		}
+		var key [sessionTicketKeyLength]byte
+		copy(key[:], decoded)
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrorInvalidSessionTicketKey
+	}
+	return keys, nil
+}
+
+// PortTLS holds the tls configuration of a Port listener
+type PortTLS struct {
+	options TLSOptions
+	current atomic.Value
+}
+
+// NewPortTLS creates the tls configuration for the given options. Certificates will be looked up with getCertificate.
+func NewPortTLS(options TLSOptions, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*PortTLS, error) {
+	conf := &tls.Config{
+		GetCertificate:   getCertificate,
+		MinVersion:       options.minVersion,
+		MaxVersion:       options.maxVersion,
+		CipherSuites:     options.cipherSuites,
+		CurvePreferences: options.curvePreferences,
+		NextProtos:       options.ALPNProtocols,
+	}
+
+	if len(conf.NextProtos) == 0 {
+		conf.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	if options.SessionTicketKeyFile != "" {
+		keys, err := readSessionTicketKeys(options.SessionTicketKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.SetSessionTicketKeys(keys)
+	}
+
+	pt := &PortTLS{options: options}
+	pt.current.Store(conf)
+	return pt, nil
+}
+
+// ServerConfig returns the *tls.Config for a http.Server. Each handshake will use the current configuration of the PortTLS.
+func (pt *PortTLS) ServerConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return pt.current.Load().(*tls.Config), nil
+		},
+		NextProtos: pt.current.Load().(*tls.Config).NextProtos,
+	}
+}
+
+// StartSessionTicketKeyWatch reloads the session ticket keys on changes of the configured key file.
+// Returns immediately if no key file is configured.
+func (pt *PortTLS) StartSessionTicketKeyWatch(ctx context.Context) {
+	if pt.options.SessionTicketKeyFile == "" {
+		return
+	}
+
+	filewatch.Watch(ctx, pt.options.SessionTicketKeyFile, func() {
+		keys, err := readSessionTicketKeys(pt.options.SessionTicketKeyFile)
+		if err != nil {
+			log.Errorf("could not rotate session ticket keys from file \"%s\", error: %s", pt.options.SessionTicketKeyFile, err)
+			return
+		}
+		pt.current.Load().(*tls.Config).SetSessionTicketKeys(keys)
+		log.Infof("Rotated session ticket keys from file \"%s\"", pt.options.SessionTicketKeyFile)
+	})
+}
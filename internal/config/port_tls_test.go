@@ -0,0 +1,143 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fwiedmann/prox/internal/modifiers"
+)
+
+func writeSessionTicketKeyFile(t *testing.T, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "ticket.keys")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_parseTLSOptions(t *testing.T) {
+	t.Parallel()
+	validKey := base64.StdEncoding.EncodeToString(make([]byte, sessionTicketKeyLength))
+	validKeyFile := writeSessionTicketKeyFile(t, "# active key", validKey, validKey)
+	parsedHSTS := modifiers.HSTSOptions{Enabled: true, IncludeSubDomains: true}
+	if err := parsedHSTS.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		port    Port
+		want    TLSOptions
+		wantErr bool
+	}{
+		{
+			name: "Valid",
+			port: Port{Name: "https", TlSEnabled: true, TLSOptions: TLSOptions{
+				MinVersion:       "1.2",
+				MaxVersion:       "1.3",
+				CipherSuites:     []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+				CurvePreferences: []string{"X25519", "P256"},
+				HSTS:             modifiers.HSTSOptions{Enabled: true, IncludeSubDomains: true},
+			}},
+			want: TLSOptions{
+				MinVersion:       "1.2",
+				MaxVersion:       "1.3",
+				CipherSuites:     []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+				CurvePreferences: []string{"X25519", "P256"},
+				HSTS:             parsedHSTS,
+				minVersion:       tls.VersionTLS12,
+				maxVersion:       tls.VersionTLS13,
+				cipherSuites:     []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+				curvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+			},
+		},
+		{
+			name:    "OptionsWithoutTLS",
+			port:    Port{Name: "http", TLSOptions: TLSOptions{MinVersion: "1.2"}},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidHSTSMaxAge",
+			port:    Port{Name: "https", TlSEnabled: true, TLSOptions: TLSOptions{HSTS: modifiers.HSTSOptions{Enabled: true, MaxAge: "-1h"}}},
+			wantErr: true,
+		},
+		{
+			name:    "UnknownVersion",
+			port:    Port{Name: "https", TlSEnabled: true, TLSOptions: TLSOptions{MinVersion: "1.4"}},
+			wantErr: true,
+		},
+		{
+			name:    "MinGreaterThanMax",
+			port:    Port{Name: "https", TlSEnabled: true, TLSOptions: TLSOptions{MinVersion: "1.3", MaxVersion: "1.2"}},
+			wantErr: true,
+		},
+		{
+			name:    "UnknownCipherSuite",
+			port:    Port{Name: "https", TlSEnabled: true, TLSOptions: TLSOptions{CipherSuites: []string{"TLS_NULL"}}},
+			wantErr: true,
+		},
+		{
+			name:    "UnknownCurve",
+			port:    Port{Name: "https", TlSEnabled: true, TLSOptions: TLSOptions{CurvePreferences: []string{"P224"}}},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidSessionTicketKey",
+			port:    Port{Name: "https", TlSEnabled: true, TLSOptions: TLSOptions{SessionTicketKeyFile: writeSessionTicketKeyFile(t, "dG9vLXNob3J0")}},
+			wantErr: true,
+		},
+		{
+			name: "ValidSessionTicketKey",
+			port: Port{Name: "https", TlSEnabled: true, TLSOptions: TLSOptions{SessionTicketKeyFile: validKeyFile}},
+			want: TLSOptions{SessionTicketKeyFile: validKeyFile},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseTLSOptions(&tt.port)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTLSOptions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !errors.Is(err, ErrorInvalidTLSOptions) {
+				t.Errorf("parseTLSOptions() error = %v, want %v", err, ErrorInvalidTLSOptions)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.port.TLSOptions, tt.want) {
+				t.Errorf("parseTLSOptions() got = %+v, want %+v", tt.port.TLSOptions, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortTLS_ServerConfig(t *testing.T) {
+	t.Parallel()
+	port := Port{Name: "https", TlSEnabled: true, TLSOptions: TLSOptions{MinVersion: "1.2", ALPNProtocols: []string{"http/1.1"}}}
+	if err := parseTLSOptions(&port); err != nil {
+		t.Fatal(err)
+	}
+
+	pt, err := NewPortTLS(port.TLSOptions, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := pt.ServerConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf.NextProtos, []string{"http/1.1"}) {
+		t.Errorf("ServerConfig() next protos = %v, want %v", conf.NextProtos, []string{"http/1.1"})
+	}
+	if conf.MinVersion != tls.VersionTLS12 {
+		t.Errorf("ServerConfig() min version = %x, want %x", conf.MinVersion, tls.VersionTLS12)
+	}
+	if port.TLSOptions.IsHTTP2Enabled() {
+		t.Error("IsHTTP2Enabled() = true, want false")
+	}
+}
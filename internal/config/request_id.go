@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrorInvalidRequestIDConfig = errors.New("static configuration has an invalid request id configuration")
+
+// Supported request id formats
+const (
+	RequestIDFormatUUID = "uuid"
+	RequestIDFormatULID = "ulid"
+)
+
+const defaultRequestIDHeader = "X-Request-ID"
+
+// RequestID configures the request id which correlates the logs of prox with the logs of the upstreams
+type RequestID struct {
+	Enabled          bool   `yaml:"enabled"`
+	Header           string `yaml:"header"`
+	Format           string `yaml:"format"`
+	OverrideIncoming bool   `yaml:"override-incoming"`
+}
+
+func parseRequestID(r *RequestID) error {
+	if r.Header == "" {
+		r.Header = defaultRequestIDHeader
+	}
+
+	switch r.Format {
+	case "":
+		r.Format = RequestIDFormatUUID
+	case RequestIDFormatUUID, RequestIDFormatULID:
+	default:
+		return fmt.Errorf("%w: unknown format \"%s\"", ErrorInvalidRequestIDConfig, r.Format)
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/fwiedmann/prox/internal/errorpage"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
@@ -14,27 +18,101 @@ import (
 var (
 	ErrorInvalidFileType             = errors.New("given file type is invalid, only .yaml or yml is allowed")
 	ErrorDuplicatedPortConfiguration = errors.New("static configuration has an invalid duplicated port configuration")
+	ErrorInvalidCertificatesConfig   = errors.New("static configuration has an invalid certificates configuration")
+	ErrorInvalidShutdownConfig       = errors.New("static configuration has an invalid shutdown configuration")
+	ErrorInvalidHotRestartConfig     = errors.New("static configuration has an invalid hot restart configuration")
 )
 
+const defaultCertificateExpiryCheckInterval = "1h"
+const defaultCertificateOCSPRefreshInterval = "1h"
+const defaultShutdownPreStopDelay = "0s"
+const defaultShutdownDrainTimeout = "30s"
+const defaultHotRestartReadyTimeout = "30s"
+
+var defaultCertificateExpiryWarningThresholds = []string{"720h", "168h", "24h"}
+
 // Static
 type Static struct {
-	Ports            []Port `yaml:"ports"`
-	Cache            Cache  `yaml:"cache"`
-	AccessLogEnabled bool   `yaml:"access-log-enabled"`
-	InfraPort        uint16 `yaml:"infra-port"`
+	Ports            []Port           `yaml:"ports"`
+	Cache            Cache            `yaml:"cache"`
+	AccessLogEnabled bool             `yaml:"access-log-enabled"`
+	AccessLog        AccessLog        `yaml:"access-log"`
+	InfraPort        uint16           `yaml:"infra-port"`
+	Certificates     Certificates     `yaml:"certificates"`
+	Shutdown         Shutdown         `yaml:"shutdown"`
+	HotRestart       HotRestart       `yaml:"hot-restart"`
+	Metrics          Metrics          `yaml:"metrics"`
+	Tracing          Tracing          `yaml:"tracing"`
+	RequestID        RequestID        `yaml:"request-id"`
+	ErrorPages       errorpage.Config `yaml:"error-pages"`
+	Admin            Admin            `yaml:"admin"`
 }
 
 // Port
 type Port struct {
-	Name       string `yaml:"name"`
-	Addr       uint16 `yaml:"port"`
-	TlSEnabled bool   `yaml:"tls"`
+	Name       string       `yaml:"name"`
+	Addr       uint16       `yaml:"port"`
+	TlSEnabled bool         `yaml:"tls"`
+	TLSOptions TLSOptions   `yaml:"tls-options"`
+	Limits     PortLimits   `yaml:"limits"`
+	IPFilter   PortIPFilter `yaml:"ip-filter"`
+}
+
+// Certificates configures the monitoring of the loaded tls certificates
+type Certificates struct {
+	ExpiryWarningThresholds []string        `yaml:"expiry-warning-thresholds"`
+	ExpiryCheckInterval     string          `yaml:"expiry-check-interval"`
+	OCSPStapling            bool            `yaml:"ocsp-stapling"`
+	OCSPRefreshInterval     string          `yaml:"ocsp-refresh-interval"`
+	expiryWarningThresholds []time.Duration `yaml:"-"`
+	expiryCheckInterval     time.Duration   `yaml:"-"`
+	ocspRefreshInterval     time.Duration   `yaml:"-"`
+}
+
+// GetExpiryWarningThresholds returns the parsed thresholds sorted from the largest to the smallest duration
+func (c Certificates) GetExpiryWarningThresholds() []time.Duration {
+	return c.expiryWarningThresholds
+}
+
+// GetExpiryCheckInterval returns a parsed duration
+func (c Certificates) GetExpiryCheckInterval() time.Duration {
+	return c.expiryCheckInterval
+}
+
+// GetOCSPRefreshInterval returns a parsed duration
+func (c Certificates) GetOCSPRefreshInterval() time.Duration {
+	return c.ocspRefreshInterval
 }
 
-// Cache
-type Cache struct {
-	Enabled                bool  `yaml:"enabled"`
-	CacheMaxSizeInMegaByte int64 `yaml:"cache-max-size-in-mega-byte"`
+// Shutdown configures the graceful shutdown of prox
+type Shutdown struct {
+	PreStopDelay string        `yaml:"pre-stop-delay"`
+	DrainTimeout string        `yaml:"drain-timeout"`
+	preStopDelay time.Duration `yaml:"-"`
+	drainTimeout time.Duration `yaml:"-"`
+}
+
+// GetPreStopDelay returns a parsed duration
+func (s Shutdown) GetPreStopDelay() time.Duration {
+	return s.preStopDelay
+}
+
+// GetDrainTimeout returns a parsed duration
+func (s Shutdown) GetDrainTimeout() time.Duration {
+	return s.drainTimeout
+}
+
+// HotRestart configures the zero-downtime restart of prox, where a new process takes over the listeners of the running one
+type HotRestart struct {
+	Enabled         bool          `yaml:"enabled"`
+	EndpointEnabled bool          `yaml:"endpoint-enabled"`
+	ReadyTimeout    string        `yaml:"ready-timeout"`
+	readyTimeout    time.Duration `yaml:"-"`
+}
+
+// GetReadyTimeout returns a parsed duration
+func (h HotRestart) GetReadyTimeout() time.Duration {
+	return h.readyTimeout
 }
 
 // ParseStaticFile
@@ -66,9 +144,99 @@ func ParseStaticFile(path string) (Static, error) {
 	if hasDuplicates(config.Ports, config.InfraPort) {
 		return Static{}, ErrorDuplicatedPortConfiguration
 	}
+
+	for i := range config.Ports {
+		if err := parseTLSOptions(&config.Ports[i]); err != nil {
+			return Static{}, err
+		}
+		if err := parsePortLimits(&config.Ports[i]); err != nil {
+			return Static{}, err
+		}
+		if err := parsePortIPFilter(&config.Ports[i]); err != nil {
+			return Static{}, err
+		}
+	}
+
+	if err := parseCache(&config.Cache); err != nil {
+		return Static{}, err
+	}
+
+	if err := parseAccessLog(&config.AccessLog); err != nil {
+		return Static{}, err
+	}
+
+	if err := parseCertificates(&config.Certificates); err != nil {
+		return Static{}, err
+	}
+
+	if err := parseShutdown(&config.Shutdown); err != nil {
+		return Static{}, err
+	}
+
+	if err := parseHotRestart(&config.HotRestart); err != nil {
+		return Static{}, err
+	}
+
+	if err := parseMetrics(&config.Metrics); err != nil {
+		return Static{}, err
+	}
+
+	if err := parseTracing(&config.Tracing); err != nil {
+		return Static{}, err
+	}
+
+	if err := parseRequestID(&config.RequestID); err != nil {
+		return Static{}, err
+	}
+
+	if err := config.ErrorPages.Parse(); err != nil {
+		return Static{}, err
+	}
+
+	if err := parseAdmin(&config); err != nil {
+		return Static{}, err
+	}
 	return config, nil
 }
 
+func parseCertificates(c *Certificates) error {
+	if len(c.ExpiryWarningThresholds) == 0 {
+		c.ExpiryWarningThresholds = defaultCertificateExpiryWarningThresholds
+	}
+
+	thresholds := make([]time.Duration, 0, len(c.ExpiryWarningThresholds))
+	for _, threshold := range c.ExpiryWarningThresholds {
+		parsed, err := time.ParseDuration(threshold)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("%w: invalid expiry warning threshold \"%s\"", ErrorInvalidCertificatesConfig, threshold)
+		}
+		thresholds = append(thresholds, parsed)
+	}
+	sort.Slice(thresholds, func(i, j int) bool {
+		return thresholds[i] > thresholds[j]
+	})
+	c.expiryWarningThresholds = thresholds
+
+	if c.ExpiryCheckInterval == "" {
+		c.ExpiryCheckInterval = defaultCertificateExpiryCheckInterval
+	}
+	checkInterval, err := time.ParseDuration(c.ExpiryCheckInterval)
+	if err != nil || checkInterval <= 0 {
+		return fmt.Errorf("%w: invalid expiry check interval \"%s\"", ErrorInvalidCertificatesConfig, c.ExpiryCheckInterval)
+	}
+	c.expiryCheckInterval = checkInterval
+
+	if c.OCSPRefreshInterval == "" {
+		c.OCSPRefreshInterval = defaultCertificateOCSPRefreshInterval
+	}
+	refreshInterval, err := time.ParseDuration(c.OCSPRefreshInterval)
+	if err != nil || refreshInterval <= 0 {
+		return fmt.Errorf("%w: invalid ocsp refresh interval \"%s\"", ErrorInvalidCertificatesConfig, c.OCSPRefreshInterval)
+	}
+	c.ocspRefreshInterval = refreshInterval
+	return nil
+}
+
 func hasDuplicates(ports []Port, infraPort uint16) bool {
 	var hasDuplicatePortsAddr bool
 	var hasDuplicatesNames bool
@@ -118,3 +286,36 @@ func hasDuplicates(ports []Port, infraPort uint16) bool {
 
 	return hasDuplicatePortsAddr || hasDuplicatesNames || hasDuplicatesWithInfraPort
 }
+
+func parseShutdown(s *Shutdown) error {
+	if s.PreStopDelay == "" {
+		s.PreStopDelay = defaultShutdownPreStopDelay
+	}
+	preStopDelay, err := time.ParseDuration(s.PreStopDelay)
+	if err != nil || preStopDelay < 0 {
+		return fmt.Errorf("%w: invalid pre-stop delay \"%s\"", ErrorInvalidShutdownConfig, s.PreStopDelay)
+	}
+	s.preStopDelay = preStopDelay
+
+	if s.DrainTimeout == "" {
+		s.DrainTimeout = defaultShutdownDrainTimeout
+	}
+	drainTimeout, err := time.ParseDuration(s.DrainTimeout)
+	if err != nil || drainTimeout < 0 {
+		return fmt.Errorf("%w: invalid drain timeout \"%s\"", ErrorInvalidShutdownConfig, s.DrainTimeout)
+	}
+	s.drainTimeout = drainTimeout
+	return nil
+}
+
+func parseHotRestart(h *HotRestart) error {
+	if h.ReadyTimeout == "" {
+		h.ReadyTimeout = defaultHotRestartReadyTimeout
+	}
+	readyTimeout, err := time.ParseDuration(h.ReadyTimeout)
+	if err != nil || readyTimeout <= 0 {
+		return fmt.Errorf("%w: invalid ready timeout \"%s\"", ErrorInvalidHotRestartConfig, h.ReadyTimeout)
+	}
+	h.readyTimeout = readyTimeout
+	return nil
+}
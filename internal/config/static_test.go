@@ -4,12 +4,14 @@ import (
 	"io/ioutil"
 	"reflect"
 	"testing"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 func TestParseStaticFile(t *testing.T) {
 	t.Parallel()
+	defaultSampleRate := 1.0
 	type args struct {
 		input        Static
 		fileTypeName string
@@ -37,17 +39,194 @@ func TestParseStaticFile(t *testing.T) {
 			},
 			want: Static{
 				Ports: []Port{
-					{Name: "test", Addr: 8080, TlSEnabled: true},
-					{Name: "test2", Addr: 8081, TlSEnabled: true},
+					{Name: "test", Addr: 8080, TlSEnabled: true, Limits: defaultTestPortLimits},
+					{Name: "test2", Addr: 8081, TlSEnabled: true, Limits: defaultTestPortLimits},
 				},
 				Cache: Cache{
 					Enabled:                true,
 					CacheMaxSizeInMegaByte: 0,
+					Eviction:               "lru",
+					Type:                   "memory",
+					Coalescing:             CacheCoalescing{WaitTimeout: "5s", waitTimeout: 5 * time.Second},
 				},
 				InfraPort: 9100,
+				AccessLog: AccessLog{
+					Format:        "combined",
+					RedactHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+					SampleRate:    &defaultSampleRate,
+					Output:        AccessLogOutput{Type: "stdout"},
+				},
+				Certificates: Certificates{
+					ExpiryWarningThresholds: []string{"720h", "168h", "24h"},
+					ExpiryCheckInterval:     "1h",
+					OCSPRefreshInterval:     "1h",
+					expiryWarningThresholds: []time.Duration{720 * time.Hour, 168 * time.Hour, 24 * time.Hour},
+					expiryCheckInterval:     time.Hour,
+					ocspRefreshInterval:     time.Hour,
+				},
+				Shutdown: Shutdown{
+					PreStopDelay: "0s",
+					DrainTimeout: "30s",
+					drainTimeout: 30 * time.Second,
+				},
+				HotRestart: HotRestart{
+					ReadyTimeout: "30s",
+					readyTimeout: 30 * time.Second,
+				},
+				Metrics: Metrics{
+					DurationBuckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+					SizeBuckets:     []float64{100, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9},
+				},
+				Tracing: Tracing{
+					Endpoint:      "localhost:4318",
+					URLPath:       "/v1/traces",
+					ServiceName:   "prox",
+					SampleRate:    &defaultSampleRate,
+					Propagators:   []string{"tracecontext", "b3"},
+					ExportTimeout: "10s",
+					exportTimeout: 10 * time.Second,
+				},
+				RequestID: RequestID{
+					Header: "X-Request-ID",
+					Format: "uuid",
+				},
 			},
 			wantErr: false,
 		},
+		{
+			name: "InvalidMetricsBuckets",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080, TlSEnabled: true},
+					},
+					Metrics: Metrics{
+						DurationBuckets: []float64{1, 0.5},
+					},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
+		{
+			name: "InvalidTracingPropagator",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080, TlSEnabled: true},
+					},
+					Tracing: Tracing{
+						Propagators: []string{"jaeger"},
+					},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
+		{
+			name: "InvalidRequestIDFormat",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080, TlSEnabled: true},
+					},
+					RequestID: RequestID{
+						Enabled: true,
+						Format:  "snowflake",
+					},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
+		{
+			name: "InvalidCacheEviction",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080, TlSEnabled: true},
+					},
+					Cache: Cache{
+						Enabled:  true,
+						Eviction: "fifo",
+					},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
+		{
+			name: "DiskCacheWithoutDirectory",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080, TlSEnabled: true},
+					},
+					Cache: Cache{
+						Enabled: true,
+						Type:    "disk",
+					},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
+		{
+			name: "InvalidCacheCoalescingWaitTimeout",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080, TlSEnabled: true},
+					},
+					Cache: Cache{
+						Enabled:    true,
+						Coalescing: CacheCoalescing{Enabled: true, WaitTimeout: "0s"},
+					},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
+		{
+			name: "CacheAdminAPIWithoutToken",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080, TlSEnabled: true},
+					},
+					Cache: Cache{
+						Enabled: true,
+						Admin:   CacheAdmin{APIEnabled: true},
+					},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
+		{
+			name: "HotRestartEndpointWithoutToken",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080, TlSEnabled: true},
+					},
+					HotRestart: HotRestart{
+						Enabled:         true,
+						EndpointEnabled: true,
+					},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
 		{
 			name: "InvalidDuplicated",
 			args: args{
@@ -66,6 +245,36 @@ func TestParseStaticFile(t *testing.T) {
 			want:    Static{},
 			wantErr: true,
 		},
+		{
+			name: "InvalidAccessLogFormat",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080},
+					},
+					AccessLog: AccessLog{Format: "xml"},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
+		{
+			name: "InvalidCertificatesThreshold",
+			args: args{
+				input: Static{
+					Ports: []Port{
+						{Name: "test", Addr: 8080, TlSEnabled: true},
+					},
+					Certificates: Certificates{
+						ExpiryWarningThresholds: []string{"30d"},
+					},
+				},
+				fileTypeName: ".yaml",
+			},
+			want:    Static{},
+			wantErr: true,
+		},
 		{
 			name: "InvalidDuplicated",
 			args: args{
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/fwiedmann/prox/internal/filewatch"
+	"github.com/fwiedmann/prox/internal/infra"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrorUnsafeStaticReload = errors.New("static configuration change can not be applied at runtime, a restart is required")
+
+// ValidateReload checks if the changes from the current to the next static configuration can be applied at runtime
+func (s Static) ValidateReload(next Static) error {
+	changed := make([]string, 0)
+	if s.InfraPort != next.InfraPort {
+		changed = append(changed, "infra-port")
+	}
+	if s.AccessLogEnabled != next.AccessLogEnabled {
+		changed = append(changed, "access-log-enabled")
+	}
+	if !reflect.DeepEqual(s.AccessLog, next.AccessLog) {
+		changed = append(changed, "access-log")
+	}
+	if s.Cache.Enabled != next.Cache.Enabled {
+		changed = append(changed, "cache.enabled")
+	}
+	if s.Cache.Eviction != next.Cache.Eviction {
+		changed = append(changed, "cache.eviction")
+	}
+	if s.Cache.Type != next.Cache.Type || s.Cache.Directory != next.Cache.Directory {
+		changed = append(changed, "cache.type")
+	}
+	if s.Cache.Coalescing != next.Cache.Coalescing {
+		changed = append(changed, "cache.coalescing")
+	}
+	if !reflect.DeepEqual(s.Cache.Admin, next.Cache.Admin) {
+		changed = append(changed, "cache.admin")
+	}
+	if !reflect.DeepEqual(s.Certificates, next.Certificates) {
+		changed = append(changed, "certificates")
+	}
+	if !reflect.DeepEqual(s.HotRestart, next.HotRestart) {
+		changed = append(changed, "hot-restart")
+	}
+	if s.Admin != next.Admin {
+		changed = append(changed, "admin")
+	}
+	if !reflect.DeepEqual(s.Metrics, next.Metrics) {
+		changed = append(changed, "metrics")
+	}
+	if !reflect.DeepEqual(s.Tracing, next.Tracing) {
+		changed = append(changed, "tracing")
+	}
+	if !reflect.DeepEqual(s.RequestID, next.RequestID) {
+		changed = append(changed, "request-id")
+	}
+	if !s.ErrorPages.Equal(next.ErrorPages) {
+		changed = append(changed, "error-pages")
+	}
+
+	if len(changed) > 0 {
+		return fmt.Errorf("%w: changed %s", ErrorUnsafeStaticReload, strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// WatchStaticFile parses the static configuration file on each change and calls onChange with the new configuration.
+// Invalid configurations and errors returned by onChange will be logged and skipped. Blocks until the context is done.
+func WatchStaticFile(ctx context.Context, path string, onChange func(Static) error) {
+	filewatch.Watch(ctx, path, func() {
+		log.Info("Static configuration file update noticed, will reload")
+		if err := reloadStaticFile(path, onChange); err != nil {
+			infra.ConfigReloads.With(map[string]string{"config": "static", "result": "failure"}).Inc()
+			log.Errorf("could not reload static configuration, keep the current one. error: %s", err)
+			return
+		}
+		infra.ConfigReloads.With(map[string]string{"config": "static", "result": "success"}).Inc()
+		log.Info("Successfully reloaded static configuration")
+	})
+}
+
+func reloadStaticFile(path string, onChange func(Static) error) error {
+	next, err := ParseStaticFile(path)
+	if err != nil {
+		return err
+	}
+	return onChange(next)
+}
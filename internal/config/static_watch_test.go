@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatic_ValidateReload(t *testing.T) {
+	t.Parallel()
+	current := Static{
+		Ports:     []Port{{Name: "http", Addr: 80}},
+		Cache:     Cache{Enabled: true, CacheMaxSizeInMegaByte: 100},
+		InfraPort: 9100,
+	}
+	tests := []struct {
+		name    string
+		next    Static
+		wantErr bool
+	}{
+		{
+			name: "ChangedPortsAndCacheSize",
+			next: Static{
+				Ports:     []Port{{Name: "http", Addr: 8080}, {Name: "https", Addr: 443, TlSEnabled: true}},
+				Cache:     Cache{Enabled: true, CacheMaxSizeInMegaByte: 200},
+				InfraPort: 9100,
+			},
+		},
+		{
+			name: "ChangedInfraPort",
+			next: Static{
+				Ports:     []Port{{Name: "http", Addr: 80}},
+				Cache:     Cache{Enabled: true, CacheMaxSizeInMegaByte: 100},
+				InfraPort: 9200,
+			},
+			wantErr: true,
+		},
+		{
+			name: "ChangedCacheEviction",
+			next: Static{
+				Ports:     []Port{{Name: "http", Addr: 80}},
+				Cache:     Cache{Enabled: true, CacheMaxSizeInMegaByte: 100, Eviction: CacheEvictionLFU},
+				InfraPort: 9100,
+			},
+			wantErr: true,
+		},
+		{
+			name: "ChangedCacheCoalescing",
+			next: Static{
+				Ports:     []Port{{Name: "http", Addr: 80}},
+				Cache:     Cache{Enabled: true, CacheMaxSizeInMegaByte: 100, Coalescing: CacheCoalescing{Enabled: true}},
+				InfraPort: 9100,
+			},
+			wantErr: true,
+		},
+		{
+			name: "DisabledCache",
+			next: Static{
+				Ports:     []Port{{Name: "http", Addr: 80}},
+				InfraPort: 9100,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := current.ValidateReload(tt.next)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateReload() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !errors.Is(err, ErrorUnsafeStaticReload) {
+				t.Errorf("ValidateReload() error = %v, want %v", err, ErrorUnsafeStaticReload)
+			}
+		})
+	}
+}
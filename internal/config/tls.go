@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/fwiedmann/prox/internal/infra"
 	"github.com/ghodss/yaml"
 
 	log "github.com/sirupsen/logrus"
@@ -17,16 +19,22 @@ import (
 
 // TLS config
 type TLS struct {
-	configFile string
-	certStore  map[string]tls.Certificate
-	mtx        sync.RWMutex
+	configFile   string
+	certificates Certificates
+	certStore    map[string]tls.Certificate
+	certStates   map[string]*certificateState
+	ocspClient   *http.Client
+	mtx          sync.RWMutex
 }
 
 // NewDynamicTLSConfig
-func NewDynamicTLSConfig(configFile string) *TLS {
+func NewDynamicTLSConfig(configFile string, certificates Certificates) *TLS {
 	return &TLS{
-		configFile: configFile,
-		certStore:  make(map[string]tls.Certificate),
+		configFile:   configFile,
+		certificates: certificates,
+		certStore:    make(map[string]tls.Certificate),
+		certStates:   make(map[string]*certificateState),
+		ocspClient:   &http.Client{Timeout: ocspRequestTimeout},
 	}
 }
 
@@ -61,6 +69,7 @@ func (t *TLS) StartWatch(ctx context.Context, errChan chan<- error) {
 
 	pairs := make([]Pair, 0)
 	if err := yaml.Unmarshal(file, &pairs); err != nil {
+		infra.ConfigReloads.With(map[string]string{"config": "tls", "result": "failure"}).Inc()
 		errChan <- err
 	}
 	log.Debugf("Parsed tls config file \"%s\": %+v", t.configFile, pairs)
@@ -75,6 +84,7 @@ func (t *TLS) StartWatch(ctx context.Context, errChan chan<- error) {
 	}
 
 	log.Info("Successfully configured tls configuration")
+	infra.ConfigReloads.With(map[string]string{"config": "tls", "result": "success"}).Inc()
 
 	for {
 		configFileStat, err := os.Stat(t.configFile)
@@ -103,9 +113,10 @@ func (t *TLS) startWatchPair(ctx context.Context, pair Pair) {
 		return
 	}
 
-	t.mtx.Lock()
-	t.certStore[pair.ID()] = cer
-	t.mtx.Unlock()
+	if err := t.storeCertificate(pair, cer); err != nil {
+		log.Error(err)
+		return
+	}
 
 	initCertStat, err := os.Stat(pair.Certificate)
 	if err != nil {
@@ -124,7 +135,7 @@ func (t *TLS) startWatchPair(ctx context.Context, pair Pair) {
 			log.Error(err)
 			if errors.Is(err, os.ErrNotExist) {
 				t.mtx.Lock()
-				delete(t.certStore, pair.ID())
+				t.deleteCertificate(pair.ID())
 				t.mtx.Unlock()
 				return
 			}
@@ -134,7 +145,7 @@ func (t *TLS) startWatchPair(ctx context.Context, pair Pair) {
 			log.Error(err)
 			if errors.Is(err, os.ErrNotExist) {
 				t.mtx.Lock()
-				delete(t.certStore, pair.ID())
+				t.deleteCertificate(pair.ID())
 				t.mtx.Unlock()
 				return
 			}
@@ -172,7 +183,7 @@ func (t *TLS) deleteStalePairs(pairs []Pair) {
 			}
 		}
 		if !found {
-			delete(t.certStore, id)
+			t.deleteCertificate(id)
 		}
 	}
 	t.mtx.Unlock()
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrorInvalidTracingConfig = errors.New("static configuration has an invalid tracing configuration")
+
+// Supported trace context propagators
+const (
+	TracingPropagatorTraceContext = "tracecontext"
+	TracingPropagatorB3           = "b3"
+)
+
+const defaultTracingEndpoint = "localhost:4318"
+const defaultTracingURLPath = "/v1/traces"
+const defaultTracingServiceName = "prox"
+const defaultTracingSampleRate = 1.0
+const defaultTracingExportTimeout = "10s"
+
+var defaultTracingPropagators = []string{TracingPropagatorTraceContext, TracingPropagatorB3}
+
+// Tracing configures the export of OpenTelemetry traces via OTLP/HTTP
+type Tracing struct {
+	Enabled       bool              `yaml:"enabled"`
+	Endpoint      string            `yaml:"endpoint"`
+	URLPath       string            `yaml:"url-path"`
+	Insecure      bool              `yaml:"insecure"`
+	Headers       map[string]string `yaml:"headers,omitempty"`
+	ServiceName   string            `yaml:"service-name"`
+	SampleRate    *float64          `yaml:"sample-rate,omitempty"`
+	Propagators   []string          `yaml:"propagators,omitempty"`
+	ExportTimeout string            `yaml:"export-timeout"`
+	exportTimeout time.Duration     `yaml:"-"`
+}
+
+// GetExportTimeout returns a parsed duration
+func (t Tracing) GetExportTimeout() time.Duration {
+	return t.exportTimeout
+}
+
+func parseTracing(t *Tracing) error {
+	if t.Endpoint == "" {
+		t.Endpoint = defaultTracingEndpoint
+	}
+
+	if t.URLPath == "" {
+		t.URLPath = defaultTracingURLPath
+	}
+
+	if t.ServiceName == "" {
+		t.ServiceName = defaultTracingServiceName
+	}
+
+	if t.SampleRate == nil {
+		rate := defaultTracingSampleRate
+		t.SampleRate = &rate
+	}
+	if *t.SampleRate < 0 || *t.SampleRate > 1 {
+		return fmt.Errorf("%w: sample rate %v has to be between 0 and 1", ErrorInvalidTracingConfig, *t.SampleRate)
+	}
+
+	if len(t.Propagators) == 0 {
+		t.Propagators = defaultTracingPropagators
+	}
+	for _, propagator := range t.Propagators {
+		if propagator != TracingPropagatorTraceContext && propagator != TracingPropagatorB3 {
+			return fmt.Errorf("%w: unknown propagator \"%s\"", ErrorInvalidTracingConfig, propagator)
+		}
+	}
+
+	if t.ExportTimeout == "" {
+		t.ExportTimeout = defaultTracingExportTimeout
+	}
+	exportTimeout, err := time.ParseDuration(t.ExportTimeout)
+	if err != nil || exportTimeout <= 0 {
+		return fmt.Errorf("%w: invalid export timeout \"%s\"", ErrorInvalidTracingConfig, t.ExportTimeout)
+	}
+	t.exportTimeout = exportTimeout
+	return nil
+}
@@ -0,0 +1,237 @@
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fwiedmann/prox/internal/errorpage"
+	"github.com/fwiedmann/prox/internal/modifiers"
+	"github.com/fwiedmann/prox/internal/stringutil"
+)
+
+var ErrorInvalidConfig = errors.New("invalid cors configuration")
+
+const (
+	originHeader              = "Origin"
+	varyHeader                = "Vary"
+	requestMethodHeader       = "Access-Control-Request-Method"
+	requestHeadersHeader      = "Access-Control-Request-Headers"
+	allowOriginHeader         = "Access-Control-Allow-Origin"
+	allowMethodsHeader        = "Access-Control-Allow-Methods"
+	allowHeadersHeader        = "Access-Control-Allow-Headers"
+	allowCredentialsHeader    = "Access-Control-Allow-Credentials"
+	exposeHeadersHeader       = "Access-Control-Expose-Headers"
+	maxAgeHeader              = "Access-Control-Max-Age"
+	accessControlHeaderPrefix = "Access-Control-"
+	wildcard                  = "*"
+)
+
+var defaultAllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// Config of the CORS policy of a route
+type Config struct {
+	Enabled              bool             `yaml:"enabled"`
+	AllowedOrigins       []string         `yaml:"allowed-origins,omitempty"`
+	AllowedOriginRegexps []string         `yaml:"allowed-origin-regexps,omitempty"`
+	AllowedMethods       []string         `yaml:"allowed-methods,omitempty"`
+	AllowedHeaders       []string         `yaml:"allowed-headers,omitempty"`
+	ExposedHeaders       []string         `yaml:"exposed-headers,omitempty"`
+	AllowCredentials     bool             `yaml:"allow-credentials"`
+	MaxAge               string           `yaml:"max-age"`
+	allowAllOrigins      bool             `yaml:"-"`
+	origins              []string         `yaml:"-"`
+	wildcardOrigins      []wildcardOrigin `yaml:"-"`
+	originRegexps        []*regexp.Regexp `yaml:"-"`
+	allowAllHeaders      bool             `yaml:"-"`
+	maxAge               time.Duration    `yaml:"-"`
+}
+
+// wildcardOrigin matches all origins with the prefix and the suffix, like https://*.example.com
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+func (w wildcardOrigin) matches(origin string) bool {
+	return len(origin) > len(w.prefix)+len(w.suffix) && strings.HasPrefix(origin, w.prefix) && strings.HasSuffix(origin, w.suffix)
+}
+
+// Parse validates the configuration and sets the defaults
+func (c *Config) Parse() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.AllowedOrigins) == 0 && len(c.AllowedOriginRegexps) == 0 {
+		return fmt.Errorf("%w: at least one allowed origin is required", ErrorInvalidConfig)
+	}
+
+	c.allowAllOrigins, c.origins, c.wildcardOrigins, c.originRegexps = false, nil, nil, nil
+	for _, origin := range c.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch strings.Count(origin, wildcard) {
+		case 0:
+			c.origins = append(c.origins, origin)
+		case 1:
+			if origin == wildcard {
+				c.allowAllOrigins = true
+				continue
+			}
+			parts := strings.SplitN(origin, wildcard, 2)
+			c.wildcardOrigins = append(c.wildcardOrigins, wildcardOrigin{prefix: parts[0], suffix: parts[1]})
+		default:
+			return fmt.Errorf("%w: origin \"%s\" contains more than one wildcard", ErrorInvalidConfig, origin)
+		}
+	}
+	if c.allowAllOrigins && c.AllowCredentials {
+		return fmt.Errorf("%w: credentials can not be allowed for all origins", ErrorInvalidConfig)
+	}
+	for _, expr := range c.AllowedOriginRegexps {
+		originRegexp, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", expr))
+		if err != nil {
+			return fmt.Errorf("%w: invalid origin regexp \"%s\": %s", ErrorInvalidConfig, expr, err)
+		}
+		c.originRegexps = append(c.originRegexps, originRegexp)
+	}
+
+	if len(c.AllowedMethods) == 0 {
+		c.AllowedMethods = defaultAllowedMethods
+	}
+	for i, method := range c.AllowedMethods {
+		c.AllowedMethods[i] = strings.ToUpper(method)
+	}
+
+	c.allowAllHeaders = false
+	for i, header := range c.AllowedHeaders {
+		if header == wildcard {
+			c.allowAllHeaders = true
+		}
+		c.AllowedHeaders[i] = http.CanonicalHeaderKey(header)
+	}
+
+	if c.MaxAge == "" {
+		c.MaxAge = "0s"
+	}
+	maxAge, err := time.ParseDuration(c.MaxAge)
+	if err != nil || maxAge < 0 {
+		return fmt.Errorf("%w: invalid max age \"%s\"", ErrorInvalidConfig, c.MaxAge)
+	}
+	c.maxAge = maxAge
+	return nil
+}
+
+// Inject the CORS policy before the next handler. Preflight requests are answered directly, the Access-Control headers
+// of all other responses are replaced with the ones of the policy.
+func (c Config) Inject(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get(originHeader)
+		if r.Method == http.MethodOptions && origin != "" && r.Header.Get(requestMethodHeader) != "" {
+			c.preflight(w, r, origin)
+			return
+		}
+		next(modifiers.NewHeaderWriter(w, func(int) {
+			c.setResponseHeaders(w.Header(), origin)
+		}), r)
+	}
+}
+
+// preflight answers the preflight request with 204 No Content if the origin, method and headers are allowed, otherwise with the 403 Forbidden error page
+func (c Config) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	w.Header().Add(varyHeader, strings.Join([]string{originHeader, requestMethodHeader, requestHeadersHeader}, ", "))
+	requestedHeaders := parseList(r.Header.Get(requestHeadersHeader))
+	if !c.isOriginAllowed(origin) || !stringutil.Contains(c.AllowedMethods, r.Header.Get(requestMethodHeader)) || !c.areHeadersAllowed(requestedHeaders) {
+		errorpage.WriteStatus(w, r, http.StatusForbidden, "")
+		return
+	}
+
+	c.setOriginHeaders(w.Header(), origin)
+	w.Header().Set(allowMethodsHeader, strings.Join(c.AllowedMethods, ", "))
+	allowedHeaders := c.AllowedHeaders
+	if c.allowAllHeaders {
+		allowedHeaders = requestedHeaders
+	}
+	if len(allowedHeaders) != 0 {
+		w.Header().Set(allowHeadersHeader, strings.Join(allowedHeaders, ", "))
+	}
+	if c.maxAge > 0 {
+		w.Header().Set(maxAgeHeader, strconv.FormatInt(int64(c.maxAge/time.Second), 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c Config) setOriginHeaders(header http.Header, origin string) {
+	if c.allowAllOrigins {
+		header.Set(allowOriginHeader, wildcard)
+	} else {
+		header.Set(allowOriginHeader, origin)
+	}
+	if c.AllowCredentials {
+		header.Set(allowCredentialsHeader, "true")
+	}
+}
+
+func (c Config) isOriginAllowed(origin string) bool {
+	if c.allowAllOrigins {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if stringutil.Contains(c.origins, origin) {
+		return true
+	}
+	for _, w := range c.wildcardOrigins {
+		if w.matches(origin) {
+			return true
+		}
+	}
+	for _, originRegexp := range c.originRegexps {
+		if originRegexp.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) areHeadersAllowed(headers []string) bool {
+	if c.allowAllHeaders {
+		return true
+	}
+	for _, header := range headers {
+		if !stringutil.Contains(c.AllowedHeaders, http.CanonicalHeaderKey(header)) {
+			return false
+		}
+	}
+	return true
+}
+
+// setResponseHeaders replaces the Access-Control headers of the response, it is called right before the response header gets written
+func (c Config) setResponseHeaders(header http.Header, origin string) {
+	for name := range header {
+		if strings.HasPrefix(name, accessControlHeaderPrefix) {
+			header.Del(name)
+		}
+	}
+	if !c.allowAllOrigins {
+		header.Add(varyHeader, originHeader)
+	}
+	if origin == "" || !c.isOriginAllowed(origin) {
+		return
+	}
+	c.setOriginHeaders(header, origin)
+	if len(c.ExposedHeaders) != 0 {
+		header.Set(exposeHeadersHeader, strings.Join(c.ExposedHeaders, ", "))
+	}
+}
+
+func parseList(value string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,240 @@
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fwiedmann/prox/internal/errorpage"
+)
+
+func TestConfig_Parse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr error
+	}{
+		{
+			name:   "Disabled",
+			config: Config{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		},
+		{
+			name:   "Valid",
+			config: Config{Enabled: true, AllowedOrigins: []string{"https://*.example.com"}, AllowedOriginRegexps: []string{`https://app-[0-9]+\.example\.org`}, MaxAge: "10m"},
+		},
+		{
+			name:    "WithoutOrigins",
+			config:  Config{Enabled: true},
+			wantErr: ErrorInvalidConfig,
+		},
+		{
+			name:    "CredentialsForAllOrigins",
+			config:  Config{Enabled: true, AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			wantErr: ErrorInvalidConfig,
+		},
+		{
+			name:    "MultipleWildcards",
+			config:  Config{Enabled: true, AllowedOrigins: []string{"https://*.*.example.com"}},
+			wantErr: ErrorInvalidConfig,
+		},
+		{
+			name:    "InvalidRegexp",
+			config:  Config{Enabled: true, AllowedOriginRegexps: []string{"("}},
+			wantErr: ErrorInvalidConfig,
+		},
+		{
+			name:    "InvalidMaxAge",
+			config:  Config{Enabled: true, AllowedOrigins: []string{"*"}, MaxAge: "-1s"},
+			wantErr: ErrorInvalidConfig,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tt.config.Parse(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Inject(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		config         Config
+		method         string
+		header         http.Header
+		wantStatusCode int
+		wantHeader     http.Header
+		wantNext       bool
+	}{
+		{
+			name:           "Preflight",
+			config:         Config{AllowedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{"get", "put"}, AllowedHeaders: []string{"content-type"}, AllowCredentials: true, MaxAge: "10m"},
+			method:         http.MethodOptions,
+			header:         http.Header{"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {"PUT"}, "Access-Control-Request-Headers": {"Content-Type"}},
+			wantStatusCode: http.StatusNoContent,
+			wantHeader: http.Header{
+				"Access-Control-Allow-Origin":      {"https://app.example.com"},
+				"Access-Control-Allow-Methods":     {"GET, PUT"},
+				"Access-Control-Allow-Headers":     {"Content-Type"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Max-Age":           {"600"},
+			},
+		},
+		{
+			name:           "PreflightWildcardOriginAndAllHeaders",
+			config:         Config{AllowedOrigins: []string{"https://*.example.com"}, AllowedHeaders: []string{"*"}},
+			method:         http.MethodOptions,
+			header:         http.Header{"Origin": {"https://App.Example.com"}, "Access-Control-Request-Method": {"POST"}, "Access-Control-Request-Headers": {"x-custom, content-type"}},
+			wantStatusCode: http.StatusNoContent,
+			wantHeader: http.Header{
+				"Access-Control-Allow-Origin":  {"https://App.Example.com"},
+				"Access-Control-Allow-Headers": {"x-custom, content-type"},
+			},
+		},
+		{
+			name:           "PreflightRegexpOrigin",
+			config:         Config{AllowedOriginRegexps: []string{`https://app-[0-9]+\.example\.org`}},
+			method:         http.MethodOptions,
+			header:         http.Header{"Origin": {"https://app-12.example.org"}, "Access-Control-Request-Method": {"GET"}},
+			wantStatusCode: http.StatusNoContent,
+			wantHeader:     http.Header{"Access-Control-Allow-Origin": {"https://app-12.example.org"}},
+		},
+		{
+			name:           "PreflightRegexpIsAnchored",
+			config:         Config{AllowedOriginRegexps: []string{`https://app-[0-9]+\.example\.org`}},
+			method:         http.MethodOptions,
+			header:         http.Header{"Origin": {"https://app-12.example.org.evil.com"}, "Access-Control-Request-Method": {"GET"}},
+			wantStatusCode: http.StatusForbidden,
+			wantHeader:     http.Header{"Access-Control-Allow-Origin": nil},
+		},
+		{
+			name:           "PreflightMethodNotAllowed",
+			config:         Config{AllowedOrigins: []string{"*"}},
+			method:         http.MethodOptions,
+			header:         http.Header{"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {"DELETE"}},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "PreflightHeaderNotAllowed",
+			config:         Config{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"Content-Type"}},
+			method:         http.MethodOptions,
+			header:         http.Header{"Origin": {"https://app.example.com"}, "Access-Control-Request-Method": {"GET"}, "Access-Control-Request-Headers": {"Authorization"}},
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "PlainOptionsRequest",
+			config:         Config{AllowedOrigins: []string{"*"}},
+			method:         http.MethodOptions,
+			wantStatusCode: http.StatusOK,
+			wantNext:       true,
+		},
+		{
+			name:           "AllowedOrigin",
+			config:         Config{AllowedOrigins: []string{"https://app.example.com"}, ExposedHeaders: []string{"X-Total-Count"}},
+			method:         http.MethodGet,
+			header:         http.Header{"Origin": {"https://app.example.com"}},
+			wantStatusCode: http.StatusOK,
+			wantHeader: http.Header{
+				"Access-Control-Allow-Origin":   {"https://app.example.com"},
+				"Access-Control-Expose-Headers": {"X-Total-Count"},
+				"Access-Control-Max-Age":        nil,
+				"Vary":                          {"Origin"},
+			},
+			wantNext: true,
+		},
+		{
+			name:           "AllOrigins",
+			config:         Config{AllowedOrigins: []string{"*"}},
+			method:         http.MethodGet,
+			header:         http.Header{"Origin": {"https://app.example.com"}},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     http.Header{"Access-Control-Allow-Origin": {"*"}, "Vary": nil},
+			wantNext:       true,
+		},
+		{
+			name:           "UpstreamHeadersOfDeniedOrigin",
+			config:         Config{AllowedOrigins: []string{"https://app.example.com"}},
+			method:         http.MethodGet,
+			header:         http.Header{"Origin": {"https://evil.com"}},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     http.Header{"Access-Control-Allow-Origin": nil, "Access-Control-Max-Age": nil, "Vary": {"Origin"}},
+			wantNext:       true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.config.Enabled = true
+			if err := tt.config.Parse(); err != nil {
+				t.Fatal(err)
+			}
+
+			var calledNext bool
+			handler := tt.config.Inject(func(w http.ResponseWriter, r *http.Request) {
+				calledNext = true
+				w.Header().Set("Access-Control-Allow-Origin", "https://upstream.example.com")
+				w.Header().Set("Access-Control-Max-Age", "86400")
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(tt.method, "/", nil)
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("status got %d, want %d", w.Code, tt.wantStatusCode)
+			}
+			if calledNext != tt.wantNext {
+				t.Errorf("called next got %v, want %v", calledNext, tt.wantNext)
+			}
+			for name, want := range tt.wantHeader {
+				if got := w.Header().Get(name); got != firstValue(want) {
+					t.Errorf("%s got %q, want %q", name, got, firstValue(want))
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_Inject_PreflightErrorPage(t *testing.T) {
+	t.Parallel()
+	c := Config{Enabled: true, AllowedOrigins: []string{"https://app.example.com"}}
+	if err := c.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	pages := errorpage.Config{Pages: []errorpage.Page{{Status: "403", JSON: `{"rejected": {{json .Route}}}`}}}
+	if err := pages.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodOptions, "/", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	c.Inject(func(w http.ResponseWriter, r *http.Request) {})(w, errorpage.WithConfigs(r, "cors-route", pages))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status got %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if got, want := w.Body.String(), `{"rejected": "cors-route"}`; got != want {
+		t.Errorf("body got %q, want %q", got, want)
+	}
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,43 @@
+package errorpage
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fwiedmann/prox/internal/modifiers"
+)
+
+type configsContextKey struct{}
+
+// contextConfigs are the error pages of the handler which serves the request
+type contextConfigs struct {
+	route   string
+	configs []Config
+}
+
+// WithConfigs returns a request whose context carries the error pages and the route, so that middlewares which answer
+// the request themselves reply with the same error pages as the handler
+func WithConfigs(r *http.Request, route string, configs ...Config) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), configsContextKey{}, contextConfigs{route: route, configs: configs}))
+}
+
+// Inject the error pages into the request context before the next handler
+func (c Config) Inject(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, WithConfigs(r, "", c))
+	}
+}
+
+// WriteStatus replies with the error page for the status of the error pages in the request context, see WithConfigs.
+// Without error pages in the context, the default page is rendered.
+func WriteStatus(w http.ResponseWriter, r *http.Request, status int, message string) {
+	c, _ := r.Context().Value(configsContextKey{}).(contextConfigs)
+	Write(w, r, Data{
+		Status:    status,
+		Message:   message,
+		RequestID: modifiers.RequestIDFromContext(r.Context()),
+		Route:     c.route,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+	}, c.configs...)
+}
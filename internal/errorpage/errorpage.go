@@ -0,0 +1,290 @@
+package errorpage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrorInvalidConfig = errors.New("invalid error pages configuration")
+
+const (
+	contentTypeText = "text/plain; charset=utf-8"
+	contentTypeHTML = "text/html; charset=utf-8"
+	contentTypeJSON = "application/json"
+)
+
+var defaultHTMLTemplate = htmltemplate.Must(htmltemplate.New("default").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .RequestID}}<p>request-id: {{.RequestID}}</p>{{end}}
+</body>
+</html>
+`))
+
+// Config of the error pages, which can be configured globally and per route
+type Config struct {
+	InterceptUpstreamErrors bool   `yaml:"intercept-upstream-errors"`
+	Pages                   []Page `yaml:"pages,omitempty"`
+}
+
+// Page is rendered for all responses with a status code matching the Status, which can be a single code like "404",
+// a class like "5xx" or a range like "500-504". Templates can be configured inline or by a file per format.
+type Page struct {
+	Status       string                 `yaml:"status"`
+	HTML         string                 `yaml:"html"`
+	HTMLFile     string                 `yaml:"html-file"`
+	JSON         string                 `yaml:"json"`
+	JSONFile     string                 `yaml:"json-file"`
+	min          int                    `yaml:"-"`
+	max          int                    `yaml:"-"`
+	htmlTemplate *htmltemplate.Template `yaml:"-"`
+	jsonTemplate *texttemplate.Template `yaml:"-"`
+}
+
+// Data can be used in the error page templates
+type Data struct {
+	Status     int
+	StatusText string
+	Message    string
+	RequestID  string
+	Route      string
+	Method     string
+	Path       string
+}
+
+// Parse validates the configuration and loads the templates of all pages
+func (c *Config) Parse() error {
+	for i := range c.Pages {
+		if err := parsePage(&c.Pages[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Equal compares the configured values without the parsed templates
+func (c Config) Equal(other Config) bool {
+	if c.InterceptUpstreamErrors != other.InterceptUpstreamErrors || len(c.Pages) != len(other.Pages) {
+		return false
+	}
+	for i := range c.Pages {
+		a, b := c.Pages[i], other.Pages[i]
+		if a.Status != b.Status || a.HTML != b.HTML || a.HTMLFile != b.HTMLFile || a.JSON != b.JSON || a.JSONFile != b.JSONFile {
+			return false
+		}
+	}
+	return true
+}
+
+func parsePage(p *Page) error {
+	min, max, err := parseStatus(p.Status)
+	if err != nil {
+		return err
+	}
+	p.min, p.max = min, max
+
+	htmlContent, err := inlineOrFile(p.HTML, p.HTMLFile)
+	if err != nil {
+		return err
+	}
+	if htmlContent != "" {
+		tmpl, err := htmltemplate.New(p.Status).Parse(htmlContent)
+		if err != nil {
+			return fmt.Errorf("%w: invalid html template for status \"%s\": %s", ErrorInvalidConfig, p.Status, err)
+		}
+		p.htmlTemplate = tmpl
+	}
+
+	jsonContent, err := inlineOrFile(p.JSON, p.JSONFile)
+	if err != nil {
+		return err
+	}
+	if jsonContent != "" {
+		tmpl, err := texttemplate.New(p.Status).Funcs(texttemplate.FuncMap{"json": toJSON}).Parse(jsonContent)
+		if err != nil {
+			return fmt.Errorf("%w: invalid json template for status \"%s\": %s", ErrorInvalidConfig, p.Status, err)
+		}
+		p.jsonTemplate = tmpl
+	}
+
+	if p.htmlTemplate == nil && p.jsonTemplate == nil {
+		return fmt.Errorf("%w: page for status \"%s\" has no template", ErrorInvalidConfig, p.Status)
+	}
+	return nil
+}
+
+// parseStatus returns the inclusive range of status codes
+func parseStatus(status string) (int, int, error) {
+	invalid := fmt.Errorf("%w: invalid status \"%s\"", ErrorInvalidConfig, status)
+
+	if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") {
+		class, err := strconv.Atoi(status[:1])
+		if err != nil || class < 1 || class > 5 {
+			return 0, 0, invalid
+		}
+		return class * 100, class*100 + 99, nil
+	}
+
+	parts := strings.SplitN(status, "-", 2)
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, invalid
+	}
+	max := min
+	if len(parts) == 2 {
+		if max, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return 0, 0, invalid
+		}
+	}
+	if min < 100 || max > 599 || min > max {
+		return 0, 0, invalid
+	}
+	return min, max, nil
+}
+
+func inlineOrFile(inline, file string) (string, error) {
+	if inline != "" && file != "" {
+		return "", fmt.Errorf("%w: template and template file are configured, only one is allowed", ErrorInvalidConfig)
+	}
+	if file == "" {
+		return inline, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrorInvalidConfig, err)
+	}
+	return string(content), nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// match returns the most specific page for the status code with a template for the format and the format of the template, nil if no page matches
+func (c Config) match(status int, f format) (*Page, format) {
+	var matched *Page
+	var matchedFormat format
+	for i := range c.Pages {
+		p := &c.Pages[i]
+		if status < p.min || status > p.max {
+			continue
+		}
+		templateFormat, ok := p.templateFormat(f)
+		if !ok {
+			continue
+		}
+		if matched == nil || p.max-p.min < matched.max-matched.min {
+			matched, matchedFormat = p, templateFormat
+		}
+	}
+	return matched, matchedFormat
+}
+
+// templateFormat returns the format of the first template of the page which satisfies the format
+func (p *Page) templateFormat(f format) (format, bool) {
+	for _, candidate := range f.candidates() {
+		if p.hasTemplate(candidate) {
+			return candidate, true
+		}
+	}
+	return formatText, false
+}
+
+func (p *Page) hasTemplate(f format) bool {
+	switch f {
+	case formatHTML:
+		return p.htmlTemplate != nil
+	case formatJSON:
+		return p.jsonTemplate != nil
+	default:
+		return false
+	}
+}
+
+func (p *Page) render(f format, data Data) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch f {
+	case formatHTML:
+		err = p.htmlTemplate.Execute(&buf, data)
+	case formatJSON:
+		err = p.jsonTemplate.Execute(&buf, data)
+	}
+	return buf.Bytes(), err
+}
+
+// Write replies with the error page for the data.Status in the format requested by the Accept header.
+// The configs are searched in the given order for a matching page, if none matches a default page is rendered.
+func Write(w http.ResponseWriter, r *http.Request, data Data, configs ...Config) {
+	data.StatusText = http.StatusText(data.Status)
+	f := negotiate(r.Header.Get("Accept"))
+
+	body, contentType := renderConfigured(f, data, configs)
+	if body == nil {
+		body, contentType = renderDefault(f, data)
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(data.Status)
+	if _, err := w.Write(body); err != nil {
+		log.Errorf("could not write error page for status %d, error: %s", data.Status, err)
+	}
+}
+
+func renderConfigured(f format, data Data, configs []Config) ([]byte, string) {
+	for _, c := range configs {
+		page, templateFormat := c.match(data.Status, f)
+		if page == nil {
+			continue
+		}
+		body, err := page.render(templateFormat, data)
+		if err != nil {
+			log.Errorf("could not render error page for status %d, error: %s", data.Status, err)
+			continue
+		}
+		return body, templateFormat.contentType()
+	}
+	return nil, ""
+}
+
+func renderDefault(f format, data Data) ([]byte, string) {
+	switch f {
+	case formatHTML:
+		var buf bytes.Buffer
+		if err := defaultHTMLTemplate.Execute(&buf, data); err == nil {
+			return buf.Bytes(), contentTypeHTML
+		}
+	case formatJSON:
+		body, err := json.Marshal(struct {
+			Status    int    `json:"status"`
+			Error     string `json:"error"`
+			Message   string `json:"message,omitempty"`
+			RequestID string `json:"request_id,omitempty"`
+		}{data.Status, data.StatusText, data.Message, data.RequestID})
+		if err == nil {
+			return append(body, '\n'), contentTypeJSON
+		}
+	}
+
+	text := fmt.Sprintf("%d - %s", data.Status, data.StatusText)
+	if data.RequestID != "" {
+		text = fmt.Sprintf("%s\nrequest-id: %s", text, data.RequestID)
+	}
+	return []byte(text + "\n"), contentTypeText
+}
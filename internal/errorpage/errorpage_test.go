@@ -0,0 +1,282 @@
+package errorpage
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_parseStatus(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		status  string
+		wantMin int
+		wantMax int
+		wantErr bool
+	}{
+		{name: "Code", status: "404", wantMin: 404, wantMax: 404},
+		{name: "Class", status: "5xx", wantMin: 500, wantMax: 599},
+		{name: "Range", status: "500-504", wantMin: 500, wantMax: 504},
+		{name: "InvalidClass", status: "9xx", wantErr: true},
+		{name: "InvalidRange", status: "504-500", wantErr: true},
+		{name: "InvalidCode", status: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			min, max, err := parseStatus(tt.status)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if min != tt.wantMin || max != tt.wantMax {
+				t.Errorf("parseStatus() = %d-%d, want %d-%d", min, max, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func Test_negotiate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		accept string
+		want   format
+	}{
+		{name: "Empty", accept: "", want: formatAny},
+		{name: "Wildcard", accept: "*/*", want: formatAny},
+		{name: "TextWildcard", accept: "text/*", want: formatAnyText},
+		{name: "PlainText", accept: "text/plain, */*;q=0.5", want: formatText},
+		{name: "Browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: formatHTML},
+		{name: "JSON", accept: "application/json", want: formatJSON},
+		{name: "Quality", accept: "text/html;q=0.5, application/json;q=0.9", want: formatJSON},
+		{name: "Unsupported", accept: "image/png", want: formatText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiate(tt.accept); got != tt.want {
+				t.Errorf("negotiate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Parse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{
+			name:   "Valid",
+			config: Config{Pages: []Page{{Status: "5xx", HTML: "<p>{{.Status}}</p>", JSON: `{"status": {{.Status}}}`}}},
+		},
+		{
+			name:    "NoTemplate",
+			config:  Config{Pages: []Page{{Status: "404"}}},
+			wantErr: true,
+		},
+		{
+			name:    "InlineAndFile",
+			config:  Config{Pages: []Page{{Status: "404", HTML: "<p></p>", HTMLFile: "404.html"}}},
+			wantErr: true,
+		},
+		{
+			name:    "MissingFile",
+			config:  Config{Pages: []Page{{Status: "404", JSONFile: "does-not-exist.json"}}},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidTemplate",
+			config:  Config{Pages: []Page{{Status: "404", HTML: "{{.Status"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.config.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrorInvalidConfig) {
+				t.Errorf("Parse() error = %v, want %v", err, ErrorInvalidConfig)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+	routePages := Config{Pages: []Page{
+		{Status: "5xx", JSON: `{"route": {{json .Route}}}`},
+		{Status: "502", JSON: `{"route": {{json .Route}}, "bad_gateway": true}`},
+	}}
+	globalPages := Config{Pages: []Page{
+		{Status: "4xx", HTML: "<p>{{.Message}}</p>", JSON: `{"global": {{.Status}}}`},
+	}}
+	for _, c := range []*Config{&routePages, &globalPages} {
+		if err := c.Parse(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name            string
+		accept          string
+		configs         []Config
+		data            Data
+		wantBody        string
+		wantContentType string
+	}{
+		{
+			name:            "MostSpecificRoutePage",
+			configs:         []Config{routePages, globalPages},
+			accept:          "application/json",
+			data:            Data{Status: http.StatusBadGateway, Route: "test-route"},
+			wantBody:        `{"route": "test-route", "bad_gateway": true}`,
+			wantContentType: contentTypeJSON,
+		},
+		{
+			name:            "RoutePageClass",
+			configs:         []Config{routePages, globalPages},
+			accept:          "application/json",
+			data:            Data{Status: http.StatusGatewayTimeout, Route: "test-route"},
+			wantBody:        `{"route": "test-route"}`,
+			wantContentType: contentTypeJSON,
+		},
+		{
+			name:            "GlobalPage",
+			configs:         []Config{routePages, globalPages},
+			accept:          "application/json",
+			data:            Data{Status: http.StatusNotFound},
+			wantBody:        `{"global": 404}`,
+			wantContentType: contentTypeJSON,
+		},
+		{
+			name:            "GlobalPageEscapesHTML",
+			configs:         []Config{globalPages},
+			accept:          "text/html",
+			data:            Data{Status: http.StatusNotFound, Message: "<script>"},
+			wantBody:        "<p>&lt;script&gt;</p>",
+			wantContentType: contentTypeHTML,
+		},
+		{
+			name:            "WildcardFirstTemplate",
+			configs:         []Config{routePages, globalPages},
+			accept:          "*/*",
+			data:            Data{Status: http.StatusBadGateway, Route: "test-route"},
+			wantBody:        `{"route": "test-route", "bad_gateway": true}`,
+			wantContentType: contentTypeJSON,
+		},
+		{
+			name:            "MissingAcceptFirstTemplate",
+			configs:         []Config{globalPages},
+			data:            Data{Status: http.StatusNotFound, Message: "not found"},
+			wantBody:        "<p>not found</p>",
+			wantContentType: contentTypeHTML,
+		},
+		{
+			name:            "TextWildcardWithoutHTMLTemplate",
+			configs:         []Config{routePages},
+			accept:          "text/*",
+			data:            Data{Status: http.StatusBadGateway},
+			wantBody:        "502 - Bad Gateway\n",
+			wantContentType: contentTypeText,
+		},
+		{
+			name:            "DefaultJSON",
+			accept:          "application/json",
+			data:            Data{Status: http.StatusInternalServerError, Message: "failed", RequestID: "id"},
+			wantBody:        `{"status":500,"error":"Internal Server Error","message":"failed","request_id":"id"}` + "\n",
+			wantContentType: contentTypeJSON,
+		},
+		{
+			name:            "DefaultText",
+			accept:          "*/*",
+			data:            Data{Status: http.StatusInternalServerError},
+			wantBody:        "500 - Internal Server Error\n",
+			wantContentType: contentTypeText,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			Write(w, r, tt.data, tt.configs...)
+
+			if w.Code != tt.data.Status {
+				t.Errorf("Write() status = %d, want %d", w.Code, tt.data.Status)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("Write() body = %q, want %q", got, tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Write() content type = %q, want %q", got, tt.wantContentType)
+			}
+		})
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	t.Parallel()
+	routePages := Config{Pages: []Page{{Status: "403", JSON: `{"route": {{json .Route}}, "denied": {{json .Path}}}`}}}
+	if err := routePages.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		request  func(r *http.Request) *http.Request
+		wantBody string
+	}{
+		{
+			name: "ConfigsOfContext",
+			request: func(r *http.Request) *http.Request {
+				return WithConfigs(r, "test-route", routePages)
+			},
+			wantBody: `{"route": "test-route", "denied": "/admin"}`,
+		},
+		{
+			name: "InjectedConfigs",
+			request: func(r *http.Request) *http.Request {
+				var injected *http.Request
+				routePages.Inject(func(w http.ResponseWriter, r *http.Request) {
+					injected = r
+				})(httptest.NewRecorder(), r)
+				return injected
+			},
+			wantBody: `{"route": "", "denied": "/admin"}`,
+		},
+		{
+			name: "DefaultWithoutConfigs",
+			request: func(r *http.Request) *http.Request {
+				return r
+			},
+			wantBody: `{"status":403,"error":"Forbidden"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			WriteStatus(w, tt.request(r), http.StatusForbidden, "")
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status got %d, want %d", w.Code, http.StatusForbidden)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body got %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
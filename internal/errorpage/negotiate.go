@@ -0,0 +1,86 @@
+package errorpage
+
+import (
+	"strconv"
+	"strings"
+)
+
+type format int
+
+const (
+	formatText format = iota
+	formatHTML
+	formatJSON
+	// formatAnyText is requested by text/*, configured pages are rendered with their HTML template
+	formatAnyText
+	// formatAny is requested by */* or a missing Accept header, configured pages are rendered with their first template
+	formatAny
+)
+
+func (f format) contentType() string {
+	switch f {
+	case formatHTML:
+		return contentTypeHTML
+	case formatJSON:
+		return contentTypeJSON
+	default:
+		return contentTypeText
+	}
+}
+
+// candidates are the formats of the templates of a configured page which satisfy the format in the order of their preference
+func (f format) candidates() []format {
+	switch f {
+	case formatHTML, formatJSON:
+		return []format{f}
+	case formatAnyText:
+		return []format{formatHTML}
+	case formatAny:
+		return []format{formatHTML, formatJSON}
+	default:
+		return nil
+	}
+}
+
+// negotiate returns the format with the highest quality in the Accept header. Any format is accepted without an Accept header,
+// plain text is used if no supported media type is accepted.
+func negotiate(accept string) format {
+	if strings.TrimSpace(accept) == "" {
+		return formatAny
+	}
+	best, bestQuality := formatText, 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+
+		var f format
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case "application/json", "application/problem+json":
+			f = formatJSON
+		case "text/html", "application/xhtml+xml":
+			f = formatHTML
+		case "text/plain":
+			f = formatText
+		case "text/*":
+			f = formatAnyText
+		case "*/*":
+			f = formatAny
+		default:
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = f, quality
+		}
+	}
+	return best
+}
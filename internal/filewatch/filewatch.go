@@ -0,0 +1,48 @@
+package filewatch
+
+import (
+	"context"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const pollInterval = 100 * time.Millisecond
+
+// Watch calls onChange each time the modification time of the file changes. Blocks until the context is done.
+// The file has to exist when the watch starts. If it goes missing, the error is logged once until the file exists again.
+func Watch(ctx context.Context, path string, onChange func()) {
+	initStat, err := os.Stat(path)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var missing bool
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			if !missing {
+				log.Error(err)
+				missing = true
+			}
+			continue
+		}
+		missing = false
+
+		if initStat.ModTime() != stat.ModTime() {
+			initStat = stat
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package filewatch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "watched")
+	if err := ioutil.WriteFile(path, []byte("initial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		Watch(ctx, path, func() { changes <- struct{}{} })
+		close(done)
+	}()
+
+	// the file is touched until the change is noticed, the watch may not have read the initial state at the first touch
+	timeout := time.After(5 * time.Second)
+	for modified := time.Now(); ; modified = modified.Add(time.Hour) {
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-changes:
+		case <-time.After(2 * pollInterval):
+			continue
+		case <-timeout:
+			t.Fatal("onChange was not called after the file changed")
+		}
+		break
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not return after the context was done")
+	}
+}
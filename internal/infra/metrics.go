@@ -3,8 +3,8 @@ package infra
 import (
 	"fmt"
 	"net/http"
-
-	log "github.com/sirupsen/logrus"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
@@ -17,30 +17,182 @@ var (
 		Help: "http status resp status code by prox route",
 	}, []string{"status_code", "route"},
 	)
-	HTTPInMemCacheMaxSizeInBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+	HTTPInMemCacheMaxSizeInBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "prox_in_memeory_cache_max_size_in_bytes",
-		Help: "max cache size in bytes",
-	})
+		Help: "max cache size in bytes by prox port",
+	}, []string{"port"},
+	)
 
-	HTTPInMemCacheCurrentSizeInBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+	HTTPInMemCacheCurrentSizeInBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "prox_in_memeory_cache_curren_size_in_bytes",
-		Help: "current cache size in bytes",
-	})
+		Help: "current cache size in bytes by prox port",
+	}, []string{"port"},
+	)
+
+	DiskCacheMaxSizeInBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prox_disk_cache_max_size_in_bytes",
+		Help: "max disk cache size in bytes by prox port",
+	}, []string{"port"},
+	)
+
+	DiskCacheCurrentSizeInBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prox_disk_cache_current_size_in_bytes",
+		Help: "current disk cache size in bytes by prox port",
+	}, []string{"port"},
+	)
+
+	TLSCertificateExpiryTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prox_tls_certificate_expiry_timestamp_seconds",
+		Help: "unix timestamp in seconds when the loaded tls certificate expires",
+	}, []string{"certificate", "common_name", "sans"},
+	)
+
+	RequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "prox_requests_in_flight",
+		Help: "number of requests which are currently served by prox route",
+	}, requestLabels,
+	)
+
+	UpstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prox_upstream_errors_total",
+		Help: "failed upstream requests by prox route and reason",
+	}, append(requestLabels, "reason"),
+	)
+
+	CacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prox_cache_hits_total",
+		Help: "requests served from the cache by prox route",
+	}, requestLabels,
+	)
+
+	CacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prox_cache_misses_total",
+		Help: "requests which could not be served from the cache by prox route",
+	}, requestLabels,
+	)
+
+	CacheStores = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prox_cache_stores_total",
+		Help: "responses stored in the cache by prox route",
+	}, requestLabels,
+	)
+
+	CacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prox_cache_evictions_total",
+		Help: "responses removed from the cache by prox route",
+	}, requestLabels,
+	)
+
+	CacheCoalescedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prox_cache_coalesced_requests_total",
+		Help: "cache misses which waited for a concurrent request of the same resource by prox route and result",
+	}, append(requestLabels, "result"),
+	)
+
+	CacheStaleResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prox_cache_stale_responses_total",
+		Help: "stale responses served from the cache by prox route and reason",
+	}, append(requestLabels, "reason"),
+	)
+
+	ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "prox_config_reloads_total",
+		Help: "reloads of the configuration files by config and result",
+	}, []string{"config", "result"},
+	)
+
+	RequestDuration  = newRequestDuration(prometheus.DefBuckets)
+	UpstreamDuration = newUpstreamDuration(prometheus.DefBuckets)
+	RequestSize      = newRequestSize(defaultSizeBuckets)
+	ResponseSize     = newResponseSize(defaultSizeBuckets)
 )
 
-//StartInfraHTTPEndpoint on a dedicated port which is not in use by the prox handlers
-func StartInfraHTTPEndpoint(port int) error {
+// requestLabels are used by all request related metrics
+var requestLabels = []string{"route", "port", "method"}
+
+var defaultSizeBuckets = prometheus.ExponentialBuckets(100, 10, 8)
+
+// ConfigureHistogramBuckets replaces the histograms with new ones using the given buckets.
+// Has to be called before NewHTTPHandler registers the metrics.
+func ConfigureHistogramBuckets(durationBuckets, sizeBuckets []float64) {
+	RequestDuration = newRequestDuration(durationBuckets)
+	UpstreamDuration = newUpstreamDuration(durationBuckets)
+	RequestSize = newRequestSize(sizeBuckets)
+	ResponseSize = newResponseSize(sizeBuckets)
+}
+
+func newRequestDuration(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prox_request_duration_seconds",
+		Help:    "total duration of the requests by prox route",
+		Buckets: buckets,
+	}, requestLabels)
+}
+
+func newUpstreamDuration(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prox_upstream_duration_seconds",
+		Help:    "duration until the upstream responded with its headers by prox route",
+		Buckets: buckets,
+	}, requestLabels)
+}
+
+func newRequestSize(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prox_request_size_bytes",
+		Help:    "size of the request bodies by prox route",
+		Buckets: buckets,
+	}, requestLabels)
+}
+
+func newResponseSize(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "prox_response_size_bytes",
+		Help:    "size of the response bodies written to the clients by prox route",
+		Buckets: buckets,
+	}, requestLabels)
+}
+
+// RequestLabels builds the labels for the request related metrics. Unknown methods are reported as "OTHER" to limit the label cardinality.
+func RequestLabels(route string, port uint16, method string) prometheus.Labels {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+	default:
+		method = "OTHER"
+	}
+	return prometheus.Labels{"route": route, "port": strconv.Itoa(int(port)), "method": method}
+}
+
+var healthy int32 = 1
+
+// NewHTTPHandler for the infra endpoint, which has to run on a dedicated port which is not in use by the prox handlers.
+// Additional admin handlers can be registered on the returned *http.ServeMux.
+func NewHTTPHandler() *http.ServeMux {
 	mux := http.NewServeMux()
 	metricsRegistry := prometheus.NewRegistry()
-	metricsRegistry.MustRegister(prometheus.NewGoCollector(), prometheus.NewBuildInfoCollector(), RouteStatusCode, HTTPInMemCacheCurrentSizeInBytes, HTTPInMemCacheMaxSizeInBytes)
+	metricsRegistry.MustRegister(prometheus.NewGoCollector(), prometheus.NewBuildInfoCollector(), RouteStatusCode, HTTPInMemCacheCurrentSizeInBytes, HTTPInMemCacheMaxSizeInBytes, DiskCacheCurrentSizeInBytes, DiskCacheMaxSizeInBytes, TLSCertificateExpiryTimestamp,
+		RequestsInFlight, UpstreamErrors, CacheHits, CacheMisses, CacheStores, CacheEvictions, CacheCoalescedRequests, CacheStaleResponses, ConfigReloads, RequestDuration, UpstreamDuration, RequestSize, ResponseSize)
 	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
 	mux.HandleFunc("/health", HealthHandler)
-	log.Debugf("Starting infra endpoint on port \"%d\". You can now open path /health or /metics", port)
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), mux)
+	return mux
+}
+
+// SetHealthy configures the state which will be reported by the HealthHandler
+func SetHealthy(isHealthy bool) {
+	var state int32
+	if isHealthy {
+		state = 1
+	}
+	atomic.StoreInt32(&healthy, state)
 }
 
 // HealthHandler handle http request on the /health endpoint
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&healthy) != 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, http.StatusText(http.StatusServiceUnavailable))
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprint(w, http.StatusText(http.StatusOK))
 }
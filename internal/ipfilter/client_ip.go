@@ -0,0 +1,69 @@
+package ipfilter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const forwardedForHeader = "X-Forwarded-For"
+
+type clientIPContextKey struct{}
+
+// ClientIPResolver resolves the real client IP of requests forwarded by trusted proxies from the X-Forwarded-For header
+type ClientIPResolver struct {
+	trustedProxies []*net.IPNet
+}
+
+// NewClientIPResolver creates a ClientIPResolver which trusts the X-Forwarded-For header of the proxies within the networks
+func NewClientIPResolver(trustedProxies []*net.IPNet) *ClientIPResolver {
+	return &ClientIPResolver{trustedProxies: trustedProxies}
+}
+
+// Inject the ClientIPResolver before the next handler, the resolved IP is returned by ClientIP
+func (c *ClientIPResolver) Inject(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ip := c.resolve(r); ip != nil {
+			r = r.WithContext(context.WithValue(r.Context(), clientIPContextKey{}, ip))
+		}
+		next(w, r)
+	}
+}
+
+// resolve walks the X-Forwarded-For header from the nearest to the farthest address, the first untrusted address is the client
+func (c *ClientIPResolver) resolve(r *http.Request) net.IP {
+	ip := remoteIP(r)
+	if ip == nil || !Contains(c.trustedProxies, ip) {
+		return ip
+	}
+
+	addrs := strings.Split(strings.Join(r.Header.Values(forwardedForHeader), ","), ",")
+	for i := len(addrs) - 1; i >= 0; i-- {
+		forwarded := net.ParseIP(strings.TrimSpace(addrs[i]))
+		if forwarded == nil {
+			return ip
+		}
+		ip = forwarded
+		if !Contains(c.trustedProxies, ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// ClientIP returns the client IP resolved by a ClientIPResolver or the IP of the remote address of the request
+func ClientIP(r *http.Request) net.IP {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(net.IP); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,65 @@
+package ipfilter
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/fwiedmann/prox/internal/errorpage"
+	"github.com/fwiedmann/prox/internal/filewatch"
+	log "github.com/sirupsen/logrus"
+)
+
+// Filter answers requests of clients which are not allowed by its rules with the 403 Forbidden error page.
+// The rules can be extended by a file, which is reloaded on changes.
+type Filter struct {
+	rules   Rules
+	file    string
+	current atomic.Value
+}
+
+// NewFilter creates a Filter with the parsed rules and the rules of the file, the file is optional
+func NewFilter(rules Rules, file string) (*Filter, error) {
+	f := &Filter{rules: rules, file: file}
+	current := rules
+	if file != "" {
+		fileRules, err := ReadRulesFile(file)
+		if err != nil {
+			return nil, err
+		}
+		current = rules.merge(fileRules)
+	}
+	f.current.Store(current)
+	return f, nil
+}
+
+// Inject the Filter before the next handler
+func (f *Filter) Inject(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+		if ip == nil || !f.current.Load().(Rules).IsAllowed(ip) {
+			log.Debugf("Denied request of client %s to %s", ip, r.Host)
+			errorpage.WriteStatus(w, r, http.StatusForbidden, "")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// StartFileWatch reloads the rules of the file on changes, invalid files are skipped and the current rules stay active.
+// Returns immediately if no file is configured.
+func (f *Filter) StartFileWatch(ctx context.Context) {
+	if f.file == "" {
+		return
+	}
+
+	filewatch.Watch(ctx, f.file, func() {
+		fileRules, err := ReadRulesFile(f.file)
+		if err != nil {
+			log.Errorf("could not reload ip filter rules, keep the current ones. error: %s", err)
+			return
+		}
+		f.current.Store(f.rules.merge(fileRules))
+		log.Infof("Reloaded ip filter rules from file \"%s\"", f.file)
+	})
+}
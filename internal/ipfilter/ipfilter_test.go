@@ -0,0 +1,199 @@
+package ipfilter
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRules_IsAllowed(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		rules   Rules
+		ip      string
+		want    bool
+		wantErr error
+	}{
+		{
+			name: "Empty",
+			ip:   "192.168.0.1",
+			want: true,
+		},
+		{
+			name:  "Allowed",
+			rules: Rules{Allow: []string{"10.0.0.0/8", "2001:db8::/32"}},
+			ip:    "2001:db8::1",
+			want:  true,
+		},
+		{
+			name:  "NotAllowed",
+			rules: Rules{Allow: []string{"10.0.0.0/8"}},
+			ip:    "192.168.0.1",
+		},
+		{
+			name:  "DenyTakesPrecedence",
+			rules: Rules{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.1"}},
+			ip:    "10.0.0.1",
+		},
+		{
+			name:  "DeniedIPv6",
+			rules: Rules{Deny: []string{"::1"}},
+			ip:    "::1",
+		},
+		{
+			name:    "InvalidCIDR",
+			rules:   Rules{Deny: []string{"10.0.0.0/33"}},
+			wantErr: ErrorInvalidRules,
+		},
+		{
+			name:    "InvalidIP",
+			rules:   Rules{Allow: []string{"localhost"}},
+			wantErr: ErrorInvalidRules,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.rules.Parse()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := tt.rules.IsAllowed(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("IsAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPResolver_Inject(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		wantIP       string
+	}{
+		{
+			name:         "UntrustedRemoteAddr",
+			remoteAddr:   "192.168.0.1:1234",
+			forwardedFor: []string{"203.0.113.1"},
+			wantIP:       "192.168.0.1",
+		},
+		{
+			name:         "TrustedProxy",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"203.0.113.1"},
+			wantIP:       "203.0.113.1",
+		},
+		{
+			name:         "SpoofedAddressBeforeUntrusted",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"198.51.100.1, 203.0.113.1", "10.0.0.2"},
+			wantIP:       "203.0.113.1",
+		},
+		{
+			name:         "MalformedAddress",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"203.0.113.1, unknown"},
+			wantIP:       "10.0.0.1",
+		},
+		{
+			name:       "WithoutHeader",
+			remoteAddr: "[::1]:1234",
+			wantIP:     "::1",
+		},
+	}
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add(forwardedForHeader, value)
+			}
+
+			var got net.IP
+			NewClientIPResolver(trusted).Inject(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			})(httptest.NewRecorder(), r)
+			if !got.Equal(net.ParseIP(tt.wantIP)) {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.wantIP)
+			}
+		})
+	}
+}
+
+func TestFilter_StartFileWatch(t *testing.T) {
+	t.Parallel()
+	file := filepath.Join(t.TempDir(), "ip-filter.yaml")
+	if err := ioutil.WriteFile(file, []byte("deny:\n  - 192.168.0.0/16\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := Rules{Deny: []string{"10.0.0.1"}}
+	if err := rules.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFilter(rules, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go f.StartFileWatch(ctx)
+
+	serve := func(remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		f.Inject(func(w http.ResponseWriter, r *http.Request) {})(w, r)
+		return w.Code
+	}
+
+	for addr, want := range map[string]int{"10.0.0.1:1": http.StatusForbidden, "192.168.0.1:1": http.StatusForbidden, "172.16.0.1:1": http.StatusOK} {
+		if got := serve(addr); got != want {
+			t.Errorf("status of %s got %d, want %d", addr, got, want)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := ioutil.WriteFile(file, []byte("deny:\n  - 172.16.0.0/12\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Second)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if serve("172.16.0.1:1") == http.StatusForbidden {
+			if got := serve("192.168.0.1:1"); got != http.StatusOK {
+				t.Errorf("status of the removed network got %d, want %d", got, http.StatusOK)
+			}
+			if got := serve("10.0.0.1:1"); got != http.StatusForbidden {
+				t.Errorf("status of the static network got %d, want %d", got, http.StatusForbidden)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the filter did not reload the rules of the changed file")
+}
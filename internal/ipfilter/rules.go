@@ -0,0 +1,115 @@
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var ErrorInvalidRules = errors.New("invalid ip filter rules")
+
+// Rules allow or deny client IPs. Denied networks take precedence, if allowed networks are configured only clients within them are allowed.
+type Rules struct {
+	Allow []string     `yaml:"allow,omitempty"`
+	Deny  []string     `yaml:"deny,omitempty"`
+	allow []*net.IPNet `yaml:"-"`
+	deny  []*net.IPNet `yaml:"-"`
+}
+
+// Parse the configured IPs and CIDRs
+func (r *Rules) Parse() error {
+	var err error
+	if r.allow, err = ParseNetworks(r.Allow); err != nil {
+		return fmt.Errorf("%w: %s", ErrorInvalidRules, err)
+	}
+	if r.deny, err = ParseNetworks(r.Deny); err != nil {
+		return fmt.Errorf("%w: %s", ErrorInvalidRules, err)
+	}
+	return nil
+}
+
+// IsEmpty checks if no networks are configured
+func (r Rules) IsEmpty() bool {
+	return len(r.Allow) == 0 && len(r.Deny) == 0
+}
+
+// IsAllowed checks if the client IP is allowed by the rules
+func (r Rules) IsAllowed(ip net.IP) bool {
+	if Contains(r.deny, ip) {
+		return false
+	}
+	return len(r.allow) == 0 || Contains(r.allow, ip)
+}
+
+// merge returns rules with the networks of both rules
+func (r Rules) merge(other Rules) Rules {
+	return Rules{
+		Allow: append(append([]string{}, r.Allow...), other.Allow...),
+		Deny:  append(append([]string{}, r.Deny...), other.Deny...),
+		allow: append(append([]*net.IPNet{}, r.allow...), other.allow...),
+		deny:  append(append([]*net.IPNet{}, r.deny...), other.deny...),
+	}
+}
+
+// ReadRulesFile reads and parses a yaml file with allow and deny lists
+func ReadRulesFile(path string) (Rules, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Rules{}, err
+	}
+
+	var rules Rules
+	if err := yaml.UnmarshalStrict(content, &rules); err != nil {
+		return Rules{}, fmt.Errorf("%w: file \"%s\": %s", ErrorInvalidRules, path, err)
+	}
+	if err := rules.Parse(); err != nil {
+		return Rules{}, fmt.Errorf("file \"%s\": %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseNetworks parses a list of CIDRs and single IPs, returns nil for an empty list
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		network, err := ParseNetwork(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ParseNetwork parses a CIDR or a single IP, which is converted into a network containing only the IP
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP \"%s\"", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// Contains checks if one of the networks contains the IP
+func Contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
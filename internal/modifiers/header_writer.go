@@ -0,0 +1,75 @@
+package modifiers
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// HeaderWriter calls beforeHeader once, right before the response header gets written by WriteHeader, Write or Flush.
+// It allows middlewares to set or remove headers after the next handler added its own ones.
+type HeaderWriter struct {
+	http.ResponseWriter
+	beforeHeader func(statusCode int)
+	wroteHeader  bool
+}
+
+// NewHeaderWriter wraps the http.ResponseWriter, beforeHeader receives the status code of the response
+func NewHeaderWriter(w http.ResponseWriter, beforeHeader func(statusCode int)) *HeaderWriter {
+	return &HeaderWriter{ResponseWriter: w, beforeHeader: beforeHeader}
+}
+
+// WriteHeader calls beforeHeader before the header gets written the first time
+func (hw *HeaderWriter) WriteHeader(statusCode int) {
+	if !hw.wroteHeader {
+		hw.wroteHeader = true
+		hw.beforeHeader(statusCode)
+	}
+	hw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write writes the header with the status 200 if it was not written before
+func (hw *HeaderWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+// Flush implements the http.Flusher interface if the underlying http.ResponseWriter supports it.
+// Like the http.Flusher of the http.Server, it writes the header with the status 200 if it was not written before.
+func (hw *HeaderWriter) Flush() {
+	flusher, ok := hw.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	flusher.Flush()
+}
+
+// Hijack implements the http.Hijacker interface if the underlying http.ResponseWriter supports it, e.g. for WebSocket upgrades
+func (hw *HeaderWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := hw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+// Push implements the http.Pusher interface if the underlying http.ResponseWriter supports it
+func (hw *HeaderWriter) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := hw.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+// setHeader returns a beforeHeader function which overwrites the header key of the response with the value
+func setHeader(w http.ResponseWriter, key, value string) func(int) {
+	return func(int) {
+		w.Header().Set(key, value)
+	}
+}
@@ -0,0 +1,91 @@
+package modifiers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderWriter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		write          func(w http.ResponseWriter)
+		wantStatusCode int
+	}{
+		{
+			name:           "WriteHeader",
+			write:          func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:           "Write",
+			write:          func(w http.ResponseWriter) { _, _ = w.Write([]byte("ok")) },
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "FlushBeforeWriteHeader",
+			write: func(w http.ResponseWriter) {
+				w.(http.Flusher).Flush()
+				w.WriteHeader(http.StatusNotFound)
+			},
+			wantStatusCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			recorder := httptest.NewRecorder()
+			var calls, gotStatusCode int
+			hw := NewHeaderWriter(recorder, func(statusCode int) {
+				calls++
+				gotStatusCode = statusCode
+				recorder.Header().Set("X-Injected", "true")
+			})
+			tt.write(hw)
+
+			if calls != 1 || gotStatusCode != tt.wantStatusCode {
+				t.Errorf("beforeHeader got %d calls with status %d, want 1 call with status %d", calls, gotStatusCode, tt.wantStatusCode)
+			}
+			if got := recorder.Result().Header.Get("X-Injected"); got != "true" {
+				t.Errorf("X-Injected got %q, want %q", got, "true")
+			}
+		})
+	}
+}
+
+func TestHeaderWriter_Hijack(t *testing.T) {
+	t.Parallel()
+	hw := NewHeaderWriter(NewHeaderWriter(httptest.NewRecorder(), func(int) {}), func(int) {})
+	if _, _, err := hw.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Hijack() of a http.ResponseWriter without http.Hijacker got error %v, want %v", err, http.ErrNotSupported)
+	}
+	if err := hw.Push("/style.css", nil); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Push() of a http.ResponseWriter without http.Pusher got error %v, want %v", err, http.ErrNotSupported)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := NewHeaderWriter(NewHeaderWriter(w, func(int) {}), func(int) {}).Hijack()
+		if err != nil {
+			t.Errorf("Hijack() returned error: %s", err)
+			return
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n"))
+		conn.Close()
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "test")
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Upgrade through the stacked header writers got status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+}
@@ -0,0 +1,73 @@
+package modifiers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ErrorInvalidHSTSMaxAge = errors.New("invalid hsts max-age")
+
+const (
+	hstsHeader        = "Strict-Transport-Security"
+	defaultHSTSMaxAge = "8760h"
+)
+
+// HSTSOptions configures the Strict-Transport-Security header for responses served via tls, it is used by ports and routes
+type HSTSOptions struct {
+	Enabled           bool          `yaml:"enabled"`
+	MaxAge            string        `yaml:"max-age"`
+	IncludeSubDomains bool          `yaml:"include-subdomains"`
+	Preload           bool          `yaml:"preload"`
+	maxAge            time.Duration `yaml:"-"`
+}
+
+// Parse sets the default max-age and validates it, disabled options are not validated
+func (o *HSTSOptions) Parse() error {
+	if !o.Enabled {
+		return nil
+	}
+	if o.MaxAge == "" {
+		o.MaxAge = defaultHSTSMaxAge
+	}
+	maxAge, err := time.ParseDuration(o.MaxAge)
+	if err != nil || maxAge < 0 {
+		return fmt.Errorf("%w \"%s\"", ErrorInvalidHSTSMaxAge, o.MaxAge)
+	}
+	o.maxAge = maxAge
+	return nil
+}
+
+// GetMaxAge returns a parsed duration
+func (o HSTSOptions) GetMaxAge() time.Duration {
+	return o.maxAge
+}
+
+// HSTS configuration
+type HSTS struct {
+	value string
+}
+
+// NewHSTS init a new HSTS handler with the parsed options
+func NewHSTS(options HSTSOptions) HSTS {
+	value := fmt.Sprintf("max-age=%d", int64(options.maxAge.Seconds()))
+	if options.IncludeSubDomains {
+		value += "; includeSubDomains"
+	}
+	if options.Preload {
+		value += "; preload"
+	}
+	return HSTS{value: value}
+}
+
+// Inject will set the Strict-Transport-Security header on all responses for requests served via tls
+func (h HSTS) Inject(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if request.TLS == nil {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		next.ServeHTTP(NewHeaderWriter(writer, setHeader(writer, hstsHeader, h.value)), request)
+	}
+}
@@ -0,0 +1,63 @@
+package modifiers
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHSTSOptions_Parse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		options   HSTSOptions
+		wantValue string
+		wantErr   error
+	}{
+		{
+			name:      "DefaultMaxAge",
+			options:   HSTSOptions{Enabled: true},
+			wantValue: "max-age=31536000",
+		},
+		{
+			name:      "AllDirectives",
+			options:   HSTSOptions{Enabled: true, MaxAge: "1h", IncludeSubDomains: true, Preload: true},
+			wantValue: "max-age=3600; includeSubDomains; preload",
+		},
+		{
+			name:    "InvalidMaxAge",
+			options: HSTSOptions{Enabled: true, MaxAge: "one year"},
+			wantErr: ErrorInvalidHSTSMaxAge,
+		},
+		{
+			name:    "NegativeMaxAge",
+			options: HSTSOptions{Enabled: true, MaxAge: "-1h"},
+			wantErr: ErrorInvalidHSTSMaxAge,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.options.Parse()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+			r.TLS = &tls.ConnectionState{}
+			w := httptest.NewRecorder()
+			NewHSTS(tt.options).Inject(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})(w, r)
+			if got := w.Header().Get(hstsHeader); got != tt.wantValue {
+				t.Errorf("%s got %q, want %q", hstsHeader, got, tt.wantValue)
+			}
+		})
+	}
+}
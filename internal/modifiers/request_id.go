@@ -0,0 +1,112 @@
+package modifiers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const maxRequestIDLength = 128
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type requestIDContextKey struct{}
+
+// RequestID configuration
+type RequestID struct {
+	header           string
+	generate         func() string
+	overrideIncoming bool
+}
+
+// NewRequestID init a new RequestID handler which generates missing ids with the given generate function, e.g. NewUUID or NewULID
+func NewRequestID(header string, generate func() string, overrideIncoming bool) RequestID {
+	return RequestID{
+		header:           header,
+		generate:         generate,
+		overrideIncoming: overrideIncoming,
+	}
+}
+
+// Inject will accept the request id of the incoming request or generate a new one. The id is set on the request
+// which will be sent to the upstream, on the response and in the request context, see RequestIDFromContext.
+func (rid RequestID) Inject(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(rid.header)
+		if rid.overrideIncoming || !isValidRequestID(id) {
+			id = rid.generate()
+		}
+		request.Header.Set(rid.header, id)
+		request = request.WithContext(context.WithValue(request.Context(), requestIDContextKey{}, id))
+		next.ServeHTTP(NewHeaderWriter(writer, setHeader(writer, rid.header, id)), request)
+	}
+}
+
+// RequestIDFromContext returns the request id injected by RequestID, empty if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// isValidRequestID only accepts ids which can be logged safely
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewUUID generates a random version 4 UUID
+func NewUUID() string {
+	var b [16]byte
+	readRandom(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// NewULID generates a lexicographically sortable ULID from the current time and random bits
+func NewULID() string {
+	var b [16]byte
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(b[:6], timestamp[2:])
+	readRandom(b[6:])
+	return encodeCrockford(b)
+}
+
+// encodeCrockford encodes the 128 bits as 26 characters of the Crockford base32 alphabet
+func encodeCrockford(b [16]byte) string {
+	out := make([]byte, 26)
+	for i := range out {
+		var value byte
+		for j := 0; j < 5; j++ {
+			// the encoded 130 bits are prefixed by two zero bits
+			bit := i*5 + j - 2
+			value <<= 1
+			if bit >= 0 && b[bit/8]&(0x80>>uint(bit%8)) != 0 {
+				value |= 1
+			}
+		}
+		out[i] = crockfordAlphabet[value]
+	}
+	return string(out)
+}
+
+func readRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		log.Errorf("could not read random bytes for request id, error: %s", err)
+	}
+}
@@ -0,0 +1,134 @@
+package modifiers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidPattern = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+)
+
+func TestRequestID_Inject(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		incomingID       string
+		overrideIncoming bool
+		wantID           string
+	}{
+		{
+			name:   "Generate",
+			wantID: "generated",
+		},
+		{
+			name:       "AcceptIncoming",
+			incomingID: "01EN6Q9XK2ABCDEF",
+			wantID:     "01EN6Q9XK2ABCDEF",
+		},
+		{
+			name:             "OverrideIncoming",
+			incomingID:       "01EN6Q9XK2ABCDEF",
+			overrideIncoming: true,
+			wantID:           "generated",
+		},
+		{
+			name:       "RejectInvalidIncoming",
+			incomingID: "id with\nnew line",
+			wantID:     "generated",
+		},
+		{
+			name:       "RejectTooLongIncoming",
+			incomingID: strings.Repeat("a", maxRequestIDLength+1),
+			wantID:     "generated",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var upstreamID, contextID string
+			handler := NewRequestID("X-Request-ID", func() string { return "generated" }, tt.overrideIncoming).Inject(func(w http.ResponseWriter, r *http.Request) {
+				upstreamID = r.Header.Get("X-Request-ID")
+				contextID = RequestIDFromContext(r.Context())
+				w.Header().Set("X-Request-ID", "set-by-upstream")
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incomingID != "" {
+				r.Header.Set("X-Request-ID", tt.incomingID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if upstreamID != tt.wantID || contextID != tt.wantID {
+				t.Errorf("request id of the request is %q and of the context %q, want %q", upstreamID, contextID, tt.wantID)
+			}
+			if got := w.Header().Get("X-Request-ID"); got != tt.wantID {
+				t.Errorf("request id of the response is %q, want %q", got, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	t.Parallel()
+	first, second := NewUUID(), NewUUID()
+	if !uuidPattern.MatchString(first) {
+		t.Errorf("NewUUID() = %s, want a version 4 uuid", first)
+	}
+	if first == second {
+		t.Errorf("NewUUID() returned %s twice", first)
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	t.Parallel()
+	first := NewULID()
+	if !ulidPattern.MatchString(first) {
+		t.Errorf("NewULID() = %s, want a ulid", first)
+	}
+	if second := NewULID(); first[:10] > second[:10] {
+		t.Errorf("NewULID() timestamp of %s is after %s", first, second)
+	}
+}
+
+func Test_encodeCrockford(t *testing.T) {
+	t.Parallel()
+	var max [16]byte
+	for i := range max {
+		max[i] = 0xff
+	}
+	tests := []struct {
+		name  string
+		input [16]byte
+		want  string
+	}{
+		{
+			name: "Zero",
+			want: "00000000000000000000000000",
+		},
+		{
+			name:  "Max",
+			input: max,
+			want:  "7ZZZZZZZZZZZZZZZZZZZZZZZZZ",
+		},
+		{
+			name:  "LastBit",
+			input: [16]byte{15: 1},
+			want:  "00000000000000000000000001",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeCrockford(tt.input); got != tt.want {
+				t.Errorf("encodeCrockford() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package securityheaders
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fwiedmann/prox/internal/modifiers"
+	"github.com/fwiedmann/prox/internal/stringutil"
+)
+
+var ErrorInvalidConfig = errors.New("invalid security headers configuration")
+
+const (
+	contentSecurityPolicyHeader = "Content-Security-Policy"
+	frameOptionsHeader          = "X-Frame-Options"
+	contentTypeOptionsHeader    = "X-Content-Type-Options"
+	referrerPolicyHeader        = "Referrer-Policy"
+	permissionsPolicyHeader     = "Permissions-Policy"
+)
+
+// identifyingHeaders of upstream responses which reveal the software of the upstream
+var identifyingHeaders = []string{"Server", "X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version"}
+
+var frameOptions = []string{"DENY", "SAMEORIGIN"}
+
+var referrerPolicies = []string{
+	"no-referrer",
+	"no-referrer-when-downgrade",
+	"origin",
+	"origin-when-cross-origin",
+	"same-origin",
+	"strict-origin",
+	"strict-origin-when-cross-origin",
+	"unsafe-url",
+}
+
+// Config of the security headers of a route
+type Config struct {
+	Enabled                 bool                  `yaml:"enabled"`
+	HSTS                    modifiers.HSTSOptions `yaml:"hsts"`
+	ContentSecurityPolicy   string                `yaml:"content-security-policy"`
+	FrameOptions            string                `yaml:"frame-options"`
+	ContentTypeNosniff      bool                  `yaml:"content-type-nosniff"`
+	ReferrerPolicy          string                `yaml:"referrer-policy"`
+	PermissionsPolicy       string                `yaml:"permissions-policy"`
+	StripIdentifyingHeaders bool                  `yaml:"strip-identifying-headers"`
+	DisableProxyHeader      bool                  `yaml:"disable-proxy-header"`
+}
+
+// Parse validates the configuration and sets the defaults
+func (c *Config) Parse() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if err := c.HSTS.Parse(); err != nil {
+		return fmt.Errorf("%w: %s", ErrorInvalidConfig, err)
+	}
+
+	if c.FrameOptions != "" {
+		c.FrameOptions = strings.ToUpper(c.FrameOptions)
+		if !stringutil.Contains(frameOptions, c.FrameOptions) {
+			return fmt.Errorf("%w: unsupported frame options \"%s\"", ErrorInvalidConfig, c.FrameOptions)
+		}
+	}
+
+	if c.ReferrerPolicy == "" {
+		return nil
+	}
+	for _, policy := range strings.Split(c.ReferrerPolicy, ",") {
+		if !stringutil.Contains(referrerPolicies, strings.TrimSpace(policy)) {
+			return fmt.Errorf("%w: unsupported referrer policy \"%s\"", ErrorInvalidConfig, policy)
+		}
+	}
+	return nil
+}
+
+// IsProxyHeaderDisabled checks if the x-hit-by-prox header should not be added to responses
+func (c Config) IsProxyHeaderDisabled() bool {
+	return c.Enabled && c.DisableProxyHeader
+}
+
+// Inject the security headers before the next handler, they overwrite the headers of the upstream response
+func (c Config) Inject(next http.HandlerFunc) http.HandlerFunc {
+	if c.HSTS.Enabled {
+		next = modifiers.NewHSTS(c.HSTS).Inject(next)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(modifiers.NewHeaderWriter(w, func(int) {
+			c.setHeaders(w.Header())
+		}), r)
+	}
+}
+
+func (c Config) setHeaders(header http.Header) {
+	for name, value := range map[string]string{
+		contentSecurityPolicyHeader: c.ContentSecurityPolicy,
+		frameOptionsHeader:          c.FrameOptions,
+		referrerPolicyHeader:        c.ReferrerPolicy,
+		permissionsPolicyHeader:     c.PermissionsPolicy,
+	} {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+	if c.ContentTypeNosniff {
+		header.Set(contentTypeOptionsHeader, "nosniff")
+	}
+	if c.StripIdentifyingHeaders {
+		for _, name := range identifyingHeaders {
+			header.Del(name)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package securityheaders
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fwiedmann/prox/internal/modifiers"
+)
+
+func TestConfig_Parse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr error
+	}{
+		{
+			name:   "Disabled",
+			config: Config{FrameOptions: "ALLOW"},
+		},
+		{
+			name:   "Valid",
+			config: Config{Enabled: true, HSTS: modifiers.HSTSOptions{Enabled: true}, FrameOptions: "sameorigin", ReferrerPolicy: "no-referrer, strict-origin-when-cross-origin"},
+		},
+		{
+			name:    "InvalidHSTSMaxAge",
+			config:  Config{Enabled: true, HSTS: modifiers.HSTSOptions{Enabled: true, MaxAge: "one year"}},
+			wantErr: ErrorInvalidConfig,
+		},
+		{
+			name:    "InvalidFrameOptions",
+			config:  Config{Enabled: true, FrameOptions: "ALLOW-FROM https://example.com"},
+			wantErr: ErrorInvalidConfig,
+		},
+		{
+			name:    "InvalidReferrerPolicy",
+			config:  Config{Enabled: true, ReferrerPolicy: "never"},
+			wantErr: ErrorInvalidConfig,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tt.config.Parse(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_Inject(t *testing.T) {
+	t.Parallel()
+	config := Config{
+		Enabled:                 true,
+		HSTS:                    modifiers.HSTSOptions{Enabled: true, MaxAge: "1h", IncludeSubDomains: true},
+		ContentSecurityPolicy:   "default-src 'self'",
+		FrameOptions:            "deny",
+		ContentTypeNosniff:      true,
+		ReferrerPolicy:          "no-referrer",
+		PermissionsPolicy:       "geolocation=()",
+		StripIdentifyingHeaders: true,
+	}
+	if err := config.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		tls        bool
+		wantHeader map[string]string
+	}{
+		{
+			name: "TLS",
+			tls:  true,
+			wantHeader: map[string]string{
+				"Strict-Transport-Security": "max-age=3600; includeSubDomains",
+				"Content-Security-Policy":   "default-src 'self'",
+				"X-Frame-Options":           "DENY",
+				"X-Content-Type-Options":    "nosniff",
+				"Referrer-Policy":           "no-referrer",
+				"Permissions-Policy":        "geolocation=()",
+				"Server":                    "",
+				"X-Powered-By":              "",
+			},
+		},
+		{
+			name: "WithoutTLS",
+			wantHeader: map[string]string{
+				"Strict-Transport-Security": "",
+				"Content-Security-Policy":   "default-src 'self'",
+				"Server":                    "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			handler := config.Inject(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Server", "nginx/1.19.0")
+				w.Header().Set("X-Powered-By", "PHP/7.4")
+				w.Header().Set("Content-Security-Policy", "default-src *")
+				_, _ = w.Write([]byte("ok"))
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			for name, want := range tt.wantHeader {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s got %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorListenerNotInheritable = errors.New("listener does not support file descriptor inheritance")
+	ErrorChildNotReady          = errors.New("child process did not report readiness")
+)
+
+const (
+	inheritedListenersEnv = "PROX_INHERITED_LISTENERS"
+	readyFDEnv            = "PROX_READY_FD"
+	// the first file descriptor after stdin, stdout and stderr
+	firstInheritedFD = 3
+	readyMessage     = "ready"
+)
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Inherit uses the given network listener instead of opening a new one on Listen
+func (l *Listener) Inherit(ln net.Listener) {
+	l.listener = ln
+}
+
+// DuplicateListener returns a new network listener which shares the socket of the Listener.
+// The socket stays open until both listeners are closed, which allows to replace a Listener without refusing connections.
+func (l *Listener) DuplicateListener() (net.Listener, error) {
+	lf, ok := l.listener.(filer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrorListenerNotInheritable, l.HandoffKey())
+	}
+	f, err := lf.File()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// HandoffKey identifies the Listener between the parent and the child process during a hot restart
+func (l *Listener) HandoffKey() string {
+	return fmt.Sprintf("%s=%s", l.name, l.server.Addr)
+}
+
+// InheritedListeners returns the network listeners which were passed by the parent process during a hot restart, identified by their Listener.HandoffKey.
+func InheritedListeners() (map[string]net.Listener, error) {
+	value := os.Getenv(inheritedListenersEnv)
+	if value == "" {
+		return map[string]net.Listener{}, nil
+	}
+
+	keys := strings.Split(value, ",")
+	files := make([]*os.File, 0, len(keys))
+	for i, key := range keys {
+		files = append(files, os.NewFile(uintptr(firstInheritedFD+i), key))
+	}
+	return listenersFromFiles(keys, files)
+}
+
+func listenersFromFiles(keys []string, files []*os.File) (map[string]net.Listener, error) {
+	listeners := make(map[string]net.Listener, len(keys))
+	for i, key := range keys {
+		ln, err := net.FileListener(files[i])
+		// net.FileListener duplicates the file descriptor
+		files[i].Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not inherit listener \"%s\", error: %w", key, err)
+		}
+		listeners[key] = ln
+	}
+	return listeners, nil
+}
+
+// NotifyReady reports the parent process that all inherited listeners are served. Does nothing if the process was not started by a hot restart.
+func NotifyReady() error {
+	value := os.Getenv(readyFDEnv)
+	if value == "" {
+		return nil
+	}
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	_, err = f.Write([]byte(readyMessage))
+	return err
+}
+
+// StartChild execs the current binary with the same arguments and passes the network listeners via file descriptor inheritance.
+// Blocks until the child reports its readiness. If the child does not get ready within the timeout it will be killed.
+func StartChild(listeners []*Listener, readyTimeout time.Duration) (*os.Process, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	keys := make([]string, 0, len(listeners))
+	for _, l := range listeners {
+		lf, ok := l.listener.(filer)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrorListenerNotInheritable, l.HandoffKey())
+		}
+		f, err := lf.File()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		keys = append(keys, l.HandoffKey())
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer readyReader.Close()
+	files = append(files, readyWriter)
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(environWithout(inheritedListenersEnv, readyFDEnv),
+		fmt.Sprintf("%s=%s", inheritedListenersEnv, strings.Join(keys, ",")),
+		fmt.Sprintf("%s=%d", readyFDEnv, firstInheritedFD+len(keys)),
+	)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	// the child holds its own copy of the pipe, an EOF signals that the child exited or closed it without readiness
+	readyWriter.Close()
+	files = files[:len(files)-1]
+
+	ready := make(chan error, 1)
+	go func() {
+		msg := make([]byte, len(readyMessage))
+		_, err := io.ReadFull(readyReader, msg)
+		if err == nil && string(msg) != readyMessage {
+			err = ErrorChildNotReady
+		}
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err == nil {
+			return cmd.Process, nil
+		}
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("%w: %s", ErrorChildNotReady, err)
+	case <-time.After(readyTimeout):
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, ErrorChildNotReady
+	}
+}
+
+func environWithout(keys ...string) []string {
+	env := make([]string, 0, len(os.Environ()))
+	for _, entry := range os.Environ() {
+		var skip bool
+		for _, key := range keys {
+			if strings.HasPrefix(entry, key+"=") {
+				skip = true
+			}
+		}
+		if !skip {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
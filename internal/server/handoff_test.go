@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func Test_listenersFromFiles(t *testing.T) {
+	t.Parallel()
+	l := NewListener("http", "127.0.0.1:0", http.NotFoundHandler(), nil)
+	if err := l.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer l.listener.Close()
+
+	f, err := l.listener.(filer).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inherited, err := listenersFromFiles([]string{l.HandoffKey()}, []*os.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, ok := inherited[l.HandoffKey()]
+	if !ok {
+		t.Fatalf("listenersFromFiles() did not return a listener for key %s", l.HandoffKey())
+	}
+	defer ln.Close()
+
+	if ln.Addr().String() != l.Addr().String() {
+		t.Errorf("inherited listener address = %s, want %s", ln.Addr(), l.Addr())
+	}
+
+	child := NewListener("http", "127.0.0.1:0", http.NotFoundHandler(), nil)
+	child.Inherit(ln)
+	if err := child.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	if child.Addr().String() != l.Addr().String() {
+		t.Errorf("Listen() did not use the inherited listener, got address %s", child.Addr())
+	}
+
+	// connections to the original socket are accepted by the inherited listener
+	go func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func Test_environWithout(t *testing.T) {
+	if err := os.Setenv(inheritedListenersEnv, "http=:80"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv(inheritedListenersEnv)
+
+	for _, entry := range environWithout(inheritedListenersEnv) {
+		if entry == inheritedListenersEnv+"=http=:80" {
+			t.Errorf("environWithout() did not remove %s", inheritedListenersEnv)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const drainPollInterval = 50 * time.Millisecond
+
+// Report contains the connections which had to be terminated forcibly during the shutdown of a Listener
+type Report struct {
+	Name                   string
+	ForciblyClosedRequests int
+	ForciblyClosedUpgrades int
+}
+
+// Forced reports if any connection had to be terminated forcibly
+func (r Report) Forced() bool {
+	return r.ForciblyClosedRequests > 0 || r.ForciblyClosedUpgrades > 0
+}
+
+// Listener serves http traffic on a single address and tracks all accepted connections, including hijacked ones, to drain them on shutdown
+type Listener struct {
+	name      string
+	server    *http.Server
+	tlsConfig *tls.Config
+	listener  net.Listener
+	conns     map[*trackedConn]struct{}
+	mtx       sync.Mutex
+}
+
+// NewListener creates a Listener for the given address. If tlsConfig is not nil, the Listener will serve https.
+func NewListener(name, addr string, handler http.Handler, tlsConfig *tls.Config) *Listener {
+	return &Listener{
+		name:      name,
+		server:    &http.Server{Addr: addr, Handler: handler, ConnContext: withConn},
+		tlsConfig: tlsConfig,
+		conns:     make(map[*trackedConn]struct{}),
+	}
+}
+
+// Server returns the underlying *http.Server which can be configured before Serve is called
+func (l *Listener) Server() *http.Server {
+	return l.server
+}
+
+// Name of the Listener
+func (l *Listener) Name() string {
+	return l.name
+}
+
+// Addr returns the network address of the opened listener
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Listen opens the network listener of the Listener, if no listener was inherited
+func (l *Listener) Listen() error {
+	if l.listener != nil {
+		return nil
+	}
+	ln, err := net.Listen("tcp", l.server.Addr)
+	if err != nil {
+		return err
+	}
+	l.listener = ln
+	return nil
+}
+
+// Close closes the network listener of a Listener which was not served, served Listeners have to be shut down
+func (l *Listener) Close() error {
+	if l.listener == nil {
+		return nil
+	}
+	return l.listener.Close()
+}
+
+// Serve accepts connections until the Listener gets shut down. Listen has to be called before.
+// Returns nil if the Listener was shut down.
+func (l *Listener) Serve() error {
+	var ln net.Listener = &trackingListener{Listener: l.listener, owner: l}
+	if l.tlsConfig != nil {
+		l.server.TLSConfig = l.tlsConfig
+		ln = tls.NewListener(ln, l.tlsConfig)
+	}
+
+	if err := l.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting new connections and waits until all in-flight requests and upgraded connections are finished.
+// When the context is done before, all remaining connections will be closed forcibly.
+func (l *Listener) Shutdown(ctx context.Context) Report {
+	report := Report{Name: l.name}
+
+	if err := l.server.Shutdown(ctx); err != nil {
+		remaining := l.openConnections()
+		if err := l.server.Close(); err != nil {
+			log.Errorf("could not close listener \"%s\", error: %s", l.name, err)
+		}
+		report.ForciblyClosedUpgrades = l.closeConnections()
+		report.ForciblyClosedRequests = remaining - report.ForciblyClosedUpgrades
+		return report
+	}
+
+	// http.Server.Shutdown does not wait for hijacked connections, all remaining connections are upgraded ones
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for l.openConnections() > 0 {
+		select {
+		case <-ctx.Done():
+			report.ForciblyClosedUpgrades = l.closeConnections()
+			return report
+		case <-ticker.C:
+		}
+	}
+	return report
+}
+
+func (l *Listener) openConnections() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return len(l.conns)
+}
+
+func (l *Listener) closeConnections() int {
+	l.mtx.Lock()
+	conns := make([]*trackedConn, 0, len(l.conns))
+	for c := range l.conns {
+		conns = append(conns, c)
+	}
+	l.mtx.Unlock()
+
+	var closed int
+	for _, c := range conns {
+		if err := c.Close(); err == nil {
+			closed++
+		}
+	}
+	return closed
+}
+
+type trackingListener struct {
+	net.Listener
+	owner *Listener
+}
+
+func (tl *trackingListener) Accept() (net.Conn, error) {
+	conn, err := tl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{Conn: conn, owner: tl.owner}
+	tl.owner.mtx.Lock()
+	tl.owner.conns[tc] = struct{}{}
+	tl.owner.mtx.Unlock()
+	return tc, nil
+}
+
+type trackedConn struct {
+	net.Conn
+	owner *Listener
+	once  sync.Once
+}
+
+func (tc *trackedConn) Close() error {
+	err := tc.Conn.Close()
+	tc.once.Do(func() {
+		tc.owner.mtx.Lock()
+		delete(tc.owner.conns, tc)
+		tc.owner.mtx.Unlock()
+	})
+	return err
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func startTestListener(t *testing.T, handler http.Handler) *Listener {
+	l := NewListener("test", "127.0.0.1:0", handler, nil)
+	if err := l.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := l.Serve(); err != nil {
+			t.Error(err)
+		}
+	}()
+	return l
+}
+
+func TestListener_Shutdown(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		handler      func(release <-chan struct{}) http.HandlerFunc
+		drainTimeout time.Duration
+		want         Report
+	}{
+		{
+			name: "DrainInFlightRequest",
+			handler: func(release <-chan struct{}) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					<-release
+					w.WriteHeader(http.StatusOK)
+				}
+			},
+			drainTimeout: 5 * time.Second,
+			want:         Report{Name: "test"},
+		},
+		{
+			name: "ForceInFlightRequest",
+			handler: func(_ <-chan struct{}) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					<-r.Context().Done()
+				}
+			},
+			drainTimeout: 100 * time.Millisecond,
+			want:         Report{Name: "test", ForciblyClosedRequests: 1},
+		},
+		{
+			name: "ForceUpgradedConnection",
+			handler: func(_ <-chan struct{}) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+				}
+			},
+			drainTimeout: 100 * time.Millisecond,
+			want:         Report{Name: "test", ForciblyClosedUpgrades: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			l := startTestListener(t, tt.handler(release))
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			// wait until the request is in-flight
+			for l.openConnections() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				close(release)
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.drainTimeout)
+			defer cancel()
+			if got := l.Shutdown(ctx); got != tt.want {
+				t.Errorf("Shutdown() = %+v, want %+v", got, tt.want)
+			}
+			if l.openConnections() != 0 {
+				t.Errorf("Shutdown() left %d open connections", l.openConnections())
+			}
+		})
+	}
+}
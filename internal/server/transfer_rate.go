@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ErrorMinTransferRate is returned by request bodies which are sent slower than the minimum transfer rate
+var ErrorMinTransferRate = errors.New("request body was sent slower than the minimum transfer rate")
+
+type connContextKey struct{}
+
+type minRateBodyContextKey struct{}
+
+// withConn is the ConnContext of all listeners, it makes the connection of a request available to handlers
+func withConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// MinTransferRate aborts reading request bodies which are sent slower than the minimum rate. The rate is measured after the grace period
+// and only the time spent waiting for the client counts. It applies to HTTP/1 requests, because it sets read deadlines on the connection.
+type MinTransferRate struct {
+	bytesPerSecond int64
+	gracePeriod    time.Duration
+	readTimeout    time.Duration
+}
+
+// NewMinTransferRate creates a MinTransferRate, the read timeout of the server is kept as upper limit for reading the body
+func NewMinTransferRate(bytesPerSecond int64, gracePeriod, readTimeout time.Duration) *MinTransferRate {
+	return &MinTransferRate{bytesPerSecond: bytesPerSecond, gracePeriod: gracePeriod, readTimeout: readTimeout}
+}
+
+// IsMinTransferRateExceeded reports if the body of the request with the context was sent slower than the minimum transfer rate.
+// The server cancels the context of the request once reading the body failed, so the error of the body can get lost.
+func IsMinTransferRateExceeded(ctx context.Context) bool {
+	body, ok := ctx.Value(minRateBodyContextKey{}).(*minRateBody)
+	return ok && atomic.LoadInt32(&body.exceeded) == 1
+}
+
+// Inject the MinTransferRate before the next handler
+func (m *MinTransferRate) Inject(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := r.Context().Value(connContextKey{}).(net.Conn)
+		if ok && r.ProtoMajor == 1 && r.Body != nil && r.Body != http.NoBody {
+			body := &minRateBody{ReadCloser: r.Body, conn: conn, rate: m}
+			if m.readTimeout > 0 {
+				body.readDeadline = time.Now().Add(m.readTimeout)
+			}
+			r.Body = body
+			r = r.WithContext(context.WithValue(r.Context(), minRateBodyContextKey{}, body))
+		}
+		next(w, r)
+	}
+}
+
+type minRateBody struct {
+	io.ReadCloser
+	conn         net.Conn
+	rate         *MinTransferRate
+	readDeadline time.Time
+	read         int64
+	waited       time.Duration
+	exceeded     int32
+}
+
+// Read sets a deadline on the connection until which the client has to send the next bytes to keep the minimum rate
+func (b *minRateBody) Read(p []byte) (int, error) {
+	allowed := b.rate.gracePeriod + time.Duration(float64(b.read)/float64(b.rate.bytesPerSecond)*float64(time.Second))
+	start := time.Now()
+	deadline := start.Add(allowed - b.waited)
+	if !b.readDeadline.IsZero() && b.readDeadline.Before(deadline) {
+		deadline = b.readDeadline
+	}
+
+	_ = b.conn.SetReadDeadline(deadline)
+	n, err := b.ReadCloser.Read(p)
+	_ = b.conn.SetReadDeadline(b.readDeadline)
+
+	b.waited += time.Since(start)
+	b.read += int64(n)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() && (b.readDeadline.IsZero() || time.Now().Before(b.readDeadline)) {
+		atomic.StoreInt32(&b.exceeded, 1)
+		return n, fmt.Errorf("%w: received %d bytes within %s", ErrorMinTransferRate, b.read, b.waited)
+	}
+	return n, err
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMinTransferRate_Inject(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		chunks       int
+		chunkDelay   time.Duration
+		wantExceeded bool
+	}{
+		{
+			name:   "Fast",
+			chunks: 4,
+		},
+		{
+			name:       "SlowWithinGracePeriod",
+			chunks:     2,
+			chunkDelay: 50 * time.Millisecond,
+		},
+		{
+			name:         "Slow",
+			chunks:       20,
+			chunkDelay:   100 * time.Millisecond,
+			wantExceeded: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			result := make(chan bool, 1)
+			handler := NewMinTransferRate(1000, 200*time.Millisecond, 0).Inject(func(w http.ResponseWriter, r *http.Request) {
+				_, err := ioutil.ReadAll(r.Body)
+				if err != nil && !IsMinTransferRateExceeded(r.Context()) {
+					t.Errorf("body failed without exceeding the min transfer rate, error: %s", err)
+				}
+				result <- IsMinTransferRateExceeded(r.Context())
+			})
+			l := startTestListener(t, handler)
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				l.Shutdown(ctx)
+			}()
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			chunk := strings.Repeat("a", 10)
+			_, _ = fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: %d\r\n\r\n", tt.chunks*len(chunk))
+			for i := 0; i < tt.chunks; i++ {
+				time.Sleep(tt.chunkDelay)
+				if _, err := conn.Write([]byte(chunk)); err != nil {
+					break
+				}
+			}
+
+			select {
+			case exceeded := <-result:
+				if exceeded != tt.wantExceeded {
+					t.Errorf("min transfer rate exceeded got %t, want %t", exceeded, tt.wantExceeded)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("handler did not finish reading the body")
+			}
+			if !tt.wantExceeded {
+				if _, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil {
+					t.Errorf("could not read the response, error: %s", err)
+				}
+			}
+		})
+	}
+}
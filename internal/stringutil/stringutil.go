@@ -0,0 +1,11 @@
+package stringutil
+
+// Contains checks if the value is one of the values
+func Contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/fwiedmann/prox/internal/config"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// Provider exports the spans created by prox to an OTLP collector
+type Provider struct {
+	tracerProvider *sdktrace.TracerProvider
+}
+
+// New creates a Provider and registers it together with the configured propagators as the global OpenTelemetry tracer provider.
+// Spans are sampled by the configured sample rate, unless the inbound request already contains a sampling decision.
+func New(ctx context.Context, conf config.Tracing) (*Provider, error) {
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(conf.Endpoint),
+		otlptracehttp.WithURLPath(conf.URLPath),
+		otlptracehttp.WithTimeout(conf.GetExportTimeout()),
+	}
+	if conf.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if len(conf.Headers) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(conf.Headers))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(*conf.SampleRate))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(conf.ServiceName))),
+	)
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(newPropagator(conf.Propagators))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Errorf("could not export traces, error: %s", err)
+	}))
+
+	return &Provider{tracerProvider: tracerProvider}, nil
+}
+
+// Shutdown exports all pending spans and stops the exporter
+func (p *Provider) Shutdown(ctx context.Context) error {
+	return p.tracerProvider.Shutdown(ctx)
+}
+
+func newPropagator(propagators []string) propagation.TextMapPropagator {
+	textMapPropagators := make([]propagation.TextMapPropagator, 0, len(propagators))
+	for _, p := range propagators {
+		switch p {
+		case config.TracingPropagatorTraceContext:
+			textMapPropagators = append(textMapPropagators, propagation.TraceContext{})
+		case config.TracingPropagatorB3:
+			textMapPropagators = append(textMapPropagators, b3.New())
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(textMapPropagators...)
+}
@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fwiedmann/prox/internal/config"
+	"go.opentelemetry.io/otel"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is an in-process OTLP/HTTP collector which stores the received spans
+type collector struct {
+	mtx      sync.Mutex
+	services []string
+	spans    []string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	request := &coltracepb.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(body, request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, resourceSpans := range request.GetResourceSpans() {
+		for _, attr := range resourceSpans.GetResource().GetAttributes() {
+			if attr.GetKey() == "service.name" {
+				c.services = append(c.services, attr.GetValue().GetStringValue())
+			}
+		}
+		for _, librarySpans := range resourceSpans.GetInstrumentationLibrarySpans() {
+			for _, span := range librarySpans.GetSpans() {
+				c.spans = append(c.spans, span.GetName())
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestNew(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	rate := 1.0
+	conf := config.Tracing{
+		Enabled:     true,
+		Endpoint:    strings.TrimPrefix(server.URL, "http://"),
+		URLPath:     "/v1/traces",
+		Insecure:    true,
+		ServiceName: "prox-test",
+		SampleRate:  &rate,
+		Propagators: []string{config.TracingPropagatorTraceContext, config.TracingPropagatorB3},
+	}
+
+	p, err := New(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.spans) != 1 || c.spans[0] != "test-span" {
+		t.Errorf("collector received spans %v, want [test-span]", c.spans)
+	}
+	if len(c.services) != 1 || c.services[0] != "prox-test" {
+		t.Errorf("collector received services %v, want [prox-test]", c.services)
+	}
+}
+
+func Test_newPropagator(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		propagators []string
+		wantFields  []string
+	}{
+		{
+			name:        "TraceContext",
+			propagators: []string{config.TracingPropagatorTraceContext},
+			wantFields:  []string{"traceparent", "tracestate"},
+		},
+		{
+			name:        "B3",
+			propagators: []string{config.TracingPropagatorB3},
+			wantFields:  []string{"x-b3-traceid", "x-b3-spanid", "x-b3-sampled", "x-b3-flags"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fields := make(map[string]bool)
+			for _, f := range newPropagator(tt.propagators).Fields() {
+				fields[strings.ToLower(f)] = true
+			}
+			for _, want := range tt.wantFields {
+				if !fields[want] {
+					t.Errorf("newPropagator() fields %v are missing %s", fields, want)
+				}
+			}
+		})
+	}
+}